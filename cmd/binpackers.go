@@ -0,0 +1,42 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+)
+
+// BinpackerOptions describes how the extender uses a custom binpack function
+type BinpackerOptions struct {
+	// IsSingleAz marks binpack functions which place applications in a single zone, so that dynamically allocated
+	// executors are kept in the zone of their application and demands are created for that zone
+	IsSingleAz bool
+	// MinimalFragmentationReschedule reschedules executors on the nodes already running executors of the same
+	// application when possible, instead of on the first node with enough capacity
+	MinimalFragmentationReschedule bool
+}
+
+// RegisterBinpacker registers a custom binpack function under the given name, which can then be used wherever the
+// configuration or applications name a binpack algorithm. It has to be called before New, typically by a main package
+// wrapping this one, and fails if the name is empty or already registered.
+func RegisterBinpacker(name string, binpackFunc binpack.SparkBinPackFunction, options BinpackerOptions) error {
+	return binpacker.Register(binpacker.Binpacker{
+		Name:                           name,
+		BinpackFunc:                    binpackFunc,
+		IsSingleAz:                     options.IsSingleAz,
+		MinimalFragmentationReschedule: options.MinimalFragmentationReschedule,
+	})
+}
@@ -19,6 +19,7 @@ import (
 
 	clientset "github.com/palantir/k8s-spark-scheduler-lib/pkg/client/clientset/versioned"
 	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/crd"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/kubernetes"
@@ -31,6 +32,10 @@ type AllClient struct {
 	APIExtensionsClient  apiextensionsclientset.Interface
 	SparkSchedulerClient clientset.Interface
 	KubeClient           kubernetes.Interface
+	// SparkApplicationClient is only used if the spark-operator integration is turned on
+	SparkApplicationClient rest.Interface
+	// InstanceGroupConfigClient is only used if the instance group configs are turned on
+	InstanceGroupConfigClient rest.Interface
 }
 
 // GetClients creates AllClient given the passed in install config
@@ -68,9 +73,21 @@ func GetClients(ctx context.Context, install config.Install) (AllClient, error)
 		svc1log.FromContext(ctx).Error("Error building api extensions clientset: %s", svc1log.Stacktrace(err))
 		return AllClient{}, err
 	}
+	sparkApplicationClient, err := crd.NewSparkApplicationClient(kubeconfig)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("Error building spark application client: %s", svc1log.Stacktrace(err))
+		return AllClient{}, err
+	}
+	instanceGroupConfigClient, err := crd.NewInstanceGroupConfigClient(kubeconfig)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("Error building instance group config client: %s", svc1log.Stacktrace(err))
+		return AllClient{}, err
+	}
 	return AllClient{
-		APIExtensionsClient:  apiExtensionsClient,
-		SparkSchedulerClient: sparkSchedulerClient,
-		KubeClient:           kubeClient,
+		APIExtensionsClient:       apiExtensionsClient,
+		SparkSchedulerClient:      sparkSchedulerClient,
+		KubeClient:                kubeClient,
+		SparkApplicationClient:    sparkApplicationClient,
+		InstanceGroupConfigClient: instanceGroupConfigClient,
 	}, nil
 }
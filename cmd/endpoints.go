@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
@@ -22,10 +23,12 @@ import (
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-server/rest"
 	"github.com/palantir/witchcraft-go-server/wrouter"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	schedulerapi "k8s.io/kube-scheduler/extender/v1"
 )
 
-func registerExtenderEndpoints(r wrouter.Router, sparkSchedulerExtender *extender.SparkSchedulerExtender) error {
+func registerExtenderEndpoints(r wrouter.Router, sparkSchedulerExtender *extender.SparkSchedulerExtender, recorder *extender.SchedulingRecorder, tracer wtracing.Tracer) error {
 	if err := r.Post("/predicates", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		decoder := json.NewDecoder(req.Body)
 		var args schedulerapi.ExtenderArgs
@@ -33,10 +36,100 @@ func registerExtenderEndpoints(r wrouter.Router, sparkSchedulerExtender *extende
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 		} else {
-			rest.WriteJSONResponse(rw, sparkSchedulerExtender.Predicate(req.Context(), args), http.StatusOK)
+			predicate := func() *schedulerapi.ExtenderFilterResult {
+				return sparkSchedulerExtender.Predicate(requestContext(req, tracer), args)
+			}
+			if recorder != nil {
+				rest.WriteJSONResponse(rw, recorder.RecordPredicate(requestContext(req, tracer), args, predicate), http.StatusOK)
+			} else {
+				rest.WriteJSONResponse(rw, predicate(), http.StatusOK)
+			}
+		}
+	})); err != nil {
+		return werror.Wrap(err, "failed to register handler")
+	}
+	if err := r.Post("/prioritize", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		decoder := json.NewDecoder(req.Body)
+		var args schedulerapi.ExtenderArgs
+		err := decoder.Decode(&args)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		} else {
+			prioritize := func() *schedulerapi.HostPriorityList {
+				return sparkSchedulerExtender.Prioritize(requestContext(req, tracer), args)
+			}
+			if recorder != nil {
+				rest.WriteJSONResponse(rw, recorder.RecordPrioritize(requestContext(req, tracer), args, prioritize), http.StatusOK)
+			} else {
+				rest.WriteJSONResponse(rw, prioritize(), http.StatusOK)
+			}
+		}
+	})); err != nil {
+		return werror.Wrap(err, "failed to register handler")
+	}
+	if err := r.Post("/bind", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		decoder := json.NewDecoder(req.Body)
+		var args schedulerapi.ExtenderBindingArgs
+		err := decoder.Decode(&args)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		} else {
+			rest.WriteJSONResponse(rw, sparkSchedulerExtender.Bind(requestContext(req, tracer), args), http.StatusOK)
+		}
+	})); err != nil {
+		return werror.Wrap(err, "failed to register handler")
+	}
+	if err := r.Post("/preempt", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		decoder := json.NewDecoder(req.Body)
+		var args schedulerapi.ExtenderPreemptionArgs
+		err := decoder.Decode(&args)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		} else {
+			rest.WriteJSONResponse(rw, sparkSchedulerExtender.ProcessPreemption(requestContext(req, tracer), args), http.StatusOK)
+		}
+	})); err != nil {
+		return werror.Wrap(err, "failed to register handler")
+	}
+	if err := r.Post("/simulate", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		decoder := json.NewDecoder(req.Body)
+		var request extender.SimulationRequest
+		err := decoder.Decode(&request)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := sparkSchedulerExtender.Simulate(requestContext(req, tracer), request)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+		} else {
+			rest.WriteJSONResponse(rw, result, http.StatusOK)
+		}
+	})); err != nil {
+		return werror.Wrap(err, "failed to register handler")
+	}
+	if err := r.Get("/explain/{namespace}/{pod}", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pathParams := wrouter.PathParams(req)
+		explanation, err := sparkSchedulerExtender.Explain(requestContext(req, tracer), pathParams["namespace"], pathParams["pod"])
+		switch {
+		case apierrors.IsNotFound(err):
+			http.Error(rw, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+		default:
+			rest.WriteJSONResponse(rw, explanation, http.StatusOK)
 		}
 	})); err != nil {
 		return werror.Wrap(err, "failed to register handler")
 	}
 	return nil
 }
+
+// requestContext returns the context of a request to the extender, which exports its spans with the configured tracer,
+// if there is one, as children of the request's span
+func requestContext(req *http.Request, tracer wtracing.Tracer) context.Context {
+	if tracer == nil {
+		return req.Context()
+	}
+	return wtracing.ContextWithTracer(req.Context(), tracer)
+}
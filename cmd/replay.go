@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/simulator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayRecordingFile string
+	replayConfigFile    string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "replays recorded scheduling requests through the extender and reports the decisions that differ",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReplay(cmd)
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayRecordingFile, "recording", "", "file of recorded scheduling requests, optionally gzipped")
+	replayCmd.Flags().StringVar(&replayConfigFile, "config", "", "install configuration of the extender, in the format of the server's install.yml")
+	_ = replayCmd.MarkFlagRequired("recording")
+	rootCmd.AddCommand(replayCmd)
+}
+
+func runReplay(cmd *cobra.Command) error {
+	install, err := readInstallConfig(replayConfigFile)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(replayRecordingFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var recording io.Reader = file
+	// rotated recordings are compressed
+	if strings.HasSuffix(replayRecordingFile, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		recording = gzipReader
+	}
+
+	ctx, cancel := offlineContext()
+	defer cancel()
+	report, err := simulator.Replay(ctx, install, recording)
+	if err != nil {
+		return err
+	}
+	return writeReport(cmd, report)
+}
@@ -16,6 +16,8 @@ package cmd
 
 import (
 	"context"
+	"io"
+	"os"
 	"time"
 
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta1"
@@ -27,14 +29,20 @@ import (
 	"github.com/palantir/k8s-spark-scheduler/internal/conversionwebhook"
 	"github.com/palantir/k8s-spark-scheduler/internal/crd"
 	"github.com/palantir/k8s-spark-scheduler/internal/demands"
+	"github.com/palantir/k8s-spark-scheduler/internal/events"
 	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/leaderelection"
 	"github.com/palantir/k8s-spark-scheduler/internal/metrics"
 	"github.com/palantir/k8s-spark-scheduler/internal/sort"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	pkgmetrics "github.com/palantir/pkg/metrics"
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
 	"github.com/palantir/witchcraft-go-logging/wlog/wapp"
 	"github.com/palantir/witchcraft-go-server/witchcraft"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	"github.com/spf13/cobra"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"k8s.io/client-go/informers"
 	clientcache "k8s.io/client-go/tools/cache"
 )
@@ -70,6 +78,19 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 		instanceGroupLabel = "resource_channel"
 	}
 
+	tracer, tracerCloser, err := tracing.NewTracer(ctx, install.Tracing, install.TraceSampleRate)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("Error constructing tracer", svc1log.Stacktrace(err))
+		return nil, err
+	}
+	if tracer != nil {
+		ctx = wtracing.ContextWithTracer(ctx, tracer)
+		go func() {
+			<-ctx.Done()
+			_ = tracerCloser.Close()
+		}()
+	}
+
 	apiExtensionsClient := allClient.APIExtensionsClient
 	sparkSchedulerClient := allClient.SparkSchedulerClient
 	kubeClient := allClient.KubeClient
@@ -103,6 +124,48 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 	resourceReservationInformer := resourceReservationInformerInterface.Informer()
 	resourceReservationLister := resourceReservationInformerInterface.Lister()
 
+	informersHaveSynced := []clientcache.InformerSynced{nodeInformer.HasSynced, podInformer.HasSynced, resourceReservationInformer.HasSynced}
+	var sparkConfReader *extender.SparkConfReader
+	if install.ReadSparkConf {
+		configMapInformerInterface := kubeInformerFactory.Core().V1().ConfigMaps()
+		informersHaveSynced = append(informersHaveSynced, configMapInformerInterface.Informer().HasSynced)
+		sparkConfReader = extender.NewSparkConfReader(configMapInformerInterface.Lister())
+	}
+	podEvents := events.NewPodEventRecorder(ctx, kubeClient.CoreV1(), install.PodEvents)
+	var sparkApplicationReader *extender.SparkApplicationReader
+	if install.SparkOperatorIntegration {
+		sparkApplicationInformer := crd.NewSparkApplicationInformer(allClient.SparkApplicationClient, time.Second*30)
+		informersHaveSynced = append(informersHaveSynced, sparkApplicationInformer.HasSynced)
+		sparkApplicationReader = extender.NewSparkApplicationReader(sparkApplicationInformer.GetIndexer(), podEvents)
+		go func() {
+			_ = wapp.RunWithFatalLogging(ctx, func(ctx context.Context) error {
+				sparkApplicationInformer.Run(ctx.Done())
+				return nil
+			})
+		}()
+	}
+	var instanceGroupConfigs *extender.InstanceGroupConfigs
+	if install.InstanceGroupConfigs {
+		if err := crd.EnsureInstanceGroupConfigCRD(ctx, apiExtensionsClient); err != nil {
+			svc1log.FromContext(ctx).Error("Error ensuring instance group configs CRD exists: %s", svc1log.Stacktrace(err))
+			return nil, err
+		}
+		instanceGroupConfigInformer := crd.NewInstanceGroupConfigInformer(allClient.InstanceGroupConfigClient, time.Second*30)
+		informersHaveSynced = append(informersHaveSynced, instanceGroupConfigInformer.HasSynced)
+		instanceGroupConfigs = extender.NewInstanceGroupConfigs(
+			instanceGroupConfigInformer.GetIndexer(),
+			instanceGroupLabel,
+			install.DriverPrioritizedNodeLabel,
+			install.ExecutorPrioritizedNodeLabel,
+		)
+		go func() {
+			_ = wapp.RunWithFatalLogging(ctx, func(ctx context.Context) error {
+				instanceGroupConfigInformer.Run(ctx.Done())
+				return nil
+			})
+		}()
+	}
+
 	go func() {
 		_ = wapp.RunWithFatalLogging(ctx, func(ctx context.Context) error {
 			kubeInformerFactory.Start(ctx.Done())
@@ -117,11 +180,7 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 		})
 	}()
 
-	if ok := clientcache.WaitForCacheSync(
-		ctx.Done(),
-		nodeInformer.HasSynced,
-		podInformer.HasSynced,
-		resourceReservationInformer.HasSynced); !ok {
+	if ok := clientcache.WaitForCacheSync(ctx.Done(), informersHaveSynced...); !ok {
 		svc1log.FromContext(ctx).Error("Error waiting for cache to sync")
 		return nil, werror.ErrorWithContextParams(ctx, "could not sync")
 	}
@@ -142,7 +201,19 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 		sparkSchedulerInformerFactory,
 		apiExtensionsClient,
 	)
-	binpacker := binpacker.SelectBinpacker(install.BinpackAlgo)
+	var binpackerOverride binpacker.Override
+	if instanceGroupConfigs != nil {
+		binpackerOverride = instanceGroupConfigs.Binpacker
+	}
+	binpackers, err := binpacker.NewInstanceGroupBinpackers(
+		install.BinpackAlgo,
+		install.BinpackAlgoByInstanceGroup,
+		install.AllowedBinpackStrategies,
+		binpackerOverride)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("Error parsing binpack configuration", svc1log.Stacktrace(err))
+		return nil, err
+	}
 	demandCache := cache.NewSafeDemandCache(
 		lazyDemandInformer,
 		sparkSchedulerClient.ScalerV1alpha2(),
@@ -150,14 +221,15 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 	)
 	demandManager := demands.NewDefaultManager(
 		demandCache,
-		binpacker,
-		instanceGroupLabel)
+		binpackers,
+		instanceGroupLabel,
+		podEvents)
 	extender.StartDemandGC(ctx, podInformerInterface, demandManager)
 
 	softReservationStore := cache.NewSoftReservationStore(ctx, podInformerInterface)
 
-	sparkPodLister := extender.NewSparkPodLister(podLister, instanceGroupLabel)
-	resourceReservationManager := extender.NewResourceReservationManager(ctx, resourceReservationCache, softReservationStore, sparkPodLister, podInformerInterface)
+	sparkPodLister := extender.NewSparkPodLister(podLister, instanceGroupLabel, sparkConfReader, sparkApplicationReader)
+	resourceReservationManager := extender.NewResourceReservationManager(ctx, resourceReservationCache, softReservationStore, sparkPodLister, podInformerInterface, install.PersistSoftReservations)
 
 	overheadComputer := extender.NewOverheadComputer(
 		ctx,
@@ -168,6 +240,17 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 
 	wasteMetricsReporter := metrics.NewWasteMetricsReporter(ctx, instanceGroupLabel)
 
+	queueQuotas, err := extender.NewQueueQuotas(install.QueuesConfig)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("Error parsing queues configuration", svc1log.Stacktrace(err))
+		return nil, err
+	}
+
+	if err := extender.ValidateDriverOrderingConfig(install.DriverOrderingConfig); err != nil {
+		svc1log.FromContext(ctx).Error("Error parsing driver ordering configuration", svc1log.Stacktrace(err))
+		return nil, err
+	}
+
 	sparkSchedulerExtender := extender.NewExtender(
 		nodeLister,
 		sparkPodLister,
@@ -179,7 +262,8 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 		apiExtensionsClient,
 		install.FIFO,
 		install.FifoConfig,
-		binpacker,
+		install.DriverOrderingConfig,
+		binpackers,
 		install.ShouldScheduleDynamicallyAllocatedExecutorsInSameAZ,
 		overheadComputer,
 		instanceGroupLabel,
@@ -188,7 +272,14 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 			install.ExecutorPrioritizedNodeLabel,
 		),
 		wasteMetricsReporter,
+		install.UseExtenderAsScorer,
+		install.EnablePreemption,
+		install.LeaderElection.Enabled,
+		queueQuotas,
+		instanceGroupConfigs,
+		podEvents,
 	)
+	sparkSchedulerExtender.StartIncrementalReconciliation(ctx, podInformerInterface, resourceReservationInformerInterface)
 
 	resourceReporter := metrics.NewResourceReporter(
 		nodeLister,
@@ -211,11 +302,12 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 
 	unschedulablePodMarker := extender.NewUnschedulablePodMarker(
 		nodeLister,
-		podLister,
+		sparkPodLister,
 		kubeClient.CoreV1(),
 		overheadComputer,
-		binpacker,
+		sparkSchedulerExtender,
 		install.UnschedulablePodTimeoutDuration,
+		podEvents,
 	)
 
 	resourceReservationCache.Run(ctx)
@@ -228,14 +320,64 @@ func InitServerWithClients(ctx context.Context, info witchcraft.InitInfo, allCli
 	go resourceReservationReporter.StartReporting(ctx)
 	go softReservationReporter.StartReporting(ctx)
 	go unschedulablePodMarker.Start(ctx)
+	go extender.NewQueuePositionMarker(sparkSchedulerExtender, kubeClient.CoreV1()).Start(ctx)
+	if install.LeaderElection.Enabled {
+		identity, err := os.Hostname()
+		if err != nil {
+			return nil, werror.Wrap(err, "failed to get the hostname to identify the replica in leader election")
+		}
+		elector, err := leaderelection.NewElector(kubeClient.CoordinationV1(), install.LeaderElection, identity, leaderelection.Callbacks{
+			OnStartedLeading: sparkSchedulerExtender.StartLeading,
+			OnStoppedLeading: sparkSchedulerExtender.StopLeading,
+		})
+		if err != nil {
+			svc1log.FromContext(ctx).Error("Error constructing leader elector", svc1log.Stacktrace(err))
+			return nil, err
+		}
+		go elector.Run(ctx)
+	}
 
-	if err := registerExtenderEndpoints(info.Router, sparkSchedulerExtender); err != nil {
+	var schedulingRecorder *extender.SchedulingRecorder
+	if install.SchedulingRecorder.Path != "" {
+		schedulingRecorder = extender.NewSchedulingRecorder(
+			newRecordingWriter(install.SchedulingRecorder),
+			nodeLister,
+			podLister,
+			resourceReservationCache,
+			softReservationStore,
+		)
+	}
+
+	if err := registerExtenderEndpoints(info.Router, sparkSchedulerExtender, schedulingRecorder, tracer); err != nil {
 		return nil, err
 	}
+	if install.EnablePrometheusMetrics {
+		if err := info.Router.Get("/metrics", metrics.NewPrometheusHandler(pkgmetrics.FromContext(ctx))); err != nil {
+			return nil, werror.Wrap(err, "failed to register handler")
+		}
+	}
 
 	return sparkSchedulerExtender, nil
 }
 
+// newRecordingWriter returns a writer to the recording file, which is rotated and compressed once it reaches its max size
+func newRecordingWriter(recorderConfig config.SchedulingRecorderConfig) io.Writer {
+	maxSizeMB := recorderConfig.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	maxBackups := recorderConfig.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = 3
+	}
+	return &lumberjack.Logger{
+		Filename:   recorderConfig.Path,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+		Compress:   true,
+	}
+}
+
 // New creates and returns a witchcraft Server.
 func New() *witchcraft.Server {
 	return witchcraft.NewServer().
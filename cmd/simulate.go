@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/simulator"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog"
+	"github.com/palantir/witchcraft-go-logging/wlog/evtlog/evt2log"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+var (
+	simulateTraceFile   string
+	simulateConfigFile  string
+	simulateBinpackAlgo string
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "replays a trace of spark applications on a simulated cluster and reports how they were scheduled",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSimulation(cmd)
+	},
+}
+
+func init() {
+	simulateCmd.Flags().StringVar(&simulateTraceFile, "trace", "", "YAML or JSON file describing the nodes and the applications to simulate")
+	simulateCmd.Flags().StringVar(&simulateConfigFile, "config", "", "install configuration of the extender, in the format of the server's install.yml")
+	simulateCmd.Flags().StringVar(&simulateBinpackAlgo, "binpack", "", "binpack algorithm to use, overriding the one of the install configuration")
+	_ = simulateCmd.MarkFlagRequired("trace")
+	rootCmd.AddCommand(simulateCmd)
+}
+
+func runSimulation(cmd *cobra.Command) error {
+	install, err := readInstallConfig(simulateConfigFile)
+	if err != nil {
+		return err
+	}
+	if simulateBinpackAlgo != "" {
+		install.BinpackAlgo = simulateBinpackAlgo
+		install.BinpackAlgoByInstanceGroup = nil
+	}
+
+	content, err := ioutil.ReadFile(simulateTraceFile)
+	if err != nil {
+		return err
+	}
+	var trace simulator.Trace
+	if err := k8syaml.UnmarshalStrict(content, &trace); err != nil {
+		return werror.Wrap(err, "failed to parse trace")
+	}
+
+	ctx, cancel := offlineContext()
+	defer cancel()
+	report, err := simulator.Run(ctx, install, trace)
+	if err != nil {
+		return err
+	}
+	return writeReport(cmd, report)
+}
+
+// readInstallConfig reads an install configuration in the format of the server's install.yml, and returns the default
+// configuration if no path is given
+func readInstallConfig(path string) (config.Install, error) {
+	install := config.Install{}
+	if path == "" {
+		return install, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return install, err
+	}
+	if err := yaml.Unmarshal(content, &install); err != nil {
+		return install, werror.Wrap(err, "failed to parse install configuration")
+	}
+	return install, nil
+}
+
+// offlineContext returns the context extenders run offline with. Reports are written to stdout, so only warnings of the
+// extender are logged, to stderr.
+func offlineContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = svc1log.WithLogger(ctx, svc1log.New(os.Stderr, wlog.WarnLevel))
+	ctx = evt2log.WithLogger(ctx, evt2log.New(ioutil.Discard))
+	return ctx, cancel
+}
+
+func writeReport(cmd *cobra.Command, report interface{}) error {
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
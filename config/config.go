@@ -30,6 +30,8 @@ type Install struct {
 	QPS                                                 float32           `yaml:"qps,omitempty"`
 	Burst                                               int               `yaml:"burst,omitempty"`
 	BinpackAlgo                                         string            `yaml:"binpack,omitempty"`
+	BinpackAlgoByInstanceGroup                          map[string]string `yaml:"binpack-by-instance-group,omitempty"`
+	AllowedBinpackStrategies                            []string          `yaml:"allowed-binpack-strategies,omitempty"`
 	ShouldScheduleDynamicallyAllocatedExecutorsInSameAZ bool              `yaml:"should-schedule-dynamically-allocated-executors-in-same-az,omitempty"`
 	InstanceGroupLabel                                  string            `yaml:"instance-group-label,omitempty"`
 	AsyncClientConfig                                   AsyncClientConfig `yaml:"async-client-config,omitempty"`
@@ -43,6 +45,50 @@ type Install struct {
 
 	ResourceReservationCRDAnnotations map[string]string `yaml:"resource-reservation-crd-annotations,omitempty"`
 
+	// UseExtenderAsScorer makes the predicates verb return every node a driver fits on rather than a single node, so that
+	// the final choice is left to the scores of the prioritize verb and the rest of the scheduler
+	UseExtenderAsScorer bool `yaml:"use-extender-as-scorer,omitempty"`
+
+	// EnablePreemption allows drivers which do not fit to preempt whole applications of a lower priority
+	EnablePreemption bool `yaml:"enable-preemption,omitempty"`
+
+	// PersistSoftReservations writes the soft reservations of dynamic allocation applications to their resource
+	// reservations, so that a new leader restores them instead of rebuilding them from the running executors
+	PersistSoftReservations bool `yaml:"persist-soft-reservations,omitempty"`
+
+	// LeaderElection elects the active replica of the extender through a Lease, instead of assuming that the replica
+	// called by the kube-scheduler leader is the active one
+	LeaderElection LeaderElectionConfig `yaml:"leader-election,omitempty"`
+
+	QueuesConfig QueuesConfig `yaml:"queues-config,omitempty"`
+
+	DriverOrderingConfig DriverOrderingConfig `yaml:"driver-ordering-config,omitempty"`
+
+	// ReadSparkConf derives the resources of applications from the spark configuration of their drivers, for the
+	// values their annotations do not set
+	ReadSparkConf bool `yaml:"read-spark-conf,omitempty"`
+
+	// SparkOperatorIntegration derives the resources of applications submitted through the spark-operator from their
+	// SparkApplication, and records the scheduling failures of their drivers as events on it
+	SparkOperatorIntegration bool `yaml:"spark-operator-integration,omitempty"`
+
+	// InstanceGroupConfigs watches the cluster scoped InstanceGroupConfig resources, which override the binpacking,
+	// FIFO, node priority, overcommit and queue settings of the instance group they are named after
+	InstanceGroupConfigs bool `yaml:"instance-group-configs,omitempty"`
+
+	// SchedulingRecorder records the predicates and prioritize requests the extender receives, along with the cluster
+	// state they are decided on, so that they can be replayed
+	SchedulingRecorder SchedulingRecorderConfig `yaml:"scheduling-recorder,omitempty"`
+
+	// EnablePrometheusMetrics exposes the metrics of the extender in the prometheus text format on the metrics endpoint
+	EnablePrometheusMetrics bool `yaml:"enable-prometheus-metrics,omitempty"`
+
+	// Tracing configures exporters for the spans of the scheduling path, which go to the trace log of the server by default
+	Tracing TracingConfig `yaml:"tracing,omitempty"`
+
+	// PodEvents rate limits the kubernetes events published on driver and executor pods for their scheduling outcomes
+	PodEvents PodEventsConfig `yaml:"pod-events,omitempty"`
+
 	WebhookServiceConfig `yaml:"webhook-service-config"`
 }
 
@@ -54,6 +100,48 @@ type WebhookServiceConfig struct {
 	ServicePort int32  `yaml:"service-port"`
 }
 
+// SchedulingRecorderConfig configures the file scheduling requests are recorded to, recording is turned off when Path is empty
+type SchedulingRecorderConfig struct {
+	Path string `yaml:"path,omitempty"`
+	// MaxSizeMB is the size in megabytes the file is rotated at (Default is 100)
+	MaxSizeMB int `yaml:"max-size-mb,omitempty"`
+	// MaxBackups is the number of compressed rotated files kept (Default is 3)
+	MaxBackups int `yaml:"max-backups,omitempty"`
+}
+
+// PodEventsConfig configures the rate limit of the kubernetes events published on pods
+type PodEventsConfig struct {
+	// QPS is the sustained rate events are published at (Default is 5)
+	QPS float32 `yaml:"qps,omitempty"`
+	// Burst is the number of events that can be published at once (Default is 25)
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// LeaderElectionConfig configures the Lease replicas of the extender compete for, leader election is turned off unless
+// Enabled is set
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// LeaseName is the name of the Lease (Default is spark-scheduler-extender)
+	LeaseName string `yaml:"lease-name,omitempty"`
+	// LeaseNamespace is the namespace of the Lease (Default is the namespace of the extender's service account)
+	LeaseNamespace string `yaml:"lease-namespace,omitempty"`
+	// LeaseDuration is how long standbys wait after the last renewal before taking over (Default is 15s)
+	LeaseDuration time.Duration `yaml:"lease-duration,omitempty"`
+	// RenewDeadline is how long the leader keeps retrying to renew the Lease before giving up leadership (Default is 10s)
+	RenewDeadline time.Duration `yaml:"renew-deadline,omitempty"`
+	// RetryPeriod is the interval of attempts to acquire or renew the Lease (Default is 2s)
+	RetryPeriod time.Duration `yaml:"retry-period,omitempty"`
+}
+
+// TracingConfig configures where spans are exported to, spans are sampled at the rate of trace-sample-rate
+type TracingConfig struct {
+	// OTLPEndpoint is the traces endpoint of an OpenTelemetry collector accepting OTLP over HTTP, such as
+	// http://localhost:4318/v1/traces
+	OTLPEndpoint string `yaml:"otlp-endpoint,omitempty"`
+	// File is the path of a file spans are written to in the trace log format, rotated at 100MB
+	File string `yaml:"file,omitempty"`
+}
+
 // FifoConfig enables the fine-tuning of FIFO enforcement
 type FifoConfig struct {
 	// DefaultEnforceAfterPodAge specifies the time since the pod was created after which a driver which does not fit starts blocking the remaining drivers
@@ -63,6 +151,44 @@ type FifoConfig struct {
 	EnforceAfterPodAgeByInstanceGroup map[string]time.Duration `yaml:"enforce-after-pod-age-by-instance-group,omitempty"`
 }
 
+// DriverOrderingConfig selects the policy deciding which pending drivers have to fit to the cluster before a driver
+// can be scheduled when FIFO is enabled
+type DriverOrderingConfig struct {
+	// DefaultPolicy is either fifo, which orders drivers by creation time, or fair-share, which orders drivers by the
+	// dominant resource share of their tenant. (Default is fifo)
+	DefaultPolicy string `yaml:"default-policy,omitempty"`
+	// PolicyByInstanceGroup allows customizing the ordering policy by instance group
+	PolicyByInstanceGroup map[string]string `yaml:"policy-by-instance-group,omitempty"`
+	// TenantLabel is the driver pod label naming its tenant for fair-share ordering, the driver's namespace is used as
+	// its tenant when the label is not set
+	TenantLabel string `yaml:"tenant-label,omitempty"`
+}
+
+// QueuesConfig configures the named queues drivers are assigned to, and the resource quotas of each queue
+type QueuesConfig struct {
+	// QueueLabel is the driver pod label naming its queue, the driver's namespace is used as its queue name when the label is not set
+	QueueLabel string `yaml:"queue-label,omitempty"`
+	// Queues is the set of queues by name, drivers which are not assigned to any of these queues are not subject to quotas
+	Queues map[string]QueueConfig `yaml:"queues,omitempty"`
+}
+
+// QueueConfig is the configuration of a single queue. The usage of a queue counts towards the quotas of its parent.
+type QueueConfig struct {
+	Parent string `yaml:"parent,omitempty"`
+	// Guaranteed is the amount of resources the queue is entitled to. Drivers of a queue under its guarantee are not
+	// blocked by earlier drivers of queues that would go over their own guarantee.
+	Guaranteed QueueResources `yaml:"guaranteed,omitempty"`
+	// Max is the amount of resources the queue can never exceed
+	Max QueueResources `yaml:"max,omitempty"`
+}
+
+// QueueResources is a set of resource quantities. Unset quantities are unlimited for max quotas, and zero for guaranteed quotas.
+type QueueResources struct {
+	CPU       string `yaml:"cpu,omitempty"`
+	Memory    string `yaml:"memory,omitempty"`
+	NvidiaGPU string `yaml:"nvidia.com/gpu,omitempty"`
+}
+
 // AsyncClientConfig is the configuration for the internal async client
 type AsyncClientConfig struct {
 	maxRetryCount *int `yaml:"max-retry-count,omitempty"`
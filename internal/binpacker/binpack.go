@@ -15,7 +15,11 @@
 package binpacker
 
 import (
+	"context"
+	"sync"
+
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
+	werror "github.com/palantir/witchcraft-go-error"
 )
 
 const (
@@ -38,21 +42,119 @@ type Binpacker struct {
 	Name        string
 	BinpackFunc binpack.SparkBinPackFunction
 	IsSingleAz  bool
+	// MinimalFragmentationReschedule reschedules executors on the nodes already running executors of the same
+	// application when possible, instead of on the first node with enough capacity
+	MinimalFragmentationReschedule bool
 }
 
-var binpackFunctions = map[string]*Binpacker{
-	tightlyPack:                  {tightlyPack, binpack.TightlyPack, false},
-	distributeEvenly:             {distributeEvenly, binpack.DistributeEvenly, false},
-	azAwareTightlyPack:           {azAwareTightlyPack, binpack.AzAwareTightlyPack, false},
-	SingleAzTightlyPack:          {SingleAzTightlyPack, binpack.SingleAZTightlyPack, true},
-	SingleAzMinimalFragmentation: {SingleAzMinimalFragmentation, binpack.SingleAZMinimalFragmentation, true},
+var (
+	binpackFunctionsLock sync.RWMutex
+	binpackFunctions     = map[string]*Binpacker{
+		tightlyPack:                  {Name: tightlyPack, BinpackFunc: binpack.TightlyPack},
+		distributeEvenly:             {Name: distributeEvenly, BinpackFunc: binpack.DistributeEvenly},
+		azAwareTightlyPack:           {Name: azAwareTightlyPack, BinpackFunc: binpack.AzAwareTightlyPack},
+		SingleAzTightlyPack:          {Name: SingleAzTightlyPack, BinpackFunc: binpack.SingleAZTightlyPack, IsSingleAz: true},
+		SingleAzMinimalFragmentation: {Name: SingleAzMinimalFragmentation, BinpackFunc: binpack.SingleAZMinimalFragmentation, IsSingleAz: true, MinimalFragmentationReschedule: true},
+	}
+)
+
+// Register adds a binpacker, so that it can be selected by name in the configuration and by applications like the
+// built-in ones. It fails if the name is empty or already registered, or if the binpack function is nil.
+func Register(binpacker Binpacker) error {
+	if binpacker.Name == "" {
+		return werror.Error("binpacker name can not be empty")
+	}
+	if binpacker.BinpackFunc == nil {
+		return werror.Error("binpack function can not be nil", werror.SafeParam("binpack", binpacker.Name))
+	}
+	binpackFunctionsLock.Lock()
+	defer binpackFunctionsLock.Unlock()
+	if _, ok := binpackFunctions[binpacker.Name]; ok {
+		return werror.Error("binpacker is already registered", werror.SafeParam("binpack", binpacker.Name))
+	}
+	binpackFunctions[binpacker.Name] = &binpacker
+	return nil
 }
 
 // SelectBinpacker selects the binpack function from the given name
 func SelectBinpacker(name string) *Binpacker {
-	binpacker, ok := binpackFunctions[name]
+	binpacker, ok := LookupBinpacker(name)
 	if !ok {
-		return binpackFunctions[distributeEvenly]
+		binpacker, _ = LookupBinpacker(distributeEvenly)
 	}
 	return binpacker
 }
+
+// LookupBinpacker returns the binpacker of the given name, if it is registered
+func LookupBinpacker(name string) (*Binpacker, bool) {
+	binpackFunctionsLock.RLock()
+	defer binpackFunctionsLock.RUnlock()
+	binpacker, ok := binpackFunctions[name]
+	return binpacker, ok
+}
+
+// Override returns the binpacker an instance group is configured with at runtime, if any
+type Override func(ctx context.Context, instanceGroup string) (*Binpacker, bool)
+
+// InstanceGroupBinpackers resolves the binpacker of each instance group, falling back to a default binpacker, and the
+// strategies applications are allowed to select instead
+type InstanceGroupBinpackers struct {
+	defaultBinpacker  *Binpacker
+	byInstanceGroup   map[string]*Binpacker
+	allowedStrategies map[string]*Binpacker
+	override          Override
+}
+
+// NewInstanceGroupBinpackers creates an InstanceGroupBinpackers from the default binpack algorithm, the algorithms of
+// specific instance groups and the strategies applications may select. An unknown default falls back to
+// distribute-evenly, as SelectBinpacker does, while other unknown algorithms are rejected. The override, if not nil,
+// takes precedence over the algorithms of instance groups.
+func NewInstanceGroupBinpackers(
+	defaultName string,
+	nameByInstanceGroup map[string]string,
+	allowedStrategies []string,
+	override Override) (*InstanceGroupBinpackers, error) {
+	byInstanceGroup := make(map[string]*Binpacker, len(nameByInstanceGroup))
+	for instanceGroup, name := range nameByInstanceGroup {
+		binpacker, ok := LookupBinpacker(name)
+		if !ok {
+			return nil, werror.Error("unknown binpack algorithm",
+				werror.SafeParam("instanceGroup", instanceGroup),
+				werror.SafeParam("binpack", name))
+		}
+		byInstanceGroup[instanceGroup] = binpacker
+	}
+	allowed := make(map[string]*Binpacker, len(allowedStrategies))
+	for _, name := range allowedStrategies {
+		binpacker, ok := LookupBinpacker(name)
+		if !ok {
+			return nil, werror.Error("unknown binpack strategy", werror.SafeParam("binpack", name))
+		}
+		allowed[name] = binpacker
+	}
+	return &InstanceGroupBinpackers{
+		defaultBinpacker:  SelectBinpacker(defaultName),
+		byInstanceGroup:   byInstanceGroup,
+		allowedStrategies: allowed,
+		override:          override,
+	}, nil
+}
+
+// ForInstanceGroup returns the binpacker of the given instance group
+func (b *InstanceGroupBinpackers) ForInstanceGroup(ctx context.Context, instanceGroup string) *Binpacker {
+	if b.override != nil {
+		if binpacker, ok := b.override(ctx, instanceGroup); ok {
+			return binpacker
+		}
+	}
+	if binpacker, ok := b.byInstanceGroup[instanceGroup]; ok {
+		return binpacker
+	}
+	return b.defaultBinpacker
+}
+
+// AllowedStrategy returns the binpacker of the given strategy, if applications are allowed to select it
+func (b *InstanceGroupBinpackers) AllowedStrategy(name string) (*Binpacker, bool) {
+	binpacker, ok := b.allowedStrategies[name]
+	return binpacker, ok
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binpacker
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+	v1 "k8s.io/api/core/v1"
+)
+
+// BinpackApplication binpacks the driver and minimum executors of an application like BinpackFunc, and additionally
+// keeps the extended resources of the pods placed on every node within availableExtendedResources. The wrapped
+// binpack functions only account for cpu, memory and nvidia gpus, so the resources they see on each node are limited
+// to what the executors fitting into the node's extended resources need, and the limits are tightened and the
+// application packed again while the driver and executors sharing a node would overcommit it.
+func (b *Binpacker) BinpackApplication(
+	ctx context.Context,
+	applicationResources *types.SparkApplicationResources,
+	driverNodePriorityOrder, executorNodePriorityOrder []string,
+	nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) *binpack.PackingResult {
+	span, ctx := tracing.StartSpan(ctx, "binpack",
+		wtracing.WithSpanTag("binpacker", b.Name),
+		wtracing.WithSpanTag("spark.executor.min.count", strconv.Itoa(applicationResources.MinExecutorCount)))
+	defer span.Finish()
+	packingResult := b.binpackApplication(ctx, applicationResources, driverNodePriorityOrder, executorNodePriorityOrder, nodesSchedulingMetadata, availableExtendedResources)
+	span.Tag("has.capacity", strconv.FormatBool(packingResult.HasCapacity))
+	return packingResult
+}
+
+func (b *Binpacker) binpackApplication(
+	ctx context.Context,
+	applicationResources *types.SparkApplicationResources,
+	driverNodePriorityOrder, executorNodePriorityOrder []string,
+	nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) *binpack.PackingResult {
+	if len(applicationResources.DriverExtendedResources) == 0 && len(applicationResources.ExecutorExtendedResources) == 0 {
+		return b.binpack(ctx, applicationResources, driverNodePriorityOrder, executorNodePriorityOrder, nodesSchedulingMetadata)
+	}
+	driverNodes := filterNodes(driverNodePriorityOrder, func(node string) bool {
+		return availableExtendedResources.Fits(node, applicationResources.DriverExtendedResources)
+	})
+	executorNodes := filterNodes(executorNodePriorityOrder, func(node string) bool {
+		return availableExtendedResources.Fits(node, applicationResources.ExecutorExtendedResources)
+	})
+	limits := make(map[string]*resources.Resources, len(executorNodes))
+	for _, node := range executorNodes {
+		count, ok := executorCapacity(availableExtendedResources[node], applicationResources.ExecutorExtendedResources)
+		if !ok {
+			continue
+		}
+		limit := applicationResources.DriverResources.Copy()
+		for i := int64(0); i < count; i++ {
+			limit.Add(applicationResources.ExecutorResources)
+		}
+		limits[node] = limit
+	}
+	for {
+		packingResult := b.binpack(ctx, applicationResources, driverNodes, executorNodes, limitedSchedulingMetadata(nodesSchedulingMetadata, limits))
+		if !packingResult.HasCapacity {
+			return packingResult
+		}
+		overcommitted := false
+		for node, usage := range ExtendedResourceUsage(applicationResources, packingResult.DriverNode, packingResult.ExecutorNodes) {
+			if availableExtendedResources.Fits(node, usage) {
+				continue
+			}
+			if applicationResources.ExecutorResources.Eq(resources.Zero()) {
+				// executors without resources can not be kept off a node by limiting its resources
+				return binpack.EmptyPackingResult()
+			}
+			// leave room for one less executor than was packed onto the node
+			limit := applicationResourceUsage(applicationResources, packingResult.DriverNode, packingResult.ExecutorNodes)[node]
+			limit.Sub(applicationResources.ExecutorResources)
+			limits[node] = limit
+			overcommitted = true
+		}
+		if !overcommitted {
+			return packingResult
+		}
+	}
+}
+
+// ExtendedResourceUsage returns the extended resources used per node by an application with the given placement
+func ExtendedResourceUsage(applicationResources *types.SparkApplicationResources, driverNode string, executorNodes []string) types.NodeGroupExtendedResources {
+	res := types.NodeGroupExtendedResources{}
+	res.Add(types.NodeGroupExtendedResources{driverNode: applicationResources.DriverExtendedResources})
+	for _, n := range executorNodes {
+		res.Add(types.NodeGroupExtendedResources{n: applicationResources.ExecutorExtendedResources})
+	}
+	return res
+}
+
+func (b *Binpacker) binpack(
+	ctx context.Context,
+	applicationResources *types.SparkApplicationResources,
+	driverNodePriorityOrder, executorNodePriorityOrder []string,
+	nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) *binpack.PackingResult {
+	return b.BinpackFunc(
+		ctx,
+		applicationResources.DriverResources,
+		applicationResources.ExecutorResources,
+		applicationResources.MinExecutorCount,
+		driverNodePriorityOrder,
+		executorNodePriorityOrder,
+		nodesSchedulingMetadata)
+}
+
+func filterNodes(nodeNames []string, predicate func(string) bool) []string {
+	filtered := make([]string, 0, len(nodeNames))
+	for _, n := range nodeNames {
+		if predicate(n) {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered
+}
+
+// executorCapacity returns how many executors requesting executorExtendedResources fit into available, or false if
+// the executors do not request any extended resources
+func executorCapacity(available, executorExtendedResources v1.ResourceList) (int64, bool) {
+	var capacity int64
+	limited := false
+	for name, requested := range executorExtendedResources {
+		if requested.Sign() <= 0 {
+			continue
+		}
+		availableQuantity := available[name]
+		count := availableQuantity.MilliValue() / requested.MilliValue()
+		if !limited || count < capacity {
+			capacity = count
+			limited = true
+		}
+	}
+	return capacity, limited
+}
+
+// limitedSchedulingMetadata returns a copy of nodesSchedulingMetadata where the available resources of a node are
+// at most its limit
+func limitedSchedulingMetadata(
+	nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	limits map[string]*resources.Resources) resources.NodeGroupSchedulingMetadata {
+	limited := make(resources.NodeGroupSchedulingMetadata, len(nodesSchedulingMetadata))
+	for node, nodeSchedulingMetadata := range nodesSchedulingMetadata {
+		limit, ok := limits[node]
+		if !ok {
+			limited[node] = nodeSchedulingMetadata
+			continue
+		}
+		nodeCopy := *nodeSchedulingMetadata
+		available := nodeSchedulingMetadata.AvailableResources.Copy()
+		if available.CPU.Cmp(limit.CPU) > 0 {
+			available.CPU = limit.CPU.DeepCopy()
+		}
+		if available.Memory.Cmp(limit.Memory) > 0 {
+			available.Memory = limit.Memory.DeepCopy()
+		}
+		if available.NvidiaGPU.Cmp(limit.NvidiaGPU) > 0 {
+			available.NvidiaGPU = limit.NvidiaGPU.DeepCopy()
+		}
+		nodeCopy.AvailableResources = available
+		limited[node] = &nodeCopy
+	}
+	return limited
+}
+
+// applicationResourceUsage returns the cpu, memory and nvidia gpus used per node by an application with the given placement
+func applicationResourceUsage(applicationResources *types.SparkApplicationResources, driverNode string, executorNodes []string) resources.NodeGroupResources {
+	res := resources.NodeGroupResources{}
+	res.Add(resources.NodeGroupResources{driverNode: applicationResources.DriverResources})
+	for _, n := range executorNodes {
+		res.Add(resources.NodeGroupResources{n: applicationResources.ExecutorResources})
+	}
+	return res
+}
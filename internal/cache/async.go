@@ -17,11 +17,14 @@ package cache
 import (
 	"context"
 	"regexp"
+	"strconv"
 
 	"github.com/palantir/k8s-spark-scheduler/config"
 	"github.com/palantir/k8s-spark-scheduler/internal/cache/store"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
 	"github.com/palantir/pkg/metrics"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -55,6 +58,15 @@ func (ac *asyncClient) Run(ctx context.Context) {
 	}
 }
 
+// dropQueued drops the requests that have not been picked up by a worker yet
+func (ac *asyncClient) dropQueued(ctx context.Context) int {
+	dropped := ac.queue.DropAll()
+	for _, r := range dropped {
+		ac.metrics.MarkDroppedOnLostLeadership(ctx, r.Type)
+	}
+	return len(dropped)
+}
+
 func (ac *asyncClient) runWorker(ctx context.Context, requests <-chan func() store.Request) {
 	for {
 		select {
@@ -64,16 +76,33 @@ func (ac *asyncClient) runWorker(ctx context.Context, requests <-chan func() sto
 			r := requestGetter()
 			switch r.Type {
 			case store.CreateRequestType:
-				ac.doCreate(requestCtx(ctx, r.Key, "create"), r)
+				ac.traced(requestCtx(ctx, r.Key, "create"), r, "create", ac.doCreate)
 			case store.UpdateRequestType:
-				ac.doUpdate(requestCtx(ctx, r.Key, "update"), r)
+				ac.traced(requestCtx(ctx, r.Key, "update"), r, "update", ac.doUpdate)
 			case store.DeleteRequestType:
-				ac.doDelete(requestCtx(ctx, r.Key, "delete"), r)
+				ac.traced(requestCtx(ctx, r.Key, "delete"), r, "delete", ac.doDelete)
 			}
 		}
 	}
 }
 
+// traced runs the request within a span, which is a child of the span that issued the request
+func (ac *asyncClient) traced(ctx context.Context, r store.Request, requestType string, do func(context.Context, store.Request)) {
+	options := []wtracing.SpanOption{
+		wtracing.WithKind(wtracing.Client),
+		wtracing.WithSpanTag("k8s.namespace.name", r.Key.Namespace),
+		wtracing.WithSpanTag("k8s.object.name", r.Key.Name),
+		wtracing.WithSpanTag("k8s.object.type", ac.metrics.ObjectTypeTag),
+		wtracing.WithSpanTag("retry.count", strconv.Itoa(r.RetryCount)),
+	}
+	if r.ParentSpan != nil {
+		options = append(options, wtracing.WithParentSpanContext(*r.ParentSpan))
+	}
+	span, ctx := tracing.StartSpan(ctx, "async-client."+requestType, options...)
+	defer span.Finish()
+	do(ctx, r)
+}
+
 func (ac *asyncClient) doCreate(ctx context.Context, r store.Request) {
 	obj, ok := ac.objectStore.Get(r.Key)
 	if !ok {
@@ -137,6 +166,7 @@ func (ac *asyncClient) doDelete(ctx context.Context, r store.Request) {
 }
 
 func (ac *asyncClient) maybeRetryRequest(ctx context.Context, r store.Request, err error) bool {
+	tracing.TagError(wtracing.SpanFromContext(ctx), err)
 	if r.RetryCount >= ac.config.MaxRetryCount() {
 		svc1log.FromContext(ctx).Error("max retry count reached, dropping request", svc1log.Stacktrace(err))
 		ac.metrics.MarkMaxRetries(ctx, r.Type)
@@ -171,8 +201,9 @@ const (
 )
 
 var (
-	enqueueFailedTag = metrics.MustNewTag("dropReason", "queueIsFull")
-	maxRetriesTag    = metrics.MustNewTag("dropReason", "maxRetries")
+	enqueueFailedTag  = metrics.MustNewTag("dropReason", "queueIsFull")
+	maxRetriesTag     = metrics.MustNewTag("dropReason", "maxRetries")
+	lostLeadershipTag = metrics.MustNewTag("dropReason", "lostLeadership")
 )
 
 // AsyncClientMetrics emits metrics on retries and failures of the internal async client calls to the api server
@@ -201,6 +232,11 @@ func (acm *AsyncClientMetrics) MarkFailedToEnqueue(ctx context.Context, requestT
 	acm.markRequestDropped(ctx, requestType, enqueueFailedTag)
 }
 
+// MarkDroppedOnLostLeadership marks that a queued request is not going to be made because this replica stopped leading
+func (acm *AsyncClientMetrics) MarkDroppedOnLostLeadership(ctx context.Context, requestType store.RequestType) {
+	acm.markRequestDropped(ctx, requestType, lostLeadershipTag)
+}
+
 func (acm *AsyncClientMetrics) markRequestDropped(
 	ctx context.Context, requestType store.RequestType, reason metrics.Tag) {
 	metrics.FromContext(ctx).Counter(
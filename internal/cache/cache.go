@@ -20,6 +20,7 @@ import (
 	"github.com/palantir/k8s-spark-scheduler/internal/cache/store"
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientcache "k8s.io/client-go/tools/cache"
 )
@@ -55,12 +56,12 @@ func newCache(
 	return c
 }
 
-func (c *cache) Create(obj metav1.Object) error {
+func (c *cache) Create(ctx context.Context, obj metav1.Object) error {
 	created := c.store.PutIfAbsent(obj)
 	if !created {
 		return werror.Error("object already exists")
 	}
-	c.queue.AddIfAbsent(store.CreateRequest(obj))
+	c.queue.AddIfAbsent(store.CreateRequest(obj).WithParentSpan(wtracing.SpanFromContext(ctx)))
 	return nil
 }
 
@@ -68,26 +69,34 @@ func (c *cache) Get(namespace, name string) (metav1.Object, bool) {
 	return c.store.Get(store.Key{Namespace: namespace, Name: name})
 }
 
-func (c *cache) Update(obj metav1.Object) error {
+func (c *cache) Update(ctx context.Context, obj metav1.Object) error {
 	_, ok := c.store.Get(store.KeyOf(obj))
 	if !ok {
 		return werror.Error("object does not exist")
 	}
 	c.store.Put(obj)
-	c.queue.AddIfAbsent(store.UpdateRequest(obj))
+	c.queue.AddIfAbsent(store.UpdateRequest(obj).WithParentSpan(wtracing.SpanFromContext(ctx)))
 	return nil
 }
 
-func (c *cache) Delete(namespace, name string) {
+func (c *cache) Delete(ctx context.Context, namespace, name string) {
 	key := store.Key{Namespace: namespace, Name: name}
 	c.store.Delete(key)
-	c.queue.AddIfAbsent(store.DeleteRequest(key))
+	c.queue.AddIfAbsent(store.DeleteRequest(key).WithParentSpan(wtracing.SpanFromContext(ctx)))
 }
 
 func (c *cache) List() []metav1.Object {
 	return c.store.List()
 }
 
+// resync puts the given objects as last seen by the informer into the store, so that the cache reflects the updates
+// another client made while this one was not writing
+func (c *cache) resync(objects []metav1.Object) {
+	for _, obj := range objects {
+		c.store.Put(obj)
+	}
+}
+
 func (c *cache) onObjAdd(obj interface{}) {
 	c.tryOverrideResourceVersion(obj)
 }
@@ -78,13 +78,13 @@ func (dc *DemandCache) Run(ctx context.Context) {
 }
 
 // Create enqueues a creation request and puts the object into the store
-func (dc *DemandCache) Create(rr *demandapi.Demand) error {
-	return dc.cache.Create(rr)
+func (dc *DemandCache) Create(ctx context.Context, rr *demandapi.Demand) error {
+	return dc.cache.Create(ctx, rr)
 }
 
 // Delete enqueues a deletion request and removes the object from store
-func (dc *DemandCache) Delete(namespace, name string) {
-	dc.cache.Delete(namespace, name)
+func (dc *DemandCache) Delete(ctx context.Context, namespace, name string) {
+	dc.cache.Delete(ctx, namespace, name)
 }
 
 // Get returns the object from the store if it exists
@@ -20,6 +20,7 @@ import (
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
 	sparkschedulerclient "github.com/palantir/k8s-spark-scheduler-lib/pkg/client/clientset/versioned/typed/sparkscheduler/v1beta2"
 	rrinformers "github.com/palantir/k8s-spark-scheduler-lib/pkg/client/informers/externalversions/sparkscheduler/v1beta2"
+	rrlisters "github.com/palantir/k8s-spark-scheduler-lib/pkg/client/listers/sparkscheduler/v1beta2"
 	"github.com/palantir/k8s-spark-scheduler/config"
 	"github.com/palantir/k8s-spark-scheduler/internal/cache/store"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,6 +42,7 @@ type ResourceReservationCache struct {
 	client      sparkschedulerclient.SparkschedulerV1beta2Interface
 	cache       *cache
 	asyncClient *asyncClient
+	lister      rrlisters.ResourceReservationLister
 }
 
 // NewResourceReservationCache creates a new cache.
@@ -70,6 +72,7 @@ func NewResourceReservationCache(
 	return &ResourceReservationCache{
 		cache:       cache,
 		asyncClient: asyncClient,
+		lister:      resourceReservationInformer.Lister(),
 	}, nil
 }
 
@@ -79,18 +82,18 @@ func (rrc *ResourceReservationCache) Run(ctx context.Context) {
 }
 
 // Create enqueues a creation request and puts the object into the store
-func (rrc *ResourceReservationCache) Create(rr *v1beta2.ResourceReservation) error {
-	return rrc.cache.Create(rr)
+func (rrc *ResourceReservationCache) Create(ctx context.Context, rr *v1beta2.ResourceReservation) error {
+	return rrc.cache.Create(ctx, rr)
 }
 
 // Update enqueues an update request and updates the object in store
-func (rrc *ResourceReservationCache) Update(rr *v1beta2.ResourceReservation) error {
-	return rrc.cache.Update(rr)
+func (rrc *ResourceReservationCache) Update(ctx context.Context, rr *v1beta2.ResourceReservation) error {
+	return rrc.cache.Update(ctx, rr)
 }
 
 // Delete enqueues a deletion request and removes the object from store
-func (rrc *ResourceReservationCache) Delete(namespace, name string) {
-	rrc.cache.Delete(namespace, name)
+func (rrc *ResourceReservationCache) Delete(ctx context.Context, namespace, name string) {
+	rrc.cache.Delete(ctx, namespace, name)
 }
 
 // Get returns the object from the store if it exists
@@ -112,6 +115,28 @@ func (rrc *ResourceReservationCache) List() []*v1beta2.ResourceReservation {
 	return res
 }
 
+// Resync replaces the cached resource reservations with the ones seen by the informer. External updates are otherwise
+// ignored, so this needs to be called before writing resource reservations another client, such as a previous leader,
+// may have updated.
+func (rrc *ResourceReservationCache) Resync() error {
+	rrs, err := rrc.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	objects := make([]metav1.Object, 0, len(rrs))
+	for _, rr := range rrs {
+		objects = append(objects, rr.DeepCopy())
+	}
+	rrc.cache.resync(objects)
+	return nil
+}
+
+// DropQueuedWrites drops the writes that have not been sent to the api server yet, so that a replica which stopped
+// leading does not overwrite the resource reservations of the new leader. It returns the number of dropped writes.
+func (rrc *ResourceReservationCache) DropQueuedWrites(ctx context.Context) int {
+	return rrc.asyncClient.dropQueued(ctx)
+}
+
 // InflightQueueLengths returns the number of items per request queue
 func (rrc *ResourceReservationCache) InflightQueueLengths() []int {
 	return rrc.cache.queue.QueueLengths()
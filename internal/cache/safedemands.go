@@ -93,19 +93,19 @@ func (sdc *SafeDemandCache) CRDExists() bool {
 }
 
 // Create enqueues a creation request and puts the object into the store
-func (sdc *SafeDemandCache) Create(rr *demandapi.Demand) error {
+func (sdc *SafeDemandCache) Create(ctx context.Context, rr *demandapi.Demand) error {
 	if !sdc.demandCRDInitialized.Load() {
 		return werror.Error("Can not create demand because demand CRD does not exist")
 	}
-	return sdc.DemandCache.Create(rr)
+	return sdc.DemandCache.Create(ctx, rr)
 }
 
 // Delete enqueues a deletion request and removes the object from store
-func (sdc *SafeDemandCache) Delete(namespace, name string) {
+func (sdc *SafeDemandCache) Delete(ctx context.Context, namespace, name string) {
 	if !sdc.demandCRDInitialized.Load() {
 		return
 	}
-	sdc.DemandCache.Delete(namespace, name)
+	sdc.DemandCache.Delete(ctx, namespace, name)
 }
 
 // Get returns the object from the store if it exists
@@ -22,6 +22,7 @@ import (
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
 	v1 "k8s.io/api/core/v1"
@@ -40,13 +41,13 @@ type SoftReservationStore struct {
 // min reservation count
 type SoftReservation struct {
 	// Executor pod name -> Reservation (only valid ones here)
-	Reservations map[string]v1beta2.Reservation
+	Reservations map[string]v1beta2.Reservation `json:"reservations"`
 
 	// Executor pod name -> Reservation valid or not
 	// The reason for this is that we want to keep a history of previously allocated extra executors that we should not create a
 	// Reservation for if we already have in the past even if the executor is now dead. This prevents the scenario where we have a race between
 	// the executor death event handling and the executor's scheduling event.
-	Status map[string]bool
+	Status map[string]bool `json:"status"`
 }
 
 // NewSoftReservationStore builds and returns a SoftReservationStore and instantiates the needed background informer event handlers to keep the store up to date.
@@ -106,6 +107,14 @@ func (s *SoftReservationStore) CreateSoftReservationIfNotExists(appID string) {
 	}
 }
 
+// RestoreSoftReservation replaces the soft reservation of an application with the given one, such as one persisted by a
+// previous leader.
+func (s *SoftReservationStore) RestoreSoftReservation(appID string, softReservation *SoftReservation) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	s.store[appID] = s.deepCopySoftReservation(softReservation)
+}
+
 // AddReservationForPod adds a reservation for an extra executor pod, attaching the associated node and resources to it.
 // This is a noop if the reservation already exists.
 func (s *SoftReservationStore) AddReservationForPod(ctx context.Context, appID string, podName string, reservation v1beta2.Reservation) error {
@@ -169,6 +178,20 @@ func (s *SoftReservationStore) UsedSoftReservationResources() resources.NodeGrou
 	return res
 }
 
+// UsedSoftReservationExtendedResources returns SoftReservation extended resource usage by node.
+func (s *SoftReservationStore) UsedSoftReservationExtendedResources() types.NodeGroupExtendedResources {
+	s.storeLock.RLock()
+	defer s.storeLock.RUnlock()
+	res := types.NodeGroupExtendedResources{}
+
+	for _, softReservation := range s.store {
+		for _, reservationObject := range softReservation.Reservations {
+			res.AddFromReservation(&reservationObject)
+		}
+	}
+	return res
+}
+
 func (s *SoftReservationStore) onPodDeletion(obj interface{}) {
 	pod, ok := obj.(*v1.Pod)
 	if !ok {
@@ -187,7 +210,7 @@ func (s *SoftReservationStore) onPodDeletion(obj interface{}) {
 	appID := pod.Labels[common.SparkAppIDLabel]
 	switch pod.Labels[common.SparkRoleLabel] {
 	case common.Driver:
-		s.removeDriverReservation(appID)
+		s.RemoveDriverReservation(appID)
 	case common.Executor:
 		s.RemoveExecutorReservation(appID, pod.Name)
 	}
@@ -209,7 +232,21 @@ func (s *SoftReservationStore) RemoveExecutorReservation(appID string, executorN
 	sr.Status[executorName] = false
 }
 
-func (s *SoftReservationStore) removeDriverReservation(appID string) {
+// ReleaseExecutorReservation deletes the soft reservation bound to the passed executor without remembering it, so that the
+// executor can be given a soft reservation again later. This is used when an executor could not be bound to its node.
+func (s *SoftReservationStore) ReleaseExecutorReservation(appID string, executorName string) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	sr, found := s.store[appID]
+	if !found {
+		return
+	}
+	delete(sr.Reservations, executorName)
+	delete(sr.Status, executorName)
+}
+
+// RemoveDriverReservation deletes all soft reservations of the passed application
+func (s *SoftReservationStore) RemoveDriverReservation(appID string) {
 	s.storeLock.Lock()
 	defer s.storeLock.Unlock()
 	if _, found := s.store[appID]; found {
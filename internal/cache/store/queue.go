@@ -36,6 +36,7 @@ type ShardedUniqueQueue interface {
 	AddIfAbsent(Request)
 	GetConsumers() []<-chan func() Request
 	QueueLengths() []int
+	DropAll() []Request
 }
 
 // NewShardedUniqueQueue creates a sharded queue of write requests
@@ -120,6 +121,24 @@ func (q *shardedUniqueQueue) QueueLengths() []int {
 	return res
 }
 
+// DropAll removes the requests waiting in the queue without
+// handing them to consumers, and returns them. Requests already
+// taken by a consumer are not affected.
+func (q *shardedUniqueQueue) DropAll() []Request {
+	var dropped []Request
+	for _, c := range q.queues {
+		for draining := true; draining; {
+			select {
+			case requestGetter := <-c:
+				dropped = append(dropped, requestGetter())
+			default:
+				draining = false
+			}
+		}
+	}
+	return dropped
+}
+
 func (q *shardedUniqueQueue) bucket(k Key) uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(k.Namespace))
@@ -118,6 +118,26 @@ func TestTryAddIfAbsent(t *testing.T) {
 	assertSize(t, c, 100)
 }
 
+func TestDropAll(t *testing.T) {
+	q := NewShardedUniqueQueue(2)
+	q.AddIfAbsent(getRequest("ns", "1", CreateRequestType))
+	q.AddIfAbsent(getRequest("ns", "2", UpdateRequestType))
+	q.AddIfAbsent(getRequest("ns", "2", DeleteRequestType))
+	dropped := q.DropAll()
+	if len(dropped) != 3 {
+		t.Fatalf("dropped requests, expected:\n %v\n got:\n %v", 3, len(dropped))
+	}
+	for _, c := range q.GetConsumers() {
+		assertSize(t, c, 0)
+	}
+	if !q.TryAddIfAbsent(getRequest("ns", "1", UpdateRequestType)) {
+		t.Fatalf("must be able to enqueue a dropped object again")
+	}
+	if lengths := q.QueueLengths(); lengths[0]+lengths[1] != 1 {
+		t.Fatalf("queued requests, expected:\n %v\n got:\n %v", 1, lengths)
+	}
+}
+
 func assertSize(t *testing.T, c <-chan func() Request, expectedSize int) {
 	if len(c) != expectedSize {
 		t.Fatalf("chan size, expected:\n %v\n got:\n %v", expectedSize, len(c))
@@ -125,5 +145,5 @@ func assertSize(t *testing.T, c <-chan func() Request, expectedSize int) {
 }
 
 func getRequest(namespace string, name string, requestType RequestType) Request {
-	return Request{Key{namespace, name}, requestType, 0}
+	return Request{Key: Key{namespace, name}, Type: requestType}
 }
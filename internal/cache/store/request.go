@@ -15,6 +15,7 @@
 package store
 
 import (
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -46,24 +47,36 @@ type Request struct {
 	Key        Key
 	Type       RequestType
 	RetryCount int
+	// ParentSpan is the span of the scheduling operation that issued the request, if it was traced
+	ParentSpan *wtracing.SpanContext
 }
 
 // CreateRequest creates a create request for an object
 func CreateRequest(obj metav1.Object) Request {
-	return Request{KeyOf(obj), CreateRequestType, 0}
+	return Request{Key: KeyOf(obj), Type: CreateRequestType}
 }
 
 // UpdateRequest creates an update request for an object
 func UpdateRequest(obj metav1.Object) Request {
-	return Request{KeyOf(obj), UpdateRequestType, 0}
+	return Request{Key: KeyOf(obj), Type: UpdateRequestType}
 }
 
 // DeleteRequest creates a delete request for an object
 func DeleteRequest(objKey Key) Request {
-	return Request{objKey, DeleteRequestType, 0}
+	return Request{Key: objKey, Type: DeleteRequestType}
 }
 
 // WithIncrementedRetryCount returns the same request with an incremented RetryCount
 func (rq Request) WithIncrementedRetryCount() Request {
-	return Request{rq.Key, rq.Type, rq.RetryCount + 1}
+	rq.RetryCount++
+	return rq
+}
+
+// WithParentSpan returns the same request issued as part of the given span, if there is one
+func (rq Request) WithParentSpan(span wtracing.Span) Request {
+	if span != nil {
+		spanContext := span.Context()
+		rq.ParentSpan = &spanContext
+	}
+	return rq
 }
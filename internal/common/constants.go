@@ -25,6 +25,8 @@ const (
 	Driver = "driver"
 	// Executor represents the label key for a pod that identifies the pod as a spark executor
 	Executor = "executor"
+	// SparkOperatorAppNameLabel represents the label key the spark-operator sets to the name of the SparkApplication on its pods
+	SparkOperatorAppNameLabel = "sparkoperator.k8s.io/app-name"
 )
 
 const (
@@ -40,6 +42,10 @@ const (
 	ExecutorMemory = "spark-executor-mem"
 	// ExecutorNvidiaGPUs represents the key of an annotation that describes how many nvidia gpus a spark executor requires
 	ExecutorNvidiaGPUs = "spark-executor-nvidia.com/gpu"
+	// DriverEphemeralStorage represents the key of an annotation that describes how much local ephemeral storage a spark driver requires
+	DriverEphemeralStorage = "spark-driver-ephemeral-storage"
+	// ExecutorEphemeralStorage represents the key of an annotation that describes how much local ephemeral storage a spark executor requires
+	ExecutorEphemeralStorage = "spark-executor-ephemeral-storage"
 	// DynamicAllocationEnabled sets whether dynamic allocation is enabled for this spark application (false by default)
 	DynamicAllocationEnabled = "spark-dynamic-allocation-enabled"
 	// ExecutorCount represents the key of an annotation that describes how many executors a spark application requires (required if DynamicAllocationEnabled is false)
@@ -48,4 +54,18 @@ const (
 	DAMinExecutorCount = "spark-dynamic-allocation-min-executor-count"
 	// DAMaxExecutorCount represents the upper bound on the number of executors a spark application can have if dynamic allocation is enabled (required if DynamicAllocationEnabled is true)
 	DAMaxExecutorCount = "spark-dynamic-allocation-max-executor-count"
+	// DriverResourcePrefix is the prefix of annotations that describe how much of an extended resource, named by the rest of the key, a spark driver requires
+	DriverResourcePrefix = "spark-driver-resource."
+	// ExecutorResourcePrefix is the prefix of annotations that describe how much of an extended resource, named by the rest of the key, a spark executor requires
+	ExecutorResourcePrefix = "spark-executor-resource."
+	// ExpectedRuntime represents the key of an annotation that describes how long a spark application is expected to run for, as a duration such as 30m (optional, used for backfill)
+	ExpectedRuntime = "spark-expected-runtime"
+	// BinpackStrategy represents the key of an annotation that selects the binpack algorithm of a spark application instead of the one of its instance group (optional, has to be allowed by the configuration)
+	BinpackStrategy = "spark-binpack-strategy"
+	// QueueStatusAnnotation represents the key of an annotation the scheduler sets on pending drivers to describe their position in the FIFO queue of their instance group, as JSON
+	QueueStatusAnnotation = "spark-scheduler-queue-status"
+	// SoftReservationsAnnotation represents the key of an annotation the scheduler sets on resource reservations to persist the soft reservations of their application, as JSON
+	SoftReservationsAnnotation = "spark-scheduler-soft-reservations"
+	// BinpackStrategyAnnotation represents the key of an annotation the scheduler sets on resource reservations to record the binpack strategy their driver selected, so that executors are rescheduled with it
+	BinpackStrategyAnnotation = "spark-scheduler-binpack-strategy"
 )
@@ -0,0 +1,154 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"context"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	clientcache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	instanceGroupConfigResource = "instancegroupconfigs"
+	instanceGroupConfigKind     = "InstanceGroupConfig"
+)
+
+// InstanceGroupConfigGroupVersion is the group version of the cluster scoped InstanceGroupConfig resources, which
+// are named after the instance group they configure
+var InstanceGroupConfigGroupVersion = schema.GroupVersion{Group: "sparkscheduler.palantir.com", Version: "v1alpha1"}
+
+// NewInstanceGroupConfigClient creates a REST client for the InstanceGroupConfig resources, which decodes them as
+// unstructured objects
+func NewInstanceGroupConfigClient(config *rest.Config) (rest.Interface, error) {
+	return newUnstructuredClient(config, InstanceGroupConfigGroupVersion)
+}
+
+// NewInstanceGroupConfigInformer creates an informer of the InstanceGroupConfig resources
+func NewInstanceGroupConfigInformer(client rest.Interface, resyncPeriod time.Duration) clientcache.SharedIndexInformer {
+	return clientcache.NewSharedIndexInformer(
+		clientcache.NewListWatchFromClient(client, instanceGroupConfigResource, metav1.NamespaceAll, fields.Everything()),
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		clientcache.Indexers{},
+	)
+}
+
+// EnsureInstanceGroupConfigCRD creates or upgrades the InstanceGroupConfig CRD
+func EnsureInstanceGroupConfigCRD(ctx context.Context, clientset apiextensionsclientset.Interface) error {
+	return ensureCRD(ctx, clientset, InstanceGroupConfigCustomResourceDefinition())
+}
+
+// InstanceGroupConfigCustomResourceDefinition returns the definition of the InstanceGroupConfig CRD
+func InstanceGroupConfigCustomResourceDefinition() *apiextensionsv1.CustomResourceDefinition {
+	quantity := apiextensionsv1.JSONSchemaProps{Type: "string"}
+	queueResources := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"cpu":            quantity,
+			"memory":         quantity,
+			"nvidia.com/gpu": quantity,
+		},
+	}
+	labelPriority := apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"labelName", "labelValuesDescendingPriority"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"labelName": {Type: "string"},
+			"labelValuesDescendingPriority": {
+				Type:  "array",
+				Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
+			},
+		},
+	}
+	ratio := apiextensionsv1.JSONSchemaProps{Type: "number", Minimum: float64Ptr(0), ExclusiveMinimum: true}
+	spec := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"binpack":                      {Type: "string"},
+			"fifo":                         {Type: "boolean"},
+			"fifoEnforceAfterPodAge":       {Type: "string"},
+			"driverOrderingPolicy":         {Type: "string", Enum: []apiextensionsv1.JSON{{Raw: []byte(`"fifo"`)}, {Raw: []byte(`"fair-share"`)}}},
+			"driverPrioritizedNodeLabel":   labelPriority,
+			"executorPrioritizedNodeLabel": labelPriority,
+			"overcommit": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"cpu":    ratio,
+					"memory": ratio,
+				},
+			},
+			"queues": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"queueLabel": {Type: "string"},
+					"queues": {
+						Type: "object",
+						AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{
+							Allows: true,
+							Schema: &apiextensionsv1.JSONSchemaProps{
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"parent":     {Type: "string"},
+									"guaranteed": queueResources,
+									"max":        queueResources,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: instanceGroupConfigResource + "." + InstanceGroupConfigGroupVersion.Group,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: InstanceGroupConfigGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:   instanceGroupConfigResource,
+				Singular: "instancegroupconfig",
+				Kind:     instanceGroupConfigKind,
+				ListKind: instanceGroupConfigKind + "List",
+			},
+			Scope: apiextensionsv1.ClusterScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    InstanceGroupConfigGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": spec,
+						},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
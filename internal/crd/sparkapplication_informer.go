@@ -0,0 +1,74 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/rest"
+	clientcache "k8s.io/client-go/tools/cache"
+)
+
+const sparkApplicationResource = "sparkapplications"
+
+// SparkApplicationGroupVersion is the group version of the spark-operator SparkApplication resources
+var SparkApplicationGroupVersion = schema.GroupVersion{Group: "sparkoperator.k8s.io", Version: "v1beta2"}
+
+// NewSparkApplicationClient creates a REST client for the spark-operator SparkApplication resources, which decodes
+// them as unstructured objects so that the spark-operator types do not need to be vendored
+func NewSparkApplicationClient(config *rest.Config) (rest.Interface, error) {
+	return newUnstructuredClient(config, SparkApplicationGroupVersion)
+}
+
+// newUnstructuredClient creates a REST client for the resources of the given group version, which decodes them as
+// unstructured objects
+func newUnstructuredClient(config *rest.Config, groupVersion schema.GroupVersion) (rest.Interface, error) {
+	unstructuredConfig := rest.CopyConfig(config)
+	unstructuredConfig.GroupVersion = &groupVersion
+	unstructuredConfig.APIPath = "/apis"
+	unstructuredConfig.ContentType = runtime.ContentTypeJSON
+	unstructuredConfig.NegotiatedSerializer = runtime.NewSimpleNegotiatedSerializer(runtime.SerializerInfo{
+		MediaType:        runtime.ContentTypeJSON,
+		MediaTypeType:    "application",
+		MediaTypeSubType: "json",
+		EncodesAsText:    true,
+		Serializer:       unstructured.UnstructuredJSONScheme,
+		StreamSerializer: &runtime.StreamSerializerInfo{
+			EncodesAsText: true,
+			Serializer:    unstructured.UnstructuredJSONScheme,
+			Framer:        json.Framer,
+		},
+	})
+	if unstructuredConfig.UserAgent == "" {
+		unstructuredConfig.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(unstructuredConfig)
+}
+
+// NewSparkApplicationInformer creates an informer of the SparkApplication resources in all namespaces
+func NewSparkApplicationInformer(client rest.Interface, resyncPeriod time.Duration) clientcache.SharedIndexInformer {
+	return clientcache.NewSharedIndexInformer(
+		clientcache.NewListWatchFromClient(client, sparkApplicationResource, metav1.NamespaceAll, fields.Everything()),
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		clientcache.Indexers{clientcache.NamespaceIndex: clientcache.MetaNamespaceIndexFunc},
+	)
+}
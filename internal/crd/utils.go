@@ -102,6 +102,11 @@ func EnsureResourceReservationsCRD(ctx context.Context, clientset apiextensionsc
 	for k, v := range annotations {
 		crd.Annotations[k] = v
 	}
+	return ensureCRD(ctx, clientset, crd)
+}
+
+// ensureCRD creates the CRD, or updates it if it differs from the existing one, and waits for it to be established
+func ensureCRD(ctx context.Context, clientset apiextensionsclientset.Interface, crd *apiextensionsv1.CustomResourceDefinition) error {
 	existing, ready, err := CheckCRDExists(ctx, crd.Name, clientset)
 	if err != nil {
 		return werror.Wrap(err, "Failed to get CRD")
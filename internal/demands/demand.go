@@ -43,19 +43,22 @@ type Manager interface {
 
 type defaultManager struct {
 	demands            *cache.SafeDemandCache
-	binpacker          *binpacker.Binpacker
+	binpackers         *binpacker.InstanceGroupBinpackers
 	instanceGroupLabel string
+	podEvents          events.PodEventRecorder
 }
 
 // NewDefaultManager creates the default implementation of the Manager
 func NewDefaultManager(
 	demands *cache.SafeDemandCache,
-	binpacker *binpacker.Binpacker,
-	instanceGroupLabel string) Manager {
+	binpackers *binpacker.InstanceGroupBinpackers,
+	instanceGroupLabel string,
+	podEvents events.PodEventRecorder) Manager {
 	return &defaultManager{
 		demands:            demands,
-		binpacker:          binpacker,
+		binpackers:         binpackers,
 		instanceGroupLabel: instanceGroupLabel,
+		podEvents:          podEvents,
 	}
 }
 
@@ -98,25 +101,25 @@ func (d *defaultManager) createDemand(ctx context.Context, pod *v1.Pod, demandUn
 		return
 	}
 
-	newDemand, err := d.newDemand(pod, instanceGroup, demandUnits, zone)
+	newDemand, err := d.newDemand(ctx, pod, instanceGroup, demandUnits, zone)
 	if err != nil {
 		svc1log.FromContext(ctx).Error("failed to construct demand object", svc1log.Stacktrace(err))
 		return
 	}
-	err = d.doCreateDemand(ctx, newDemand)
+	err = d.doCreateDemand(ctx, pod, newDemand)
 	if err != nil {
 		svc1log.FromContext(ctx).Error("failed to create demand", svc1log.Stacktrace(err))
 		return
 	}
 }
 
-func (d *defaultManager) doCreateDemand(ctx context.Context, newDemand *demandapi.Demand) error {
+func (d *defaultManager) doCreateDemand(ctx context.Context, pod *v1.Pod, newDemand *demandapi.Demand) error {
 	demandObjectBytes, err := json.Marshal(newDemand)
 	if err != nil {
 		return werror.Wrap(err, "failed to marshal demand object")
 	}
 	svc1log.FromContext(ctx).Info("Creating demand object", svc1log.SafeParams(internal.DemandSafeParamsFromObj(newDemand)), svc1log.SafeParam("demandObjectBytes", string(demandObjectBytes)))
-	err = d.demands.Create(newDemand)
+	err = d.demands.Create(ctx, newDemand)
 	if err != nil {
 		_, ok := d.demands.Get(newDemand.Namespace, newDemand.Name)
 		if ok {
@@ -125,6 +128,10 @@ func (d *defaultManager) doCreateDemand(ctx context.Context, newDemand *demandap
 		}
 	}
 	events.EmitDemandCreated(ctx, newDemand)
+	if err == nil {
+		d.podEvents.Eventf(pod, v1.EventTypeNormal, events.ReasonDemandCreated,
+			"requested more capacity for instance group %s from the cluster autoscaler with demand %s", newDemand.Spec.InstanceGroup, newDemand.Name)
+	}
 	return err
 }
 
@@ -140,13 +147,14 @@ func (d *defaultManager) DeleteDemandIfExists(ctx context.Context, pod *v1.Pod,
 	demandName := utils.DemandName(pod)
 	if demand, ok := d.demands.Get(pod.Namespace, demandName); ok {
 		// there is no harm in the demand being deleted elsewhere in between the two calls.
-		d.demands.Delete(pod.Namespace, demandName)
+		d.demands.Delete(ctx, pod.Namespace, demandName)
 		svc1log.FromContext(ctx).Info("Removed demand object for pod", svc1log.SafeParams(internal.DemandSafeParams(demandName, pod.Namespace)))
 		events.EmitDemandDeleted(ctx, demand, source)
+		d.podEvents.Eventf(pod, v1.EventTypeNormal, events.ReasonDemandFulfilled, "demand %s is no longer needed as the pod was scheduled", demandName)
 	}
 }
 
-func (d *defaultManager) newDemand(pod *v1.Pod, instanceGroup string, units []demandapi.DemandUnit, zone *demandapi.Zone) (*demandapi.Demand, error) {
+func (d *defaultManager) newDemand(ctx context.Context, pod *v1.Pod, instanceGroup string, units []demandapi.DemandUnit, zone *demandapi.Zone) (*demandapi.Demand, error) {
 	appID, ok := pod.Labels[common.SparkAppIDLabel]
 	if !ok {
 		return nil, werror.Error("pod did not contain expected label for AppID", werror.SafeParam("expectedLabel", common.SparkAppIDLabel))
@@ -166,7 +174,7 @@ func (d *defaultManager) newDemand(pod *v1.Pod, instanceGroup string, units []de
 		Spec: demandapi.DemandSpec{
 			InstanceGroup:               instanceGroup,
 			Units:                       units,
-			EnforceSingleZoneScheduling: d.binpacker.IsSingleAz,
+			EnforceSingleZoneScheduling: d.binpackers.ForInstanceGroup(ctx, instanceGroup).IsSingleAz,
 			Zone:                        zone,
 		},
 	}, nil
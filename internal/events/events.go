@@ -28,6 +28,7 @@ const (
 	applicationScheduled = "foundry.spark.scheduler.application_scheduled"
 	demandCreated        = "foundry.spark.scheduler.demand_created"
 	demandDeleted        = "foundry.spark.scheduler.demand_deleted"
+	applicationPreempted = "foundry.spark.scheduler.application_preempted"
 )
 
 // EmitApplicationScheduled logs an event when an application has been successfully scheduled. This usually means
@@ -80,3 +81,14 @@ func EmitDemandDeleted(ctx context.Context, demand *v1alpha2.Demand, source stri
 		"source":             source,
 	}))
 }
+
+// EmitApplicationPreempted logs an event when an application has been preempted, meaning all of its pods and
+// reservations were deleted to make room for a higher priority application.
+func EmitApplicationPreempted(ctx context.Context, instanceGroup string, sparkAppID string, namespace string, preemptorSparkAppID string) {
+	evt2log.FromContext(ctx).Event(applicationPreempted, evt2log.Values(map[string]interface{}{
+		"instanceGroup":       instanceGroup,
+		"sparkAppID":          sparkAppID,
+		"namespace":           namespace,
+		"preemptorSparkAppID": preemptorSparkAppID,
+	}))
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Reasons of the events published on pods and SparkApplications
+const (
+	ReasonInsufficientCapacity      = "SparkSchedulerInsufficientCapacity"
+	ReasonWaitingForEarlierDriver   = "SparkSchedulerWaitingForEarlierDriver"
+	ReasonNoFreeExecutorReservation = "SparkSchedulerNoFreeExecutorReservation"
+	ReasonApplicationReserved       = "SparkSchedulerApplicationReserved"
+	ReasonDemandCreated             = "SparkSchedulerDemandCreated"
+	ReasonDemandFulfilled           = "SparkSchedulerDemandFulfilled"
+	ReasonExceedsClusterCapacity    = "SparkSchedulerExceedsClusterCapacity"
+)
+
+const (
+	defaultPodEventsQPS   = 5
+	defaultPodEventsBurst = 25
+	podEventQueueSize     = 1000
+	// maxAggregatedEvents bounds the number of published events remembered to be aggregated with repeated ones
+	maxAggregatedEvents = 4096
+)
+
+// PodEventRecorder publishes kubernetes events on pods, so that `kubectl describe pod` explains how the pod is being
+// scheduled, and on other objects such as SparkApplications. Events are published asynchronously and rate limited.
+// Repeated events with the same reason and message on an object increment the count of the first one instead of
+// creating new events.
+type PodEventRecorder interface {
+	Event(pod *v1.Pod, eventType, reason, message string)
+	Eventf(pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{})
+	ObjectEvent(object v1.ObjectReference, eventType, reason, message string)
+}
+
+type podEventKey struct {
+	object  v1.ObjectReference
+	reason  string
+	message string
+}
+
+type podEvent struct {
+	key       podEventKey
+	eventType string
+	timestamp metav1.Time
+}
+
+type podEventRecorder struct {
+	events      corev1.EventsGetter
+	rateLimiter flowcontrol.RateLimiter
+	queue       chan podEvent
+	// published holds the last event published for a key, only accessed by the publishing goroutine
+	published map[podEventKey]*v1.Event
+}
+
+// NewPodEventRecorder creates a PodEventRecorder publishing events until the context is done
+func NewPodEventRecorder(ctx context.Context, events corev1.EventsGetter, podEventsConfig config.PodEventsConfig) PodEventRecorder {
+	qps := podEventsConfig.QPS
+	if qps <= 0 {
+		qps = defaultPodEventsQPS
+	}
+	burst := podEventsConfig.Burst
+	if burst <= 0 {
+		burst = defaultPodEventsBurst
+	}
+	r := &podEventRecorder{
+		events:      events,
+		rateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		queue:       make(chan podEvent, podEventQueueSize),
+		published:   make(map[podEventKey]*v1.Event),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Event queues an event for the pod, the event is dropped if the queue is full
+func (r *podEventRecorder) Event(pod *v1.Pod, eventType, reason, message string) {
+	r.ObjectEvent(v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}, eventType, reason, message)
+}
+
+// Eventf is like Event, with a formatted message
+func (r *podEventRecorder) Eventf(pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(pod, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// ObjectEvent queues an event for the referenced object, the event is dropped if the queue is full
+func (r *podEventRecorder) ObjectEvent(object v1.ObjectReference, eventType, reason, message string) {
+	event := podEvent{
+		key: podEventKey{
+			object:  object,
+			reason:  reason,
+			message: message,
+		},
+		eventType: eventType,
+		timestamp: metav1.Now(),
+	}
+	select {
+	case r.queue <- event:
+	default:
+	}
+}
+
+func (r *podEventRecorder) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-r.queue:
+			r.rateLimiter.Accept()
+			if err := r.publish(ctx, event); err != nil {
+				svc1log.FromContext(ctx).Warn("failed to publish event",
+					svc1log.SafeParam("objectKind", event.key.object.Kind),
+					svc1log.SafeParam("objectName", event.key.object.Name),
+					svc1log.SafeParam("objectNamespace", event.key.object.Namespace),
+					svc1log.SafeParam("eventReason", event.key.reason),
+					svc1log.Stacktrace(err))
+			}
+		}
+	}
+}
+
+func (r *podEventRecorder) publish(ctx context.Context, event podEvent) error {
+	if previous, ok := r.published[event.key]; ok {
+		updated := previous.DeepCopy()
+		updated.Count++
+		updated.LastTimestamp = event.timestamp
+		result, err := r.events.Events(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err == nil {
+			r.published[event.key] = result
+			return nil
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// the event expired, so a new one is created
+		delete(r.published, event.key)
+	}
+	result, err := r.events.Events(event.key.object.Namespace).Create(ctx, newPodEvent(event), metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	if len(r.published) >= maxAggregatedEvents {
+		for key := range r.published {
+			delete(r.published, key)
+			break
+		}
+	}
+	r.published[event.key] = result
+	return nil
+}
+
+func newPodEvent(event podEvent) *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", event.key.object.Name, event.timestamp.UnixNano()),
+			Namespace: event.key.object.Namespace,
+		},
+		InvolvedObject: event.key.object,
+		Reason:         event.key.reason,
+		Message:        event.key.message,
+		Type:           event.eventType,
+		Source:         v1.EventSource{Component: common.SparkSchedulerName},
+		FirstTimestamp: event.timestamp,
+		LastTimestamp:  event.timestamp,
+		Count:          1,
+	}
+}
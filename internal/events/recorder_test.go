@@ -0,0 +1,99 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodEventRecorder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	recorder := NewPodEventRecorder(ctx, client.CoreV1(), config.PodEventsConfig{})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace", Name: "driver", UID: "uid"}}
+
+	recorder.Event(pod, v1.EventTypeWarning, ReasonInsufficientCapacity, "application does not fit to the cluster")
+	recorder.Event(pod, v1.EventTypeWarning, ReasonInsufficientCapacity, "application does not fit to the cluster")
+	recorder.Eventf(pod, v1.EventTypeNormal, ReasonApplicationReserved, "reserved %d executors", 2)
+
+	var events []v1.Event
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		list, err := client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		events = list.Items
+		counts := make(map[string]int32, len(events))
+		for _, event := range events {
+			counts[event.Reason] = event.Count
+		}
+		return counts[ReasonInsufficientCapacity] == 2 && counts[ReasonApplicationReserved] == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the repeated event to be aggregated, got %+v", events)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != pod.Name || event.InvolvedObject.UID != pod.UID {
+			t.Errorf("expected the event to involve the pod, got %+v", event.InvolvedObject)
+		}
+		if event.Reason == ReasonApplicationReserved && (event.Message != "reserved 2 executors" || event.Type != v1.EventTypeNormal) {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+}
+
+func TestObjectEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	recorder := NewPodEventRecorder(ctx, client.CoreV1(), config.PodEventsConfig{})
+	object := v1.ObjectReference{
+		APIVersion: "sparkoperator.k8s.io/v1beta2",
+		Kind:       "SparkApplication",
+		Namespace:  "namespace",
+		Name:       "application",
+		UID:        "uid",
+	}
+
+	recorder.ObjectEvent(object, v1.EventTypeWarning, ReasonInsufficientCapacity, "application does not fit to the cluster")
+
+	var events []v1.Event
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		list, err := client.CoreV1().Events(object.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		events = list.Items
+		return len(events) == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected an event on the object, got %+v", events)
+	}
+	if events[0].InvolvedObject != object || events[0].Reason != ReasonInsufficientCapacity {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
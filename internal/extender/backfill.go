@@ -0,0 +1,195 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// runningApplication is an application holding reservations, with the time it is expected to release them
+type runningApplication struct {
+	expectedEnd   time.Time
+	usage         resources.NodeGroupResources
+	extendedUsage types.NodeGroupExtendedResources
+}
+
+// canBackfill decides whether the given driver may be scheduled ahead of a blocked earlier driver. The earliest time
+// the blocked driver could start is estimated from the expected runtimes of the applications holding reservations,
+// and the driver is only backfilled if it is expected to finish before then, or if the blocked driver would still fit
+// at that time with the backfilled application's reservations in place. Nothing is backfilled when the expected
+// runtimes are not known.
+func (s *SparkSchedulerExtender) canBackfill(
+	ctx context.Context,
+	binpacker *internalbinpacker.Binpacker,
+	driver *v1.Pod,
+	applicationResources *types.SparkApplicationResources,
+	blockingDriver *v1.Pod,
+	driverNodeNames, executorNodeNames []string,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) bool {
+	ctx = svc1log.WithLoggerParams(ctx, svc1log.SafeParam("blockingDriverName", blockingDriver.Name))
+	logger := svc1log.FromContext(ctx)
+	blockingApplicationResources, err := s.podLister.sparkResources(ctx, blockingDriver)
+	if err != nil {
+		return false
+	}
+	packingResult := binpacker.BinpackApplication(
+		ctx,
+		applicationResources,
+		driverNodeNames, executorNodeNames, availableNodesSchedulingMetadata, availableExtendedResources)
+	if !packingResult.HasCapacity {
+		return false
+	}
+
+	now := time.Now()
+	blockingDriverStart, metadata, extendedResources, found := s.estimateStart(
+		ctx, binpacker, now, blockingApplicationResources,
+		driverNodeNames, executorNodeNames, availableNodesSchedulingMetadata, availableExtendedResources)
+	if !found {
+		logger.Debug("can not estimate when the blocking driver will fit, not backfilling")
+		return false
+	}
+
+	if expectedRuntime, ok := expectedRuntime(driver); ok && !now.Add(expectedRuntime).After(blockingDriverStart) {
+		logger.Info("backfilling driver which is expected to finish before the blocking driver can start",
+			svc1log.SafeParam("blockingDriverExpectedStart", blockingDriverStart))
+		return true
+	}
+	metadata.SubtractUsageIfExists(sparkResourceUsage(
+		applicationResources.DriverResources,
+		applicationResources.ExecutorResources,
+		packingResult.DriverNode,
+		packingResult.ExecutorNodes))
+	extendedResources.Sub(internalbinpacker.ExtendedResourceUsage(applicationResources, packingResult.DriverNode, packingResult.ExecutorNodes))
+	if s.fits(ctx, binpacker, blockingApplicationResources, driverNodeNames, executorNodeNames, metadata, extendedResources) {
+		logger.Info("backfilling driver which does not delay the blocking driver",
+			svc1log.SafeParam("blockingDriverExpectedStart", blockingDriverStart))
+		return true
+	}
+	return false
+}
+
+// estimateStart estimates the earliest time the given application fits, by releasing the reservations of the running
+// applications in the order they are expected to finish. It returns the scheduling metadata and extended resources
+// available at that time, and false if the application does not fit once all applications with an expected runtime
+// have finished.
+func (s *SparkSchedulerExtender) estimateStart(
+	ctx context.Context,
+	binpacker *internalbinpacker.Binpacker,
+	now time.Time,
+	applicationResources *types.SparkApplicationResources,
+	driverNodeNames, executorNodeNames []string,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) (time.Time, resources.NodeGroupSchedulingMetadata, types.NodeGroupExtendedResources, bool) {
+	metadata := copySchedulingMetadata(availableNodesSchedulingMetadata)
+	extendedResources := availableExtendedResources.Copy()
+	for _, app := range s.runningApplications(now, availableNodesSchedulingMetadata) {
+		for nodeName, usage := range app.usage {
+			if nodeSchedulingMetadata, ok := metadata[nodeName]; ok {
+				nodeSchedulingMetadata.AvailableResources.Add(usage)
+			}
+		}
+		extendedResources.Add(app.extendedUsage)
+		if s.fits(ctx, binpacker, applicationResources, driverNodeNames, executorNodeNames, metadata, extendedResources) {
+			return app.expectedEnd, metadata, extendedResources, true
+		}
+	}
+	return time.Time{}, metadata, extendedResources, false
+}
+
+func (s *SparkSchedulerExtender) fits(
+	ctx context.Context,
+	binpacker *internalbinpacker.Binpacker,
+	applicationResources *types.SparkApplicationResources,
+	driverNodeNames, executorNodeNames []string,
+	metadata resources.NodeGroupSchedulingMetadata,
+	extendedResources types.NodeGroupExtendedResources) bool {
+	return binpacker.BinpackApplication(
+		ctx,
+		applicationResources,
+		driverNodeNames, executorNodeNames, metadata, extendedResources).HasCapacity
+}
+
+// runningApplications returns the applications holding reservations on the given nodes which have an expected
+// runtime, ordered by the time they are expected to finish
+func (s *SparkSchedulerExtender) runningApplications(now time.Time, availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) []*runningApplication {
+	apps := make([]*runningApplication, 0)
+	for _, rr := range s.resourceReservations.List() {
+		driverReservation, ok := rr.Spec.Reservations[common.Driver]
+		if !ok {
+			continue
+		}
+		if _, ok := availableNodesSchedulingMetadata[driverReservation.Node]; !ok {
+			continue
+		}
+		driver, err := s.podLister.Pods(rr.Namespace).Get(rr.Status.Pods[common.Driver])
+		if err != nil {
+			continue
+		}
+		runtime, ok := expectedRuntime(driver)
+		if !ok {
+			continue
+		}
+		start := now
+		if driver.Status.StartTime != nil {
+			start = driver.Status.StartTime.Time
+		} else if !rr.CreationTimestamp.IsZero() {
+			start = rr.CreationTimestamp.Time
+		}
+		usage := resources.UsageForNodes([]*v1beta2.ResourceReservation{rr})
+		extendedUsage := types.ExtendedResourceUsageForNodes([]*v1beta2.ResourceReservation{rr})
+		if sr, ok := s.softReservationStore.GetSoftReservation(rr.Name); ok {
+			for _, reservation := range sr.Reservations {
+				if usage[reservation.Node] == nil {
+					usage[reservation.Node] = resources.Zero()
+				}
+				usage[reservation.Node].AddFromReservation(&reservation)
+				extendedUsage.AddFromReservation(&reservation)
+			}
+		}
+		apps = append(apps, &runningApplication{
+			expectedEnd:   start.Add(runtime),
+			usage:         usage,
+			extendedUsage: extendedUsage,
+		})
+	}
+	sort.SliceStable(apps, func(i, j int) bool {
+		return apps[i].expectedEnd.Before(apps[j].expectedEnd)
+	})
+	return apps
+}
+
+// expectedRuntime parses the expected runtime hint of a driver, if it has a valid one
+func expectedRuntime(driver *v1.Pod) (time.Duration, bool) {
+	value, ok := driver.Annotations[common.ExpectedRuntime]
+	if !ok {
+		return 0, false
+	}
+	runtime, err := time.ParseDuration(value)
+	if err != nil || runtime <= 0 {
+		return 0, false
+	}
+	return runtime, true
+}
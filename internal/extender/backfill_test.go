@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBackfill(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	runningApp := backfillSparkPods("running-app", "2", 0, "10m")
+	blockedApp := backfillSparkPods("blocked-app", "4", 1, "")
+	shortApp := backfillSparkPods("short-app", "1", 2, "5m")
+	longApp := backfillSparkPods("long-app", "1", 3, "")
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&runningApp[0],
+		&runningApp[1],
+		&blockedApp[0],
+		&shortApp[0],
+		&longApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	for _, pod := range runningApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the running application")
+	}
+	testHarness.AssertFailedSchedule(t, blockedApp[0], nodeNames, "The blocked application does not fit until the running application finishes")
+	testHarness.AssertSuccessfulSchedule(t, shortApp[0], nodeNames, "The short application is expected to finish before the blocked application can start")
+	testHarness.AssertFailedSchedule(t, longApp[0], nodeNames, "The long application would delay the blocked application")
+}
+
+func backfillSparkPods(sparkApplicationID, cpu string, ageRank int, expectedRuntime string) []v1.Pod {
+	pods := extendertest.StaticAllocationSparkPodsWithSizes(sparkApplicationID, 1, "1", cpu, "1", cpu)
+	// the test node only has a single gpu, which would otherwise only fit one driver
+	delete(pods[0].Annotations, "spark-driver-nvidia.com/gpu")
+	if expectedRuntime != "" {
+		pods[0].Annotations[common.ExpectedRuntime] = expectedRuntime
+	}
+	for i := range pods {
+		pods[i].CreationTimestamp = metav1.NewTime(time.Unix(0, 0).Add(time.Duration(ageRank) * time.Hour))
+	}
+	return pods
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+// Bind binds the pod in the ExtenderBindingArgs to the given node. Spark pods are only bound once they hold a reservation
+// on that node, and the reservation is released again if the binding fails, so that no reserved but unbound slot is left
+// behind until the next reconciliation.
+func (s *SparkSchedulerExtender) Bind(ctx context.Context, args schedulerapi.ExtenderBindingArgs) *schedulerapi.ExtenderBindingResult {
+	ctx = svc1log.WithLoggerParams(ctx,
+		svc1log.SafeParam("podNamespace", args.PodNamespace),
+		svc1log.SafeParam("podName", args.PodName),
+		svc1log.SafeParam("nodeName", args.Node))
+	logger := svc1log.FromContext(ctx)
+
+	if !s.isActive() {
+		logger.Info("rejecting binding as this replica is not the leader")
+		return &schedulerapi.ExtenderBindingResult{Error: "this replica of the extender is not the leader"}
+	}
+
+	pod, err := s.podLister.Pods(args.PodNamespace).Get(args.PodName)
+	if err != nil {
+		logger.Error("failed to get pod to bind", svc1log.Stacktrace(err))
+		return &schedulerapi.ExtenderBindingResult{Error: err.Error()}
+	}
+	if pod.UID != args.PodUID {
+		logger.Error("pod to bind does not match the pod in the cache", svc1log.SafeParam("podUID", args.PodUID), svc1log.SafeParam("cachedPodUID", pod.UID))
+		return &schedulerapi.ExtenderBindingResult{Error: "pod to bind does not match the pod in the cache"}
+	}
+	ctx = svc1log.WithLoggerParams(ctx, svc1log.SafeParams(internal.PodSafeParams(*pod)))
+	logger = svc1log.FromContext(ctx)
+
+	role := pod.Labels[common.SparkRoleLabel]
+	isSparkPod := role == common.Driver || role == common.Executor
+	if isSparkPod {
+		if err := s.ensureReservationOnNode(ctx, pod, args.Node); err != nil {
+			logger.Error("failed to reserve node before binding pod", svc1log.Stacktrace(err))
+			return &schedulerapi.ExtenderBindingResult{Error: err.Error()}
+		}
+	}
+
+	err = s.coreClient.Pods(pod.Namespace).Bind(ctx, &v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+		Target:     v1.ObjectReference{Kind: "Node", Name: args.Node},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error("failed to bind pod", svc1log.Stacktrace(err))
+		if isSparkPod && !s.isBound(ctx, pod) {
+			if releaseErr := s.resourceReservationManager.ReleaseReservationForPod(ctx, pod); releaseErr != nil {
+				logger.Error("failed to release reservation of pod which could not be bound", svc1log.Stacktrace(releaseErr))
+			}
+		}
+		return &schedulerapi.ExtenderBindingResult{Error: err.Error()}
+	}
+
+	logger.Info("bound pod to node")
+	return &schedulerapi.ExtenderBindingResult{}
+}
+
+// ensureReservationOnNode makes sure the pod holds a reservation on the given node. The reservation of a pod reserved on
+// another node is moved to the given node if the pod fits there, and an executor without a reservation is bound to a
+// free reservation of its application.
+func (s *SparkSchedulerExtender) ensureReservationOnNode(ctx context.Context, pod *v1.Pod, node string) error {
+	if pod.Labels[common.SparkRoleLabel] == common.Driver {
+		rr, ok := s.resourceReservationManager.GetResourceReservation(pod.Labels[common.SparkAppIDLabel], pod.Namespace)
+		if !ok {
+			return werror.ErrorWithContextParams(ctx, "driver does not have a resource reservation")
+		}
+		reservedNode := rr.Spec.Reservations[common.Driver].Node
+		if reservedNode == node {
+			return nil
+		}
+		if _, ok := s.getReservationNodeFromNodeList(s.fittingDriverNodes(ctx, pod, []string{node}, reservedNode), []string{node}); !ok {
+			return werror.ErrorWithContextParams(ctx, "driver does not fit on the node it is bound to, which is not its reserved node",
+				werror.SafeParam("reservedNodeName", reservedNode))
+		}
+		svc1log.FromContext(ctx).Info("driver is reserved on a different node than the one it is bound to, moving its reservation",
+			svc1log.SafeParam("reservedNodeName", reservedNode))
+		return s.resourceReservationManager.MoveReservationForDriver(ctx, pod, node)
+	}
+
+	reservedNode, found, err := s.resourceReservationManager.FindAlreadyBoundReservationNode(ctx, pod)
+	if err != nil {
+		return err
+	}
+	if found && reservedNode == node {
+		return nil
+	}
+	if found {
+		svc1log.FromContext(ctx).Info("executor is reserved on a different node than the one it is bound to, moving its reservation",
+			svc1log.SafeParam("reservedNodeName", reservedNode))
+	}
+	unboundReservationNodes, _, err := s.resourceReservationManager.FindUnboundReservationNodes(ctx, pod)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.getReservationNodeFromNodeList(unboundReservationNodes, []string{node}); !ok {
+		fits, err := s.executorFitsOnNode(ctx, pod, node)
+		if err != nil {
+			return err
+		}
+		if !fits {
+			return werror.ErrorWithContextParams(ctx, "executor does not fit on the node it is bound to")
+		}
+	}
+	return s.resourceReservationManager.MoveReservationForExecutor(ctx, pod, node)
+}
+
+// executorFitsOnNode returns whether the executor fits in the resources of the node left after reservations and overhead,
+// the same way executors are checked when they are rescheduled
+func (s *SparkSchedulerExtender) executorFitsOnNode(ctx context.Context, executor *v1.Pod, nodeName string) (bool, error) {
+	driver, err := s.podLister.getDriverPodForExecutor(ctx, executor)
+	if err != nil {
+		return false, err
+	}
+	sparkResources, err := s.podLister.sparkResources(ctx, driver)
+	if err != nil {
+		return false, err
+	}
+	node, err := s.nodeLister.Get(nodeName)
+	if err != nil {
+		return false, werror.WrapWithContextParams(ctx, err, "failed to get node")
+	}
+	nodes := []*v1.Node{node}
+	usage := s.resourceReservationManager.GetReservedResources()
+	usage.Add(s.overheadComputer.GetOverhead(ctx, nodes))
+	availableResources := resources.AvailableForNodes(s.podInstanceGroupSettings(ctx, executor).overcommittedNodes(nodes), usage)
+	executorResources := &resources.Resources{CPU: sparkResources.ExecutorResources.CPU, Memory: sparkResources.ExecutorResources.Memory, NvidiaGPU: sparkResources.ExecutorResources.NvidiaGPU}
+	if executorResources.GreaterThan(availableResources[nodeName]) {
+		return false, nil
+	}
+	if len(sparkResources.ExecutorExtendedResources) > 0 {
+		return s.availableExtendedResources(ctx, nodes).Fits(nodeName, sparkResources.ExecutorExtendedResources), nil
+	}
+	return true, nil
+}
+
+// isBound returns whether the pod is bound to a node according to the api server, as a binding request which timed out
+// may still have succeeded. It assumes the pod is bound if it cannot be read, so that its reservation is kept.
+func (s *SparkSchedulerExtender) isBound(ctx context.Context, pod *v1.Pod) bool {
+	currentPod, err := s.coreClient.Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to get pod which could not be bound, keeping its reservation", svc1log.Stacktrace(err))
+		return true
+	}
+	return currentPod.UID == pod.UID && currentPod.Spec.NodeName != ""
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestBind(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("2-executor-app", 2)
+
+	// the second executor is not known to the api server, so binding it fails
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	for _, pod := range podsToSchedule {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the full application")
+	}
+
+	for _, pod := range podsToSchedule[:2] {
+		if result := testHarness.Bind(pod, node1.Name); result.Error != "" {
+			t.Errorf("Binding %s should succeed, got error: %s", pod.Name, result.Error)
+		}
+	}
+
+	failingExecutor := podsToSchedule[2]
+	if result := testHarness.Bind(failingExecutor, node1.Name); result.Error == "" {
+		t.Fatal("Binding an executor unknown to the api server should fail")
+	}
+	rr, ok := testHarness.ResourceReservationCache.Get(failingExecutor.Namespace, "2-executor-app")
+	if !ok {
+		t.Fatal("Resource reservation should still exist after a failed executor binding")
+	}
+	for reservationName, podName := range rr.Status.Pods {
+		if podName == failingExecutor.Name {
+			t.Errorf("Reservation %s should have been released after a failed binding", reservationName)
+		}
+	}
+	if len(rr.Status.Pods) != 2 {
+		t.Errorf("Driver and bound executor should keep their reservations, got %v", rr.Status.Pods)
+	}
+}
+
+func TestBindMovesExecutorReservationToAnotherNode(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("moved-executor-app", 1)
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&node2,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	for _, pod := range podsToSchedule {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the full application")
+	}
+
+	// node2 holds no reservation of the application, so the executor has to take its reservation along
+	executor := podsToSchedule[1]
+	if result := testHarness.Bind(executor, node2.Name); result.Error != "" {
+		t.Fatalf("Binding the executor to another node should succeed, got error: %s", result.Error)
+	}
+	rr, ok := testHarness.ResourceReservationCache.Get(executor.Namespace, "moved-executor-app")
+	if !ok {
+		t.Fatal("Resource reservation should exist")
+	}
+	for reservationName, podName := range rr.Status.Pods {
+		if podName == executor.Name && rr.Spec.Reservations[reservationName].Node != node2.Name {
+			t.Errorf("Reservation of the executor should have moved to %s, got %s", node2.Name, rr.Spec.Reservations[reservationName].Node)
+		}
+	}
+	if len(rr.Status.Pods) != 2 {
+		t.Errorf("Driver and executor should hold reservations, got %v", rr.Status.Pods)
+	}
+}
+
+func TestBindRejectsExecutorOnNodeWithoutCapacity(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	podsToSchedule := extendertest.StaticAllocationSparkPods("moved-executor-app", 1)
+	fillerApp := extendertest.StaticAllocationSparkPodsWithSizes("filler-app", 1, "1", "4", "1", "4")
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&node2,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+		&fillerApp[0],
+		&fillerApp[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	for _, pod := range podsToSchedule {
+		testHarness.AssertSuccessfulSchedule(t, pod, []string{node1.Name}, "There should be enough capacity to schedule the full application")
+	}
+	for _, pod := range fillerApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, []string{node2.Name}, "There should be enough capacity to schedule the filler application")
+	}
+
+	executor := podsToSchedule[1]
+	if result := testHarness.Bind(executor, node2.Name); result.Error == "" {
+		t.Fatal("Binding the executor to a node without free capacity should fail")
+	}
+	rr, ok := testHarness.ResourceReservationCache.Get(executor.Namespace, "moved-executor-app")
+	if !ok {
+		t.Fatal("Resource reservation should exist")
+	}
+	for reservationName, podName := range rr.Status.Pods {
+		if podName == executor.Name && rr.Spec.Reservations[reservationName].Node != node1.Name {
+			t.Errorf("Reservation of the executor should stay on %s, got %s", node1.Name, rr.Spec.Reservations[reservationName].Node)
+		}
+	}
+}
+
+func TestBindDriverToAnotherNode(t *testing.T) {
+	tests := []struct {
+		name             string
+		fillNode2        bool
+		expectBindResult bool
+		expectedNode     string
+	}{{
+		name:             "the reservation is moved to a node the driver fits on",
+		expectBindResult: true,
+		expectedNode:     "node2",
+	}, {
+		name:             "the binding is rejected on a node the driver does not fit on",
+		fillNode2:        true,
+		expectBindResult: false,
+		expectedNode:     "node1",
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node1 := extendertest.NewNode("node1", "zone1")
+			node2 := extendertest.NewNode("node2", "zone1")
+			driver := extendertest.StaticAllocationSparkPods("moved-driver-app", 0)[0]
+			fillerApp := extendertest.StaticAllocationSparkPodsWithSizes("filler-app", 1, "1", "4", "1", "4")
+
+			testHarness, err := extendertest.NewTestExtender(
+				binpacker.SingleAzTightlyPack,
+				&node1,
+				&node2,
+				&driver,
+				&fillerApp[0],
+				&fillerApp[1],
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+			testHarness.AssertSuccessfulSchedule(t, driver, []string{node1.Name}, "There should be enough capacity to schedule the driver")
+			if test.fillNode2 {
+				for _, pod := range fillerApp {
+					testHarness.AssertSuccessfulSchedule(t, pod, []string{node2.Name}, "There should be enough capacity to schedule the filler application")
+				}
+			}
+
+			if result := testHarness.Bind(driver, node2.Name); (result.Error == "") != test.expectBindResult {
+				t.Fatalf("expected binding to succeed: %v, got error: %s", test.expectBindResult, result.Error)
+			}
+			rr, ok := testHarness.ResourceReservationCache.Get(driver.Namespace, "moved-driver-app")
+			if !ok {
+				t.Fatal("Resource reservation should exist")
+			}
+			if node := rr.Spec.Reservations["driver"].Node; node != test.expectedNode {
+				t.Errorf("Driver should be reserved on %s, got %s", test.expectedNode, node)
+			}
+		})
+	}
+}
+
+func TestBindKeepsReservationWhenFailedBindingSucceeded(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("timed-out-app", 1)
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	testHarness.AssertSuccessfulSchedule(t, podsToSchedule[0], nodeNames, "There should be enough capacity to schedule the driver")
+
+	// the binding goes through, but the response is lost
+	fakeKubeClient := testHarness.KubeClient.(*fake.Clientset)
+	fakeKubeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		createAction, ok := action.(k8stesting.CreateAction)
+		if !ok || createAction.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		binding := createAction.GetObject().(*v1.Binding)
+		podResource := v1.SchemeGroupVersion.WithResource("pods")
+		obj, err := fakeKubeClient.Tracker().Get(podResource, binding.Namespace, binding.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*v1.Pod).DeepCopy()
+		pod.Spec.NodeName = binding.Target.Name
+		if err := fakeKubeClient.Tracker().Update(podResource, pod, binding.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, nil, fmt.Errorf("binding timed out")
+	})
+
+	if result := testHarness.Bind(podsToSchedule[0], node1.Name); result.Error == "" {
+		t.Fatal("Binding should report the lost response")
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(podsToSchedule[0].Namespace, "timed-out-app"); !ok {
+		t.Fatal("Resource reservation of a driver which got bound should be kept")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+
+	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// driverBinpackStrategy returns the binpacker the driver selects through its binpack strategy annotation, if it sets
+// one that is allowed
+func driverBinpackStrategy(ctx context.Context, binpackers *internalbinpacker.InstanceGroupBinpackers, driver *v1.Pod) (*internalbinpacker.Binpacker, bool) {
+	strategy, ok := driver.Annotations[common.BinpackStrategy]
+	if !ok {
+		return nil, false
+	}
+	binpacker, ok := binpackers.AllowedStrategy(strategy)
+	if !ok {
+		svc1log.FromContext(ctx).Warn("ignoring binpack strategy that is not allowed, using the one of the instance group",
+			svc1log.SafeParam("driverName", driver.Name),
+			svc1log.SafeParam("binpackStrategy", strategy))
+		return nil, false
+	}
+	return binpacker, true
+}
+
+// applicationBinpacker returns the binpacker of the driver's application, which is the strategy the driver selects or
+// the given binpacker of its instance group
+func (s *SparkSchedulerExtender) applicationBinpacker(ctx context.Context, driver *v1.Pod, instanceGroupBinpacker *internalbinpacker.Binpacker) *internalbinpacker.Binpacker {
+	if binpacker, ok := driverBinpackStrategy(ctx, s.binpackers, driver); ok {
+		return binpacker
+	}
+	return instanceGroupBinpacker
+}
+
+// reservedBinpacker returns the binpacker of the executor's application, which is the strategy recorded on its
+// resource reservation or the given binpacker of its instance group
+func (s *SparkSchedulerExtender) reservedBinpacker(executor *v1.Pod, instanceGroupBinpacker *internalbinpacker.Binpacker) *internalbinpacker.Binpacker {
+	rr, ok := s.resourceReservations.Get(executor.Namespace, executor.Labels[common.SparkAppIDLabel])
+	if !ok {
+		return instanceGroupBinpacker
+	}
+	if binpacker, ok := internalbinpacker.LookupBinpacker(rr.Annotations[common.BinpackStrategyAnnotation]); ok {
+		return binpacker
+	}
+	return instanceGroupBinpacker
+}
+
+// podBinpacker returns the binpacker of the pod's application for drivers and executors, or the given binpacker of its
+// instance group for other pods
+func (s *SparkSchedulerExtender) podBinpacker(ctx context.Context, pod *v1.Pod, instanceGroupBinpacker *internalbinpacker.Binpacker) *internalbinpacker.Binpacker {
+	switch pod.Labels[common.SparkRoleLabel] {
+	case common.Driver:
+		return s.applicationBinpacker(ctx, pod, instanceGroupBinpacker)
+	case common.Executor:
+		return s.reservedBinpacker(pod, instanceGroupBinpacker)
+	default:
+		return instanceGroupBinpacker
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	werror "github.com/palantir/witchcraft-go-error"
+	v1 "k8s.io/api/core/v1"
+	v1affinityhelper "k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+// DriverExplanation describes how the extender would schedule a driver if it was asked to now
+type DriverExplanation struct {
+	Outcome string `json:"outcome"`
+	// Reason is the reason the driver would fail to schedule, if it would
+	Reason            string                `json:"reason,omitempty"`
+	InstanceGroup     string                `json:"instanceGroup"`
+	DriverResources   *ResourcesExplanation `json:"driverResources,omitempty"`
+	ExecutorResources *ResourcesExplanation `json:"executorResources,omitempty"`
+	MinExecutorCount  int                   `json:"minExecutorCount"`
+	MaxExecutorCount  int                   `json:"maxExecutorCount"`
+	Nodes             []NodeExplanation     `json:"nodes"`
+	DriversAhead      []string              `json:"driversAhead,omitempty"`
+	BlockingDriver    string                `json:"blockingDriver,omitempty"`
+	Placement         *PlacementExplanation `json:"placement,omitempty"`
+	PreemptionVictims []string              `json:"preemptionVictims,omitempty"`
+}
+
+// NodeExplanation holds the resources of a candidate node that are free after overhead and reservations
+type NodeExplanation struct {
+	Name              string               `json:"name"`
+	Free              ResourcesExplanation `json:"free"`
+	FreeExtended      map[string]string    `json:"freeExtended,omitempty"`
+	CandidateDriver   bool                 `json:"candidateDriver"`
+	CandidateExecutor bool                 `json:"candidateExecutor"`
+}
+
+// ResourcesExplanation holds an amount of cpu, memory and nvidia gpus
+type ResourcesExplanation struct {
+	CPU       string `json:"cpu"`
+	Memory    string `json:"memory"`
+	NvidiaGPU string `json:"nvidiaGpu"`
+}
+
+// PlacementExplanation holds the nodes the binpacker placed the driver and its executors on
+type PlacementExplanation struct {
+	HasCapacity   bool     `json:"hasCapacity"`
+	DriverNode    string   `json:"driverNode,omitempty"`
+	ExecutorNodes []string `json:"executorNodes,omitempty"`
+}
+
+// Explain plans the scheduling of the given pending driver without making any reservation, demand or preemption, and
+// describes the outcome. The nodes considered are all nodes matching the driver's required node affinity.
+func (s *SparkSchedulerExtender) Explain(ctx context.Context, namespace, name string) (*DriverExplanation, error) {
+	driver, err := s.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if driver.Labels[common.SparkRoleLabel] != common.Driver {
+		return nil, werror.ErrorWithContextParams(ctx, "pod is not a spark driver")
+	}
+	instanceGroup, _ := internal.FindInstanceGroupFromPodSpec(driver.Spec, s.instanceGroupLabel)
+	explanation := &DriverExplanation{InstanceGroup: instanceGroup}
+
+	if rr, ok := s.resourceReservationManager.GetResourceReservation(driver.Labels[common.SparkAppIDLabel], driver.Namespace); ok {
+		explanation.Outcome = success
+		explanation.Placement = &PlacementExplanation{HasCapacity: true}
+		for reservationName, reservation := range rr.Spec.Reservations {
+			if reservationName == "driver" {
+				explanation.Placement.DriverNode = reservation.Node
+			} else {
+				explanation.Placement.ExecutorNodes = append(explanation.Placement.ExecutorNodes, reservation.Node)
+			}
+		}
+		sort.Strings(explanation.Placement.ExecutorNodes)
+		return explanation, nil
+	}
+
+	nodes, err := utils.ListWithPredicate(s.nodeLister, func(node *v1.Node) (bool, error) {
+		return v1affinityhelper.GetRequiredNodeAffinity(driver).Match(node)
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	// the plan subtracts the usage of earlier drivers from its scheduling context, so free resources are taken from a
+	// separate one
+	sc, err := s.newDriverSchedulingContext(ctx, driver, nodeNames)
+	if err != nil {
+		explanation.Outcome = failureInternal
+		explanation.Reason = err.Error()
+		return explanation, nil
+	}
+	explanation.Nodes = nodeExplanations(sc)
+	explanation.DriverResources = resourcesExplanation(sc.applicationResources.DriverResources)
+	explanation.ExecutorResources = resourcesExplanation(sc.applicationResources.ExecutorResources)
+	explanation.MinExecutorCount = sc.applicationResources.MinExecutorCount
+	explanation.MaxExecutorCount = sc.applicationResources.MaxExecutorCount
+
+	plan, outcome, err := s.planDriver(ctx, instanceGroup, driver, nodeNames)
+	explanation.Outcome = outcome
+	if err != nil {
+		explanation.Reason = err.Error()
+	}
+	if plan == nil {
+		return explanation, nil
+	}
+	for _, earlierDriver := range plan.driversAhead {
+		explanation.DriversAhead = append(explanation.DriversAhead, podKey(earlierDriver))
+	}
+	if plan.blockingDriver != nil {
+		explanation.BlockingDriver = podKey(plan.blockingDriver)
+	}
+	if plan.packingResult != nil {
+		explanation.Placement = &PlacementExplanation{
+			HasCapacity:   plan.packingResult.HasCapacity,
+			DriverNode:    plan.packingResult.DriverNode,
+			ExecutorNodes: plan.packingResult.ExecutorNodes,
+		}
+	}
+	for _, victim := range plan.victims {
+		explanation.PreemptionVictims = append(explanation.PreemptionVictims, victim.namespace+"/"+victim.appID)
+	}
+	return explanation, nil
+}
+
+func nodeExplanations(sc *driverSchedulingContext) []NodeExplanation {
+	candidateDrivers := make(map[string]bool, len(sc.driverNodeNames))
+	for _, name := range sc.driverNodeNames {
+		candidateDrivers[name] = true
+	}
+	candidateExecutors := make(map[string]bool, len(sc.executorNodeNames))
+	for _, name := range sc.executorNodeNames {
+		candidateExecutors[name] = true
+	}
+	explanations := make([]NodeExplanation, 0, len(sc.nodesSchedulingMetadata))
+	for name, metadata := range sc.nodesSchedulingMetadata {
+		explanation := NodeExplanation{
+			Name:              name,
+			Free:              *resourcesExplanation(metadata.AvailableResources),
+			CandidateDriver:   candidateDrivers[name],
+			CandidateExecutor: candidateExecutors[name],
+		}
+		for resourceName, quantity := range sc.availableExtendedResources[name] {
+			if explanation.FreeExtended == nil {
+				explanation.FreeExtended = make(map[string]string)
+			}
+			explanation.FreeExtended[string(resourceName)] = quantity.String()
+		}
+		explanations = append(explanations, explanation)
+	}
+	sort.Slice(explanations, func(i, j int) bool {
+		return explanations[i].Name < explanations[j].Name
+	})
+	return explanations
+}
+
+func resourcesExplanation(r *resources.Resources) *ResourcesExplanation {
+	return &ResourcesExplanation{
+		CPU:       r.CPU.String(),
+		Memory:    r.Memory.String(),
+		NvidiaGPU: r.NvidiaGPU.String(),
+	}
+}
+
+func podKey(pod *v1.Pod) string {
+	return fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+)
+
+func TestExplain(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	blockedApp := backfillSparkPods("blocked-app", "8", 0, "")
+	laterApp := backfillSparkPods("later-app", "1", 1, "")
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&blockedApp[0],
+		&laterApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	explanation, err := testHarness.Extender.Explain(testHarness.Ctx, laterApp[0].Namespace, laterApp[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Outcome != "failure-earlier-driver" {
+		t.Errorf("expected the later driver to wait on the blocked driver, got outcome %v", explanation.Outcome)
+	}
+	if explanation.BlockingDriver != blockedApp[0].Namespace+"/"+blockedApp[0].Name {
+		t.Errorf("expected the blocked driver to block, got %v", explanation.BlockingDriver)
+	}
+	if len(explanation.Nodes) != 1 || explanation.Nodes[0].Free.CPU != "8" {
+		t.Errorf("expected the free resources of node1 to be listed, got %v", explanation.Nodes)
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(laterApp[0].Namespace, "later-app"); ok {
+		t.Error("explaining a driver should not reserve resources")
+	}
+
+	explanation, err = testHarness.Extender.Explain(testHarness.Ctx, blockedApp[0].Namespace, blockedApp[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Outcome != "failure-fit" || explanation.Reason == "" {
+		t.Errorf("expected the blocked driver to not fit with a reason, got outcome %v", explanation.Outcome)
+	}
+	if explanation.Placement == nil || explanation.Placement.HasCapacity {
+		t.Error("expected the attempted placement of the blocked driver to have no capacity")
+	}
+
+	testHarness.AssertFailedSchedule(t, laterApp[0], nodeNames, "The later driver should still wait on the blocked driver")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestExtendedResources(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	for _, node := range []*v1.Node{&node1, &node2} {
+		node.Status.Allocatable["amd.com/gpu"] = resource.MustParse("1")
+	}
+	nodeNames := []string{node1.Name, node2.Name}
+	firstApp := extendedResourceSparkPods("first-app", 2)
+	secondApp := extendedResourceSparkPods("second-app", 1)
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&node2,
+		&firstApp[0],
+		&secondApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.AssertSuccessfulSchedule(t, firstApp[0], nodeNames, "The executors should be spread over the nodes with an amd gpu each")
+	rr, ok := testHarness.ResourceReservationCache.Get(firstApp[0].Namespace, "first-app")
+	if !ok {
+		t.Fatal("The first application should have a reservation")
+	}
+	if rr.Spec.Reservations["executor-1"].Node == rr.Spec.Reservations["executor-2"].Node {
+		t.Error("Executors should not share a node which only has a single amd gpu")
+	}
+	if _, ok := rr.Spec.Reservations["executor-1"].Resources["amd.com/gpu"]; !ok {
+		t.Error("Executor reservations should include their extended resources")
+	}
+	testHarness.AssertFailedSchedule(t, secondApp[0], nodeNames, "All amd gpus are reserved by the first application")
+}
+
+func extendedResourceSparkPods(sparkApplicationID string, numExecutors int) []v1.Pod {
+	pods := extendertest.StaticAllocationSparkPods(sparkApplicationID, numExecutors)
+	pods[0].Annotations[common.ExecutorResourcePrefix+"amd.com/gpu"] = "1"
+	return pods
+}
@@ -28,6 +28,7 @@ import (
 	sscache "github.com/palantir/k8s-spark-scheduler/internal/cache"
 	"github.com/palantir/k8s-spark-scheduler/internal/crd"
 	"github.com/palantir/k8s-spark-scheduler/internal/demands"
+	"github.com/palantir/k8s-spark-scheduler/internal/events"
 	"github.com/palantir/k8s-spark-scheduler/internal/extender"
 	"github.com/palantir/k8s-spark-scheduler/internal/metrics"
 	"github.com/palantir/k8s-spark-scheduler/internal/sort"
@@ -40,7 +41,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	schedulerapi "k8s.io/kube-scheduler/extender/v1"
 )
@@ -52,22 +55,39 @@ const (
 
 // Harness is an extension of an extender with in-memory k8s stores
 type Harness struct {
-	Extender                 *extender.SparkSchedulerExtender
-	UnschedulablePodMarker   *extender.UnschedulablePodMarker
-	PodStore                 cache.Store
-	NodeStore                cache.Store
-	ResourceReservationCache *sscache.ResourceReservationCache
-	SoftReservationStore     *sscache.SoftReservationStore
-	Ctx                      context.Context
+	Extender                   *extender.SparkSchedulerExtender
+	UnschedulablePodMarker     *extender.UnschedulablePodMarker
+	QueuePositionMarker        *extender.QueuePositionMarker
+	PodStore                   cache.Store
+	NodeStore                  cache.Store
+	ResourceReservationCache   *sscache.ResourceReservationCache
+	SoftReservationStore       *sscache.SoftReservationStore
+	ResourceReservationManager extender.ResourceReservationManager
+	SparkApplicationStore      cache.Store
+	InstanceGroupConfigStore   cache.Store
+	KubeClient                 kubernetes.Interface
+	Ctx                        context.Context
 }
 
 // NewTestExtender returns a new extender test harness, initialized with the provided k8s objects
 func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, error) {
+	return NewTestExtenderWithInstallConfig(binpackAlgo, config.Install{}, objects...)
+}
+
+// NewTestExtenderWithInstallConfig behaves like NewTestExtender except that it allows the caller to
+// configure the install config used to build the extender
+func NewTestExtenderWithInstallConfig(binpackAlgo string, installConfig config.Install, objects ...runtime.Object) (*Harness, error) {
 	wlog.SetDefaultLoggerProvider(wlog.NewNoopLoggerProvider()) // suppressing Witchcraft warning log about logger provider
-	ctx := newLoggingContext()
+	installConfig.BinpackAlgo = binpackAlgo
+	installConfig.FIFO = true
+	return NewHarness(newLoggingContext(), installConfig, objects...)
+}
 
-	installConfig := config.Install{}
+// NewHarness returns a new extender harness that logs to the given context, initialized with the provided k8s objects.
+// Unlike NewTestExtenderWithInstallConfig, it takes the binpack algorithm and the FIFO settings from the install config.
+func NewHarness(ctx context.Context, installConfig config.Install, objects ...runtime.Object) (*Harness, error) {
 	fakeKubeClient := fake.NewSimpleClientset(objects...)
+	fakeKubeClient.PrependReactor("create", "pods", bindPodReactor(fakeKubeClient))
 	fakeSchedulerClient := ssclientset.NewSimpleClientset()
 	fakeAPIExtensionsClient := apiextensionsfake.NewSimpleClientset()
 	kubeInformerFactory := informers.NewSharedInformerFactory(fakeKubeClient, 0)
@@ -79,11 +99,27 @@ func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, e
 	podInformer := podInformerInterface.Informer()
 	podLister := podInformerInterface.Lister()
 
+	configMapInformerInterface := kubeInformerFactory.Core().V1().ConfigMaps()
+	configMapInformer := configMapInformerInterface.Informer()
+	var sparkConfReader *extender.SparkConfReader
+	if installConfig.ReadSparkConf {
+		sparkConfReader = extender.NewSparkConfReader(configMapInformerInterface.Lister())
+	}
+	sparkApplicationStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	podEvents := events.NewPodEventRecorder(ctx, fakeKubeClient.CoreV1(), installConfig.PodEvents)
+	var sparkApplicationReader *extender.SparkApplicationReader
+	if installConfig.SparkOperatorIntegration {
+		sparkApplicationReader = extender.NewSparkApplicationReader(sparkApplicationStore, podEvents)
+	}
+
 	sparkSchedulerInformerFactory := ssinformers.NewSharedInformerFactory(fakeSchedulerClient, 0)
 	resourceReservationInformerInterface := sparkSchedulerInformerFactory.Sparkscheduler().V1beta2().ResourceReservations()
 	resourceReservationInformer := resourceReservationInformerInterface.Informer()
 
-	instanceGroupLabel := "resource_channel"
+	instanceGroupLabel := installConfig.InstanceGroupLabel
+	if instanceGroupLabel == "" {
+		instanceGroupLabel = "resource_channel"
+	}
 
 	go func() {
 		kubeInformerFactory.Start(ctx.Done())
@@ -96,6 +132,7 @@ func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, e
 		ctx.Done(),
 		nodeInformer.HasSynced,
 		podInformer.HasSynced,
+		configMapInformer.HasSynced,
 		resourceReservationInformer.HasSynced)
 
 	resourceReservationCache, err := sscache.NewResourceReservationCache(
@@ -119,8 +156,8 @@ func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, e
 	)
 	softReservationStore := sscache.NewSoftReservationStore(ctx, podInformerInterface)
 
-	sparkPodLister := extender.NewSparkPodLister(podLister, instanceGroupLabel)
-	resourceReservationManager := extender.NewResourceReservationManager(ctx, resourceReservationCache, softReservationStore, sparkPodLister, podInformerInterface)
+	sparkPodLister := extender.NewSparkPodLister(podLister, instanceGroupLabel, sparkConfReader, sparkApplicationReader)
+	resourceReservationManager := extender.NewResourceReservationManager(ctx, resourceReservationCache, softReservationStore, sparkPodLister, podInformerInterface, installConfig.PersistSoftReservations)
 
 	overheadComputer := extender.NewOverheadComputer(
 		ctx,
@@ -129,14 +166,37 @@ func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, e
 		nodeLister,
 	)
 
-	isFIFO := true
-	fifoConfig := config.FifoConfig{}
-	binpacker := binpacker.SelectBinpacker(binpackAlgo)
+	isFIFO := installConfig.FIFO
+	fifoConfig := installConfig.FifoConfig
 	shouldScheduleDynamicallyAllocatedExecutorsInSameAZ := true
 
 	wasteMetricsReporter := metrics.NewWasteMetricsReporter(ctx, instanceGroupLabel)
 
-	demandManager := demands.NewDefaultManager(demandCache, binpacker, instanceGroupLabel)
+	queueQuotas, err := extender.NewQueueQuotas(installConfig.QueuesConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceGroupConfigStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	var instanceGroupConfigs *extender.InstanceGroupConfigs
+	if installConfig.InstanceGroupConfigs {
+		instanceGroupConfigs = extender.NewInstanceGroupConfigs(instanceGroupConfigStore, instanceGroupLabel, nil, nil)
+	}
+
+	var binpackerOverride binpacker.Override
+	if instanceGroupConfigs != nil {
+		binpackerOverride = instanceGroupConfigs.Binpacker
+	}
+	binpackers, err := binpacker.NewInstanceGroupBinpackers(
+		installConfig.BinpackAlgo,
+		installConfig.BinpackAlgoByInstanceGroup,
+		installConfig.AllowedBinpackStrategies,
+		binpackerOverride)
+	if err != nil {
+		return nil, err
+	}
+
+	demandManager := demands.NewDefaultManager(demandCache, binpackers, instanceGroupLabel, podEvents)
 	sparkSchedulerExtender := extender.NewExtender(
 		nodeLister,
 		sparkPodLister,
@@ -148,30 +208,44 @@ func NewTestExtender(binpackAlgo string, objects ...runtime.Object) (*Harness, e
 		fakeAPIExtensionsClient,
 		isFIFO,
 		fifoConfig,
-		binpacker,
+		installConfig.DriverOrderingConfig,
+		binpackers,
 		shouldScheduleDynamicallyAllocatedExecutorsInSameAZ,
 		overheadComputer,
 		instanceGroupLabel,
 		sort.NewNodeSorter(nil, nil),
 		wasteMetricsReporter,
+		installConfig.UseExtenderAsScorer,
+		installConfig.EnablePreemption,
+		installConfig.LeaderElection.Enabled,
+		queueQuotas,
+		instanceGroupConfigs,
+		podEvents,
 	)
+	sparkSchedulerExtender.StartIncrementalReconciliation(ctx, podInformerInterface, resourceReservationInformerInterface)
 
 	unschedulablePodMarker := extender.NewUnschedulablePodMarker(
 		nodeLister,
-		podLister,
+		sparkPodLister,
 		fakeKubeClient.CoreV1(),
 		overheadComputer,
-		binpacker,
-		installConfig.UnschedulablePodTimeoutDuration)
+		sparkSchedulerExtender,
+		installConfig.UnschedulablePodTimeoutDuration,
+		podEvents)
 
 	return &Harness{
-		Extender:                 sparkSchedulerExtender,
-		UnschedulablePodMarker:   unschedulablePodMarker,
-		PodStore:                 podInformer.GetStore(),
-		NodeStore:                nodeInformer.GetStore(),
-		ResourceReservationCache: resourceReservationCache,
-		SoftReservationStore:     softReservationStore,
-		Ctx:                      ctx,
+		Extender:                   sparkSchedulerExtender,
+		UnschedulablePodMarker:     unschedulablePodMarker,
+		QueuePositionMarker:        extender.NewQueuePositionMarker(sparkSchedulerExtender, fakeKubeClient.CoreV1()),
+		PodStore:                   podInformer.GetStore(),
+		NodeStore:                  nodeInformer.GetStore(),
+		ResourceReservationCache:   resourceReservationCache,
+		SoftReservationStore:       softReservationStore,
+		ResourceReservationManager: resourceReservationManager,
+		SparkApplicationStore:      sparkApplicationStore,
+		InstanceGroupConfigStore:   instanceGroupConfigStore,
+		KubeClient:                 fakeKubeClient,
+		Ctx:                        ctx,
 	}, nil
 }
 
@@ -192,6 +266,48 @@ func (h *Harness) Schedule(t *testing.T, pod v1.Pod, nodeNames []string) *schedu
 	return extenderPredicateResult
 }
 
+// Prioritize calls the extender's Prioritize method for the given pod and nodes and returns the scores by node name
+func (h *Harness) Prioritize(pod v1.Pod, nodeNames []string) map[string]int64 {
+	priorities := h.Extender.Prioritize(h.Ctx, schedulerapi.ExtenderArgs{
+		Pod:       &pod,
+		NodeNames: &nodeNames,
+	})
+	scores := make(map[string]int64, len(*priorities))
+	for _, priority := range *priorities {
+		scores[priority.Host] = priority.Score
+	}
+	return scores
+}
+
+// Bind calls the extender's Bind method for the given pod and node
+func (h *Harness) Bind(pod v1.Pod, nodeName string) *schedulerapi.ExtenderBindingResult {
+	return h.Extender.Bind(h.Ctx, schedulerapi.ExtenderBindingArgs{
+		PodName:      pod.Name,
+		PodNamespace: pod.Namespace,
+		PodUID:       pod.UID,
+		Node:         nodeName,
+	})
+}
+
+// bindPodReactor handles pod bindings in the fake client by setting the node name of the bound pod
+func bindPodReactor(fakeKubeClient *fake.Clientset) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		createAction, ok := action.(k8stesting.CreateAction)
+		if !ok || createAction.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		binding := createAction.GetObject().(*v1.Binding)
+		podResource := v1.SchemeGroupVersion.WithResource("pods")
+		obj, err := fakeKubeClient.Tracker().Get(podResource, binding.Namespace, binding.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*v1.Pod).DeepCopy()
+		pod.Spec.NodeName = binding.Target.Name
+		return true, nil, fakeKubeClient.Tracker().Update(podResource, pod, binding.Namespace)
+	}
+}
+
 // TerminatePod terminates an existing pod
 func (h *Harness) TerminatePod(pod v1.Pod) error {
 	termination := v1.ContainerStateTerminated{
@@ -22,6 +22,7 @@ import (
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
 	"github.com/palantir/k8s-spark-scheduler/internal"
+	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
 	"github.com/palantir/k8s-spark-scheduler/internal/cache"
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
@@ -40,32 +41,29 @@ import (
 // they now reflect the current state of the world. This is needed on a leader failover,
 // as async writes for resource reservation objects mean some writes will be lost on
 // leader change, so the extender needs to call this before accepting requests.
+// Persisted soft reservations are restored first, so that only the extra executors
+// they do not account for are given soft reservations heuristically.
+// Applications changing afterwards are reconciled incrementally, see reconcilePendingApplications.
+// It has to be called while holding reconciliationLock.
 func (s *SparkSchedulerExtender) syncResourceReservationsAndDemands(ctx context.Context) error {
+	s.pendingApplications.clear()
+
+	s.resourceReservationManager.RestoreSoftReservations(ctx)
 	pods, err := s.podLister.List(labels.Everything())
 	if err != nil {
 		return err
 	}
-	nodes, err := s.nodeLister.List(labels.Everything())
+	drivers, err := s.podLister.List(labels.Set(map[string]string{common.SparkRoleLabel: common.Driver}).AsSelector())
 	if err != nil {
+		return werror.Wrap(err, "failed to list drivers")
+	}
+	r := s.newReconciler()
+	if err := s.loadAvailableResources(ctx, r); err != nil {
 		return err
 	}
-	rrs := s.resourceReservations.List()
-	overhead := s.overheadComputer.GetOverhead(ctx, nodes)
-	softReservationOverhead := s.softReservationStore.UsedSoftReservationResources()
-	availableResources, orderedNodes := availableResourcesPerInstanceGroup(s.instanceGroupLabel, rrs, nodes, overhead, softReservationOverhead)
-	staleSparkPods := unreservedSparkPodsBySparkID(ctx, rrs, s.softReservationStore, pods)
+	staleSparkPods := unreservedSparkPodsBySparkID(ctx, s.resourceReservations.List(), s.softReservationStore, pods)
 	svc1log.FromContext(ctx).Info("starting reconciliation", svc1log.SafeParam("appCount", len(staleSparkPods)))
 
-	r := &reconciler{
-		podLister:            s.podLister,
-		resourceReservations: s.resourceReservations,
-		softReservations:     s.softReservationStore,
-		demands:              s.demandsManager,
-		availableResources:   availableResources,
-		orderedNodes:         orderedNodes,
-		instanceGroupLabel:   s.instanceGroupLabel,
-	}
-
 	extraExecutorsWithNoRRs := make(map[string][]*v1.Pod)
 	for _, sp := range staleSparkPods {
 		extraExecutors := r.syncResourceReservations(ctx, sp)
@@ -74,10 +72,38 @@ func (s *SparkSchedulerExtender) syncResourceReservationsAndDemands(ctx context.
 		}
 		r.syncDemands(ctx, sp)
 	}
-	err = r.syncSoftReservations(ctx, extraExecutorsWithNoRRs)
+	r.syncSoftReservations(ctx, drivers, extraExecutorsWithNoRRs)
+	for appID, extraExecutors := range extraExecutorsWithNoRRs {
+		s.resourceReservationManager.PersistSoftReservation(ctx, appID, extraExecutors[0].Namespace)
+	}
+	return nil
+}
+
+func (s *SparkSchedulerExtender) newReconciler() *reconciler {
+	return &reconciler{
+		podLister:            s.podLister,
+		resourceReservations: s.resourceReservations,
+		softReservations:     s.softReservationStore,
+		demands:              s.demandsManager,
+		instanceGroupLabel:   s.instanceGroupLabel,
+		binpackers:           s.binpackers,
+	}
+}
+
+// loadAvailableResources computes the resources available in every instance group, which the reconciler needs to
+// create resource reservations for drivers that do not have one
+func (s *SparkSchedulerExtender) loadAvailableResources(ctx context.Context, r *reconciler) error {
+	nodes, err := s.nodeLister.List(labels.Everything())
 	if err != nil {
-		return nil
+		return err
+	}
+	rrs := s.resourceReservations.List()
+	overhead := s.overheadComputer.GetOverhead(ctx, nodes)
+	softReservationOverhead := s.softReservationStore.UsedSoftReservationResources()
+	overcommittedNodes := func(instanceGroup string, nodes []*v1.Node) []*v1.Node {
+		return s.instanceGroupSettings(ctx, instanceGroup).overcommittedNodes(nodes)
 	}
+	r.availableResources, r.orderedNodes = availableResourcesPerInstanceGroup(s.instanceGroupLabel, rrs, nodes, overhead, softReservationOverhead, overcommittedNodes)
 	return nil
 }
 
@@ -100,6 +126,7 @@ type reconciler struct {
 	availableResources   map[instanceGroup]resources.NodeGroupResources
 	orderedNodes         map[instanceGroup][]*v1.Node
 	instanceGroupLabel   string
+	binpackers           *internalbinpacker.InstanceGroupBinpackers
 }
 
 func (r *reconciler) syncResourceReservations(ctx context.Context, sp *sparkPods) []*v1.Pod {
@@ -113,7 +140,7 @@ func (r *reconciler) syncResourceReservations(ctx context.Context, sp *sparkPods
 			logRR(ctx, "resource reservation deleted, ignoring", exec.Namespace, sp.appID)
 			return nil
 		}
-		newRR, err := r.patchResourceReservation(sp.inconsistentExecutors, rr.DeepCopy())
+		newRR, err := r.patchResourceReservation(ctx, sp.inconsistentExecutors, rr.DeepCopy())
 		if err != nil {
 			logRR(ctx, "resource reservation deleted, ignoring", exec.Namespace, sp.appID)
 			return nil
@@ -147,10 +174,10 @@ func (r *reconciler) syncResourceReservations(ctx context.Context, sp *sparkPods
 			svc1log.FromContext(ctx).Error("failed to construct resource reservation", svc1log.Stacktrace(err))
 			return nil
 		}
-		err = r.resourceReservations.Create(newRR)
+		err = r.resourceReservations.Create(ctx, newRR)
 		if err != nil {
 			logRR(ctx, "resource reservation already exists, force updating", sp.inconsistentDriver.Namespace, sp.appID)
-			updateErr := r.resourceReservations.Update(newRR)
+			updateErr := r.resourceReservations.Update(ctx, newRR)
 			if updateErr != nil {
 				logRR(ctx, "resource reservation deleted, ignoring", sp.inconsistentDriver.Namespace, sp.appID)
 				return nil
@@ -171,12 +198,9 @@ func (r *reconciler) syncDemands(ctx context.Context, sp *sparkPods) {
 	}
 }
 
-func (r *reconciler) syncSoftReservations(ctx context.Context, extraExecutorsByApp map[string][]*v1.Pod) error {
+func (r *reconciler) syncSoftReservations(ctx context.Context, drivers []*v1.Pod, extraExecutorsByApp map[string][]*v1.Pod) {
 	// Initialize SoftReservationStore with dynamic allocation applications currently running
-	err := r.syncApplicationSoftReservations(ctx)
-	if err != nil {
-		return err
-	}
+	r.syncApplicationSoftReservations(ctx, drivers)
 
 	// Sync executors
 	for appID, extraExecutors := range extraExecutorsByApp {
@@ -185,7 +209,7 @@ func (r *reconciler) syncSoftReservations(ctx context.Context, extraExecutorsByA
 			svc1log.FromContext(ctx).Error("Error getting driver pod for executor, skipping...", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
 			continue
 		}
-		applicationResources, err := sparkResources(ctx, driver)
+		applicationResources, err := r.podLister.sparkResources(ctx, driver)
 		if err != nil {
 			svc1log.FromContext(ctx).Error("Error getting spark resources for application, skipping...", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
 			continue
@@ -196,35 +220,24 @@ func (r *reconciler) syncSoftReservations(ctx context.Context, extraExecutorsByA
 				break
 			}
 			err := r.softReservations.AddReservationForPod(ctx, appID, extraExecutor.Name, v1beta2.Reservation{
-				Node: extraExecutor.Spec.NodeName,
-				Resources: v1beta2.ResourceList{
-					string(v1beta2.ResourceCPU):       &applicationResources.ExecutorResources.CPU,
-					string(v1beta2.ResourceMemory):    &applicationResources.ExecutorResources.Memory,
-					string(v1beta2.ResourceNvidiaGPU): &applicationResources.ExecutorResources.NvidiaGPU,
-				},
+				Node:      extraExecutor.Spec.NodeName,
+				Resources: reservationResources(applicationResources.ExecutorResources, applicationResources.ExecutorExtendedResources),
 			})
 			if err != nil {
 				svc1log.FromContext(ctx).Error("failed to add soft reservation for executor on failover. skipping...", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
 			}
 		}
 	}
-	return nil
 }
 
 // syncApplicationSoftReservations creates empty SoftReservations for all applications that can have extra executors in dynamic allocation
 // in order to prefill the SoftReservationStore with the drivers currently running
-func (r *reconciler) syncApplicationSoftReservations(ctx context.Context) error {
-	selector := labels.Set(map[string]string{common.SparkRoleLabel: common.Driver}).AsSelector()
-	drivers, err := r.podLister.List(selector)
-	if err != nil {
-		return werror.Wrap(err, "failed to list drivers")
-	}
-
+func (r *reconciler) syncApplicationSoftReservations(ctx context.Context, drivers []*v1.Pod) {
 	for _, d := range drivers {
 		if d.Spec.SchedulerName != common.SparkSchedulerName || d.Spec.NodeName == "" || d.Status.Phase == v1.PodSucceeded || d.Status.Phase == v1.PodFailed {
 			continue
 		}
-		appResources, err := sparkResources(ctx, d)
+		appResources, err := r.podLister.sparkResources(ctx, d)
 		if err != nil {
 			svc1log.FromContext(ctx).Error("failed to get driver resources, skipping driver",
 				svc1log.SafeParam("faultyDriverName", d.Name),
@@ -237,7 +250,6 @@ func (r *reconciler) syncApplicationSoftReservations(ctx context.Context) error
 			r.softReservations.CreateSoftReservationIfNotExists(d.Labels[common.SparkAppIDLabel])
 		}
 	}
-	return nil
 }
 
 func unreservedSparkPodsBySparkID(
@@ -288,7 +300,8 @@ func availableResourcesPerInstanceGroup(
 	rrs []*v1beta2.ResourceReservation,
 	nodes []*v1.Node,
 	overhead resources.NodeGroupResources,
-	softReservationOverhead resources.NodeGroupResources) (map[instanceGroup]resources.NodeGroupResources, map[instanceGroup][]*v1.Node) {
+	softReservationOverhead resources.NodeGroupResources,
+	overcommittedNodes func(instanceGroup string, nodes []*v1.Node) []*v1.Node) (map[instanceGroup]resources.NodeGroupResources, map[instanceGroup][]*v1.Node) {
 	sort.Slice(nodes, func(i, j int) bool {
 		return nodes[j].CreationTimestamp.Before(&nodes[i].CreationTimestamp)
 	})
@@ -317,13 +330,13 @@ func availableResourcesPerInstanceGroup(
 	usages.Add(softReservationOverhead)
 	availableResources := make(map[instanceGroup]resources.NodeGroupResources)
 	for instanceGroup, ns := range schedulableNodes {
-		availableResources[instanceGroup] = resources.AvailableForNodes(ns, usages)
+		availableResources[instanceGroup] = resources.AvailableForNodes(overcommittedNodes(string(instanceGroup), ns), usages)
 	}
 	return availableResources, schedulableNodes
 }
 
 // patchResourceReservation gets a stale resource reservation and updates its status to reflect all given executors
-func (r *reconciler) patchResourceReservation(execs []*v1.Pod, rr *v1beta2.ResourceReservation) (*v1beta2.ResourceReservation, error) {
+func (r *reconciler) patchResourceReservation(ctx context.Context, execs []*v1.Pod, rr *v1beta2.ResourceReservation) (*v1beta2.ResourceReservation, error) {
 	for _, e := range execs {
 		for name, reservation := range rr.Spec.Reservations {
 			if reservation.Node != e.Spec.NodeName {
@@ -342,7 +355,7 @@ func (r *reconciler) patchResourceReservation(execs []*v1.Pod, rr *v1beta2.Resou
 		}
 	}
 
-	return rr, r.resourceReservations.Update(rr)
+	return rr, r.resourceReservations.Update(ctx, rr)
 }
 
 func (r *reconciler) constructResourceReservation(
@@ -350,7 +363,7 @@ func (r *reconciler) constructResourceReservation(
 	driver *v1.Pod,
 	executors []*v1.Pod,
 	instanceGroup instanceGroup) (*v1beta2.ResourceReservation, resources.NodeGroupResources, error) {
-	applicationResources, err := sparkResources(ctx, driver)
+	applicationResources, err := r.podLister.sparkResources(ctx, driver)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -377,12 +390,16 @@ func (r *reconciler) constructResourceReservation(
 		executorNodes = append(executorNodes, e.Spec.NodeName)
 	}
 	executorNodes = append(executorNodes, reservedNodeNames...)
+	binpackStrategy := ""
+	if strategy, ok := driverBinpackStrategy(ctx, r.binpackers, driver); ok {
+		binpackStrategy = strategy.Name
+	}
 	rr := newResourceReservation(
 		driver.Spec.NodeName,
 		executorNodes,
 		driver,
-		applicationResources.DriverResources,
-		applicationResources.ExecutorResources)
+		applicationResources,
+		binpackStrategy)
 	for i, e := range executors {
 		rr.Status.Pods[executorReservationName(i)] = e.Name
 	}
@@ -403,7 +420,7 @@ func (r *reconciler) getAppResources(ctx context.Context, sp *sparkPods) (*types
 	} else {
 		return nil, werror.Error("no inconsistent driver or executor")
 	}
-	return sparkResources(ctx, driver)
+	return r.podLister.sparkResources(ctx, driver)
 }
 
 // findNodes reserves space for n executors, picks nodes by the iterating
@@ -0,0 +1,209 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRestorePersistedSoftReservations(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name, node2.Name}
+	appID := "dynamic-allocation-app"
+	pods := extendertest.DynamicAllocationSparkPods(appID, 1, 3)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{PersistSoftReservations: true},
+		&node1,
+		&node2,
+		&pods[0],
+		&pods[1],
+		&pods[2],
+		&pods[3],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	for _, pod := range pods {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the application")
+	}
+	rr, ok := testHarness.ResourceReservationCache.Get(pods[0].Namespace, appID)
+	if !ok {
+		t.Fatal("expected a resource reservation for the application")
+	}
+	if _, ok := rr.Annotations[common.SoftReservationsAnnotation]; !ok {
+		t.Fatal("expected the soft reservations to be persisted on the resource reservation")
+	}
+	persisted, _ := testHarness.SoftReservationStore.GetSoftReservation(appID)
+	if len(persisted.Reservations) != 2 {
+		t.Fatalf("expected 2 soft reservations, got %+v", persisted.Reservations)
+	}
+
+	// a new leader starts with an empty store, and executor-2 dies while there is no leader
+	testHarness.SoftReservationStore.RemoveDriverReservation(appID)
+	if err := testHarness.TerminatePod(pods[3]); err != nil {
+		t.Fatal("Could not terminate pod in test extender")
+	}
+	testHarness.ResourceReservationManager.RestoreSoftReservations(testHarness.Ctx)
+
+	restored, ok := testHarness.SoftReservationStore.GetSoftReservation(appID)
+	if !ok {
+		t.Fatal("expected the soft reservation to be restored")
+	}
+	if _, ok := restored.Reservations[executor(appID, 1)]; !ok || len(restored.Reservations) != 1 {
+		t.Errorf("expected the soft reservations of active executors to be restored, got %+v", restored.Reservations)
+	}
+	for podName, reservation := range restored.Reservations {
+		expected := persisted.Reservations[podName]
+		if reservation.Node != expected.Node || len(reservation.Resources) != len(expected.Resources) {
+			t.Errorf("expected the restored soft reservation of %s to be %+v, got %+v", podName, expected, reservation)
+			continue
+		}
+		for name, quantity := range expected.Resources {
+			if restoredQuantity, ok := reservation.Resources[name]; !ok || restoredQuantity.Cmp(*quantity) != 0 {
+				t.Errorf("expected the restored soft reservation of %s to reserve %v of %s, got %v", podName, quantity.String(), name, restoredQuantity.String())
+			}
+		}
+	}
+	expectedStatus := map[string]bool{executor(appID, 1): true, executor(appID, 2): false}
+	if !reflect.DeepEqual(restored.Status, expectedStatus) {
+		t.Errorf("expected the dead executor to be remembered, got %+v", restored.Status)
+	}
+}
+
+func TestStandbyRejectsPredicatesUntilElected(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	pods := extendertest.StaticAllocationSparkPods("standby-app", 1)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{LeaderElection: config.LeaderElectionConfig{Enabled: true}},
+		&node1,
+		&pods[0],
+		&pods[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	result := testHarness.Schedule(t, pods[0], nodeNames)
+	if result.NodeNames != nil || !strings.Contains(result.FailedNodes[node1.Name], "not the leader") {
+		t.Fatalf("a standby should reject predicates, got %+v", result)
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(pods[0].Namespace, "standby-app"); ok {
+		t.Fatal("a standby should not reserve resources")
+	}
+	if bindResult := testHarness.Bind(pods[0], node1.Name); !strings.Contains(bindResult.Error, "not the leader") {
+		t.Fatalf("a standby should reject bindings, got %+v", bindResult)
+	}
+
+	testHarness.Extender.StartLeading(testHarness.Ctx)
+	for _, pod := range pods {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "the elected replica should schedule the application")
+	}
+
+	testHarness.Extender.StopLeading(testHarness.Ctx)
+	testHarness.AssertFailedSchedule(t, pods[0], nodeNames, "a replica which lost the election should reject predicates")
+}
+
+func TestReconcileApplicationsScheduledAfterFullReconciliation(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	scheduledApp := extendertest.StaticAllocationSparkPods("scheduled-app", 1)
+	lostApp := extendertest.StaticAllocationSparkPods("lost-app", 1)
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&scheduledApp[0],
+		&scheduledApp[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	testHarness.AssertSuccessfulSchedule(t, scheduledApp[0], nodeNames, "There should be enough capacity to schedule the driver")
+
+	// lost-app was scheduled by another replica whose writes of its resource reservation were lost
+	for i := range lostApp {
+		lostApp[i].Spec.SchedulerName = common.SparkSchedulerName
+		lostApp[i].Spec.NodeName = node1.Name
+		if _, err := testHarness.KubeClient.CoreV1().Pods(lostApp[i].Namespace).Create(testHarness.Ctx, &lostApp[i], metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, exists, err := testHarness.PodStore.Get(&lostApp[1])
+		return exists, err
+	})
+	if err != nil {
+		t.Fatal("the pods of the lost application should be observed")
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(lostApp[0].Namespace, "lost-app"); ok {
+		t.Fatal("the lost application should not have a resource reservation before it is reconciled")
+	}
+
+	testHarness.AssertSuccessfulSchedule(t, scheduledApp[1], nodeNames, "There should be enough capacity to schedule the executor")
+	rr, ok := testHarness.ResourceReservationCache.Get(lostApp[0].Namespace, "lost-app")
+	if !ok {
+		t.Fatal("the lost application should be reconciled on the next scheduling request")
+	}
+	expectedPods := map[string]string{"driver": lostApp[0].Name, "executor-1": lostApp[1].Name}
+	if !reflect.DeepEqual(rr.Status.Pods, expectedPods) {
+		t.Errorf("expected the reservations of the lost application to be claimed by its pods, got %+v", rr.Status.Pods)
+	}
+}
+
+func TestReconcileApplicationsWithoutSchedulingRequests(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	lostApp := extendertest.StaticAllocationSparkPods("lost-app", 1)
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	// lost-app was scheduled by another replica whose writes of its resource reservation were lost
+	for i := range lostApp {
+		lostApp[i].Spec.SchedulerName = common.SparkSchedulerName
+		lostApp[i].Spec.NodeName = node1.Name
+		if _, err := testHarness.KubeClient.CoreV1().Pods(lostApp[i].Namespace).Create(testHarness.Ctx, &lostApp[i], metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = wait.PollImmediate(100*time.Millisecond, 15*time.Second, func() (bool, error) {
+		_, ok := testHarness.ResourceReservationCache.Get(lostApp[0].Namespace, "lost-app")
+		return ok, nil
+	})
+	if err != nil {
+		t.Fatal("the lost application should be reconciled in the background without leader election")
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	ns "github.com/palantir/k8s-spark-scheduler/internal/sort"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientcache "k8s.io/client-go/tools/cache"
+)
+
+// instanceGroupSettings are the settings the extender schedules the pods of an instance group with
+type instanceGroupSettings struct {
+	binpacker            *internalbinpacker.Binpacker
+	isFIFO               bool
+	enforceAfterPodAge   time.Duration
+	driverOrderingPolicy string
+	nodeSorter           *ns.NodeSorter
+	queueQuotas          *QueueQuotas
+	cpuOvercommit        float64
+	memoryOvercommit     float64
+}
+
+// shouldSkipDriverFifo returns whether a driver which does not fit is still too young to block later drivers
+func (settings *instanceGroupSettings) shouldSkipDriverFifo(pod *v1.Pod) bool {
+	return pod.CreationTimestamp.Add(settings.enforceAfterPodAge).After(time.Now())
+}
+
+// overcommittedNodes returns the nodes with their allocatable cpu and memory scaled by the overcommit ratios
+func (settings *instanceGroupSettings) overcommittedNodes(nodes []*v1.Node) []*v1.Node {
+	if settings.cpuOvercommit == 1 && settings.memoryOvercommit == 1 {
+		return nodes
+	}
+	result := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		node = node.DeepCopy()
+		if cpu, ok := node.Status.Allocatable[v1.ResourceCPU]; ok {
+			node.Status.Allocatable[v1.ResourceCPU] = *resource.NewMilliQuantity(int64(float64(cpu.MilliValue())*settings.cpuOvercommit), cpu.Format)
+		}
+		if memory, ok := node.Status.Allocatable[v1.ResourceMemory]; ok {
+			node.Status.Allocatable[v1.ResourceMemory] = *resource.NewQuantity(int64(float64(memory.Value())*settings.memoryOvercommit), memory.Format)
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// instanceGroupSettings returns the settings of the given instance group, which are the ones of the install
+// configuration unless an InstanceGroupConfig overrides them
+func (s *SparkSchedulerExtender) instanceGroupSettings(ctx context.Context, instanceGroup string) *instanceGroupSettings {
+	enforceAfterPodAge := s.fifoConfig.DefaultEnforceAfterPodAge
+	if instanceGroupEnforceAfterPodAge, ok := s.fifoConfig.EnforceAfterPodAgeByInstanceGroup[instanceGroup]; ok {
+		enforceAfterPodAge = instanceGroupEnforceAfterPodAge
+	}
+	driverOrderingPolicy := s.driverOrderingConfig.DefaultPolicy
+	if instanceGroupPolicy, ok := s.driverOrderingConfig.PolicyByInstanceGroup[instanceGroup]; ok {
+		driverOrderingPolicy = instanceGroupPolicy
+	}
+	settings := &instanceGroupSettings{
+		binpacker:            s.binpackers.ForInstanceGroup(ctx, instanceGroup),
+		isFIFO:               s.isFIFO,
+		enforceAfterPodAge:   enforceAfterPodAge,
+		driverOrderingPolicy: driverOrderingPolicy,
+		nodeSorter:           s.nodeSorter,
+		queueQuotas:          s.queueQuotas,
+		cpuOvercommit:        1,
+		memoryOvercommit:     1,
+	}
+	if s.instanceGroupConfigs != nil {
+		s.instanceGroupConfigs.apply(ctx, instanceGroup, settings)
+	}
+	return settings
+}
+
+// podInstanceGroupSettings returns the settings of the instance group the given pod is scheduled to
+func (s *SparkSchedulerExtender) podInstanceGroupSettings(ctx context.Context, pod *v1.Pod) *instanceGroupSettings {
+	instanceGroup, _ := internal.FindInstanceGroupFromPodSpec(pod.Spec, s.instanceGroupLabel)
+	return s.instanceGroupSettings(ctx, instanceGroup)
+}
+
+// InstanceGroupConfigs reads the settings of instance groups from their InstanceGroupConfig, so that they are applied
+// as soon as the informer observes a change
+type InstanceGroupConfigs struct {
+	instanceGroupConfigs         clientcache.Store
+	instanceGroupLabel           string
+	driverPrioritizedNodeLabel   *config.LabelPriorityOrder
+	executorPrioritizedNodeLabel *config.LabelPriorityOrder
+	parsedLock                   sync.Mutex
+	parsed                       map[string]*parsedInstanceGroupConfig
+}
+
+// parsedInstanceGroupConfig caches the settings parsed from a version of an InstanceGroupConfig, spec is nil if the
+// version is invalid
+type parsedInstanceGroupConfig struct {
+	resourceVersion string
+	spec            *types.InstanceGroupConfigSpec
+	binpacker       *internalbinpacker.Binpacker
+	nodeSorter      *ns.NodeSorter
+	queueQuotas     *QueueQuotas
+}
+
+// NewInstanceGroupConfigs creates a new InstanceGroupConfigs over a store of unstructured InstanceGroupConfigs. The
+// node priority labels of the install configuration are used for the roles an InstanceGroupConfig does not set.
+func NewInstanceGroupConfigs(
+	instanceGroupConfigs clientcache.Store,
+	instanceGroupLabel string,
+	driverPrioritizedNodeLabel *config.LabelPriorityOrder,
+	executorPrioritizedNodeLabel *config.LabelPriorityOrder) *InstanceGroupConfigs {
+	return &InstanceGroupConfigs{
+		instanceGroupConfigs:         instanceGroupConfigs,
+		instanceGroupLabel:           instanceGroupLabel,
+		driverPrioritizedNodeLabel:   driverPrioritizedNodeLabel,
+		executorPrioritizedNodeLabel: executorPrioritizedNodeLabel,
+		parsed:                       make(map[string]*parsedInstanceGroupConfig),
+	}
+}
+
+// apply overrides the given settings with the ones the InstanceGroupConfig of the instance group sets, if any
+func (c *InstanceGroupConfigs) apply(ctx context.Context, instanceGroup string, settings *instanceGroupSettings) {
+	parsed, ok := c.get(ctx, instanceGroup)
+	if !ok || parsed.spec == nil {
+		return
+	}
+	spec := parsed.spec
+	if parsed.binpacker != nil {
+		settings.binpacker = parsed.binpacker
+	}
+	if spec.FIFO != nil {
+		settings.isFIFO = *spec.FIFO
+	}
+	if spec.FIFOEnforceAfterPodAge != nil {
+		settings.enforceAfterPodAge = spec.FIFOEnforceAfterPodAge.Duration
+	}
+	if spec.DriverOrderingPolicy != nil {
+		settings.driverOrderingPolicy = *spec.DriverOrderingPolicy
+	}
+	if parsed.nodeSorter != nil {
+		settings.nodeSorter = parsed.nodeSorter
+	}
+	if parsed.queueQuotas != nil {
+		settings.queueQuotas = parsed.queueQuotas
+	}
+	if spec.Overcommit != nil && spec.Overcommit.CPU != nil {
+		settings.cpuOvercommit = *spec.Overcommit.CPU
+	}
+	if spec.Overcommit != nil && spec.Overcommit.Memory != nil {
+		settings.memoryOvercommit = *spec.Overcommit.Memory
+	}
+}
+
+// Binpacker returns the binpacker the InstanceGroupConfig of the instance group sets, if any. It is meant to be the
+// override of the binpackers of instance groups.
+func (c *InstanceGroupConfigs) Binpacker(ctx context.Context, instanceGroup string) (*internalbinpacker.Binpacker, bool) {
+	parsed, ok := c.get(ctx, instanceGroup)
+	if !ok || parsed.binpacker == nil {
+		return nil, false
+	}
+	return parsed.binpacker, true
+}
+
+// get returns the parsed InstanceGroupConfig of the instance group, parsing it again only when it changed
+func (c *InstanceGroupConfigs) get(ctx context.Context, instanceGroup string) (*parsedInstanceGroupConfig, bool) {
+	obj, exists, err := c.instanceGroupConfigs.GetByKey(instanceGroup)
+	if err != nil || !exists {
+		return nil, false
+	}
+	instanceGroupConfig, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	c.parsedLock.Lock()
+	defer c.parsedLock.Unlock()
+	if parsed, ok := c.parsed[instanceGroup]; ok && parsed.resourceVersion == instanceGroupConfig.GetResourceVersion() {
+		return parsed, true
+	}
+	parsed, err := c.parse(instanceGroup, instanceGroupConfig)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("invalid InstanceGroupConfig, using the install configuration for the instance group",
+			svc1log.SafeParam("instanceGroup", instanceGroup),
+			svc1log.SafeParam("resourceVersion", instanceGroupConfig.GetResourceVersion()),
+			svc1log.Stacktrace(err))
+		parsed = &parsedInstanceGroupConfig{resourceVersion: instanceGroupConfig.GetResourceVersion()}
+	}
+	c.parsed[instanceGroup] = parsed
+	return parsed, true
+}
+
+func (c *InstanceGroupConfigs) parse(instanceGroup string, instanceGroupConfig *unstructured.Unstructured) (*parsedInstanceGroupConfig, error) {
+	var spec types.InstanceGroupConfigSpec
+	if rawSpec, ok := instanceGroupConfig.Object["spec"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+			return nil, werror.Wrap(err, "failed to parse the spec")
+		}
+	}
+	parsed := &parsedInstanceGroupConfig{
+		resourceVersion: instanceGroupConfig.GetResourceVersion(),
+		spec:            &spec,
+	}
+	if spec.Binpack != nil {
+		binpacker, ok := internalbinpacker.LookupBinpacker(*spec.Binpack)
+		if !ok {
+			return nil, werror.Error("unknown binpack algorithm", werror.SafeParam("binpack", *spec.Binpack))
+		}
+		parsed.binpacker = binpacker
+	}
+	if spec.DriverOrderingPolicy != nil && !isKnownOrderingPolicy(*spec.DriverOrderingPolicy) {
+		return nil, werror.Error("unknown driver ordering policy", werror.SafeParam("driverOrderingPolicy", *spec.DriverOrderingPolicy))
+	}
+	if spec.Overcommit != nil &&
+		((spec.Overcommit.CPU != nil && *spec.Overcommit.CPU <= 0) || (spec.Overcommit.Memory != nil && *spec.Overcommit.Memory <= 0)) {
+		return nil, werror.Error("overcommit ratios must be positive")
+	}
+	if spec.DriverPrioritizedNodeLabel != nil || spec.ExecutorPrioritizedNodeLabel != nil {
+		driverPrioritizedNodeLabel := c.driverPrioritizedNodeLabel
+		if spec.DriverPrioritizedNodeLabel != nil {
+			driverPrioritizedNodeLabel = labelPriorityOrder(spec.DriverPrioritizedNodeLabel)
+		}
+		executorPrioritizedNodeLabel := c.executorPrioritizedNodeLabel
+		if spec.ExecutorPrioritizedNodeLabel != nil {
+			executorPrioritizedNodeLabel = labelPriorityOrder(spec.ExecutorPrioritizedNodeLabel)
+		}
+		parsed.nodeSorter = ns.NewNodeSorter(driverPrioritizedNodeLabel, executorPrioritizedNodeLabel)
+	}
+	if spec.Queues != nil {
+		queuesConfig := config.QueuesConfig{
+			QueueLabel: spec.Queues.QueueLabel,
+			Queues:     make(map[string]config.QueueConfig, len(spec.Queues.Queues)),
+		}
+		for name, queue := range spec.Queues.Queues {
+			queuesConfig.Queues[name] = config.QueueConfig{
+				Parent:     queue.Parent,
+				Guaranteed: config.QueueResources(queue.Guaranteed),
+				Max:        config.QueueResources(queue.Max),
+			}
+		}
+		queueQuotas, err := NewQueueQuotas(queuesConfig)
+		if err != nil {
+			return nil, err
+		}
+		if queueQuotas != nil {
+			parsed.queueQuotas = queueQuotas.forInstanceGroup(c.instanceGroupLabel, instanceGroup)
+		}
+	}
+	return parsed, nil
+}
+
+func labelPriorityOrder(labelPriority *types.InstanceGroupLabelPriority) *config.LabelPriorityOrder {
+	return &config.LabelPriorityOrder{
+		Name:                     labelPriority.Name,
+		DescendingPriorityValues: labelPriority.DescendingPriorityValues,
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/crd"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInstanceGroupConfigOvercommitAppliesWithoutRestart(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	// the driver and executor need 12 cpus, while the node only has 8
+	app := extendertest.StaticAllocationSparkPodsWithSizes("app", 1, "1", "6", "1", "6")
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{InstanceGroupConfigs: true},
+		&node1,
+		&app[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.AssertFailedSchedule(t, app[0], nodeNames, "The application does not fit without overcommit")
+
+	if err := testHarness.InstanceGroupConfigStore.Add(instanceGroupConfig("batch-medium-priority", "1", map[string]interface{}{
+		"binpack": "unknown-algorithm",
+		"overcommit": map[string]interface{}{
+			"cpu": 2.0,
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	testHarness.AssertFailedSchedule(t, app[0], nodeNames, "An invalid InstanceGroupConfig should be ignored")
+
+	if err := testHarness.InstanceGroupConfigStore.Update(instanceGroupConfig("batch-medium-priority", "2", map[string]interface{}{
+		"driverOrderingPolicy": "fair-shar",
+		"overcommit": map[string]interface{}{
+			"cpu": 2.0,
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	testHarness.AssertFailedSchedule(t, app[0], nodeNames, "An InstanceGroupConfig with an unknown ordering policy should be ignored")
+
+	if err := testHarness.InstanceGroupConfigStore.Update(instanceGroupConfig("batch-medium-priority", "3", map[string]interface{}{
+		"overcommit": map[string]interface{}{
+			"cpu": 2.0,
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	testHarness.AssertSuccessfulSchedule(t, app[0], nodeNames, "The application fits once the cpus of the instance group are overcommitted")
+}
+
+func TestInstanceGroupConfigOverridesFIFO(t *testing.T) {
+	tests := []struct {
+		name               string
+		instanceGroup      string
+		expectSmallAppFits bool
+	}{{
+		name:               "FIFO is turned off for the instance group of the nodes",
+		instanceGroup:      "batch-medium-priority",
+		expectSmallAppFits: true,
+	}, {
+		name:               "the configuration of other instance groups does not apply",
+		instanceGroup:      "other-instance-group",
+		expectSmallAppFits: false,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node1 := extendertest.NewNode("node1", "zone1")
+			nodeNames := []string{node1.Name}
+			tooBigApp := queuedSparkPods("too-big-app", "team", 0)
+			tooBigApp[0].Annotations["spark-executor-count"] = "100"
+			smallApp := queuedSparkPods("small-app", "team", 1)
+
+			testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+				binpacker.SingleAzTightlyPack,
+				config.Install{InstanceGroupConfigs: true},
+				&node1,
+				&tooBigApp[0],
+				&smallApp[0],
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+			if err := testHarness.InstanceGroupConfigStore.Add(instanceGroupConfig(test.instanceGroup, "1", map[string]interface{}{
+				"fifo": false,
+			})); err != nil {
+				t.Fatal(err)
+			}
+
+			testHarness.AssertFailedSchedule(t, tooBigApp[0], nodeNames, "The big application does not fit to the cluster")
+			if test.expectSmallAppFits {
+				testHarness.AssertSuccessfulSchedule(t, smallApp[0], nodeNames, "The small application should not wait on the big one")
+			} else {
+				testHarness.AssertFailedSchedule(t, smallApp[0], nodeNames, "The small application should wait on the big one")
+			}
+		})
+	}
+}
+
+func TestInstanceGroupConfigOvercommitAppliesToUnschedulablePodMarker(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	// the driver and executor need 12 cpus, while the node only has 8
+	app := extendertest.StaticAllocationSparkPodsWithSizes("app", 1, "1", "6", "1", "6")
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{InstanceGroupConfigs: true},
+		&node1,
+		&app[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	doesExceed, err := testHarness.UnschedulablePodMarker.DoesPodExceedClusterCapacity(testHarness.Ctx, &app[0])
+	if err != nil {
+		t.Fatalf("exceeds capacity check should not cause an error: %s", err)
+	}
+	if !doesExceed {
+		t.Error("The application should exceed the capacity of the cluster without overcommit")
+	}
+
+	if err := testHarness.InstanceGroupConfigStore.Add(instanceGroupConfig("batch-medium-priority", "1", map[string]interface{}{
+		"overcommit": map[string]interface{}{
+			"cpu": 2.0,
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	doesExceed, err = testHarness.UnschedulablePodMarker.DoesPodExceedClusterCapacity(testHarness.Ctx, &app[0])
+	if err != nil {
+		t.Fatalf("exceeds capacity check should not cause an error: %s", err)
+	}
+	if doesExceed {
+		t.Error("The application should fit once the cpus of the instance group are overcommitted")
+	}
+}
+
+func TestInstanceGroupConfigFIFOAppliesToQueuePositions(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	pendingApp := queuedSparkPods("pending-app", "team", 0)
+	pendingApp[0].Spec.SchedulerName = common.SparkSchedulerName
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{InstanceGroupConfigs: true},
+		&node1,
+		&pendingApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.QueuePositionMarker.UpdateQueueStatuses(testHarness.Ctx)
+	if status := queueStatus(t, testHarness, &pendingApp[0]); status == nil || status.Position != 1 {
+		t.Fatalf("the pending driver should be first in the queue, got %+v", status)
+	}
+
+	if err := testHarness.InstanceGroupConfigStore.Add(instanceGroupConfig("batch-medium-priority", "1", map[string]interface{}{
+		"fifo": false,
+	})); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := testHarness.KubeClient.CoreV1().Pods(pendingApp[0].Namespace).Get(testHarness.Ctx, pendingApp[0].Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testHarness.PodStore.Update(pending); err != nil {
+		t.Fatal(err)
+	}
+	testHarness.QueuePositionMarker.UpdateQueueStatuses(testHarness.Ctx)
+	if status := queueStatus(t, testHarness, &pendingApp[0]); status != nil {
+		t.Errorf("drivers of instance groups without FIFO should not have a queue status, got %+v", status)
+	}
+}
+
+func instanceGroupConfig(instanceGroup, resourceVersion string, spec map[string]interface{}) *unstructured.Unstructured {
+	instanceGroupConfig := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	instanceGroupConfig.SetAPIVersion(crd.InstanceGroupConfigGroupVersion.String())
+	instanceGroupConfig.SetKind("InstanceGroupConfig")
+	instanceGroupConfig.SetName(instanceGroup)
+	instanceGroupConfig.SetResourceVersion(resourceVersion)
+	return instanceGroupConfig
+}
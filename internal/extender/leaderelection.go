@@ -0,0 +1,83 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+)
+
+const reconciliationRetryInterval = 5 * time.Second
+
+// StartLeading is called once this replica is elected. It catches the caches up with the writes of the previous
+// leader and reconciles them with the cluster once, and only then starts serving predicates.
+func (s *SparkSchedulerExtender) StartLeading(ctx context.Context) {
+	logger := svc1log.FromContext(ctx)
+	for {
+		err := s.reconcileOnTakeover(ctx)
+		if err == nil {
+			break
+		}
+		logger.Error("failed to reconcile after being elected, retrying", svc1log.Stacktrace(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconciliationRetryInterval):
+		}
+	}
+	// the leadership context is cancelled before StopLeading is called, so checking it under the lock guarantees that
+	// a replica which lost the election in the meantime does not start serving predicates
+	s.leadershipLock.Lock()
+	defer s.leadershipLock.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	atomic.StoreInt32(&s.isLeading, 1)
+	logger.Info("reconciled after being elected, serving predicates")
+}
+
+// StopLeading is called once this replica loses the election, after which predicates and bindings are rejected. The
+// resource reservation writes which are still queued are dropped, as they would overwrite the ones of the new leader.
+func (s *SparkSchedulerExtender) StopLeading(ctx context.Context) {
+	s.leadershipLock.Lock()
+	defer s.leadershipLock.Unlock()
+	atomic.StoreInt32(&s.isLeading, 0)
+	if dropped := s.resourceReservations.DropQueuedWrites(ctx); dropped > 0 {
+		svc1log.FromContext(ctx).Warn("dropped queued resource reservation writes after losing the election",
+			svc1log.SafeParam("droppedWrites", dropped))
+	}
+}
+
+func (s *SparkSchedulerExtender) reconcileOnTakeover(ctx context.Context) error {
+	span, ctx := tracing.StartSpan(ctx, "reconciliation")
+	defer span.Finish()
+	err := s.resourceReservations.Resync()
+	if err == nil {
+		s.reconciliationLock.Lock()
+		err = s.syncResourceReservationsAndDemands(ctx)
+		s.reconciliationLock.Unlock()
+	}
+	tracing.TagError(span, err)
+	return err
+}
+
+// isActive returns whether this replica should schedule pods, which is always the case without leader election
+func (s *SparkSchedulerExtender) isActive() bool {
+	return !s.isLeaderElectionEnabled || atomic.LoadInt32(&s.isLeading) == 1
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"sort"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/cache"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	fifoOrdering      string = "fifo"
+	fairShareOrdering string = "fair-share"
+)
+
+// driverOrderingPolicy decides which of the pending drivers have to fit to the cluster before a driver can be scheduled
+type driverOrderingPolicy interface {
+	// isAhead returns the order of pending drivers on the given nodes, which tells whether a driver is ahead of another.
+	// It is computed once, so that it can be applied to all the drivers of a queue.
+	isAhead(ctx context.Context, availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) func(a, b *v1.Pod) bool
+}
+
+// driversAhead returns the pending drivers ahead of the given driver, in the order they should be fitted
+func driversAhead(isAhead func(a, b *v1.Pod) bool, driver *v1.Pod, pendingDrivers []*v1.Pod) []*v1.Pod {
+	ahead := make([]*v1.Pod, 0, len(pendingDrivers))
+	for _, pendingDriver := range pendingDrivers {
+		if isAhead(pendingDriver, driver) {
+			ahead = append(ahead, pendingDriver)
+		}
+	}
+	sort.Slice(ahead, func(i, j int) bool {
+		return isAhead(ahead[i], ahead[j])
+	})
+	return ahead
+}
+
+// fifoOrderingPolicy orders drivers by their creation time
+type fifoOrderingPolicy struct{}
+
+func (fifoOrderingPolicy) isAhead(_ context.Context, _ resources.NodeGroupSchedulingMetadata) func(a, b *v1.Pod) bool {
+	return func(a, b *v1.Pod) bool {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+}
+
+// fairShareOrderingPolicy orders drivers by the dominant resource share of their tenant, so that the drivers of tenants
+// holding the smallest share of the instance group are scheduled first. Drivers of tenants with equal shares are
+// ordered by their creation time.
+type fairShareOrderingPolicy struct {
+	podLister            *SparkPodLister
+	resourceReservations *cache.ResourceReservationCache
+	softReservationStore *cache.SoftReservationStore
+	tenantLabel          string
+}
+
+func (p *fairShareOrderingPolicy) isAhead(ctx context.Context, availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) func(a, b *v1.Pod) bool {
+	shares := p.dominantShares(availableNodesSchedulingMetadata)
+	svc1log.FromContext(ctx).Debug("ordering pending drivers by fair share",
+		svc1log.SafeParam("tenantShares", shares))
+	return func(a, b *v1.Pod) bool {
+		aShare, bShare := shares[p.tenant(a)], shares[p.tenant(b)]
+		if aShare != bShare {
+			return aShare < bShare
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	}
+}
+
+// tenant returns the name of the tenant the given driver belongs to
+func (p *fairShareOrderingPolicy) tenant(driver *v1.Pod) string {
+	if tenant, ok := driver.Labels[p.tenantLabel]; ok && p.tenantLabel != "" {
+		return tenant
+	}
+	return driver.Namespace
+}
+
+// dominantShares returns the largest fraction of any resource of the given nodes reserved by each tenant
+func (p *fairShareOrderingPolicy) dominantShares(availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) map[string]float64 {
+	capacity := resources.Zero()
+	for _, nodeSchedulingMetadata := range availableNodesSchedulingMetadata {
+		capacity.Add(nodeSchedulingMetadata.SchedulableResources)
+	}
+	usage := make(map[string]*resources.Resources)
+	for _, rr := range p.resourceReservations.List() {
+		tenant := rr.Namespace
+		if p.tenantLabel != "" {
+			if driver, err := p.podLister.Pods(rr.Namespace).Get(rr.Status.Pods[common.Driver]); err == nil {
+				tenant = p.tenant(driver)
+			}
+		}
+		if usage[tenant] == nil {
+			usage[tenant] = resources.Zero()
+		}
+		for _, reservation := range rr.Spec.Reservations {
+			if _, ok := availableNodesSchedulingMetadata[reservation.Node]; ok {
+				usage[tenant].AddFromReservation(&reservation)
+			}
+		}
+		if sr, ok := p.softReservationStore.GetSoftReservation(rr.Name); ok {
+			for _, reservation := range sr.Reservations {
+				if _, ok := availableNodesSchedulingMetadata[reservation.Node]; ok {
+					usage[tenant].AddFromReservation(&reservation)
+				}
+			}
+		}
+	}
+	shares := make(map[string]float64, len(usage))
+	for tenant, tenantUsage := range usage {
+		shares[tenant] = maxFloat(
+			fraction(tenantUsage.CPU.MilliValue(), capacity.CPU.MilliValue()),
+			fraction(tenantUsage.Memory.Value(), capacity.Memory.Value()),
+			fraction(tenantUsage.NvidiaGPU.Value(), capacity.NvidiaGPU.Value()))
+	}
+	return shares
+}
+
+func fraction(used, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) / float64(total)
+}
+
+func maxFloat(values ...float64) float64 {
+	result := 0.0
+	for _, value := range values {
+		if value > result {
+			result = value
+		}
+	}
+	return result
+}
+
+// ValidateDriverOrderingConfig checks that the default and instance group policies of the driver ordering
+// configuration name known ordering policies
+func ValidateDriverOrderingConfig(driverOrderingConfig config.DriverOrderingConfig) error {
+	if !isKnownOrderingPolicy(driverOrderingConfig.DefaultPolicy) {
+		return werror.Error("unknown driver ordering policy",
+			werror.SafeParam("driverOrderingPolicy", driverOrderingConfig.DefaultPolicy))
+	}
+	for instanceGroup, name := range driverOrderingConfig.PolicyByInstanceGroup {
+		if !isKnownOrderingPolicy(name) {
+			return werror.Error("unknown driver ordering policy",
+				werror.SafeParam("instanceGroup", instanceGroup),
+				werror.SafeParam("driverOrderingPolicy", name))
+		}
+	}
+	return nil
+}
+
+func isKnownOrderingPolicy(name string) bool {
+	switch name {
+	case "", fifoOrdering, fairShareOrdering:
+		return true
+	default:
+		return false
+	}
+}
+
+// orderingPolicy returns the driver ordering policy with the given name
+func (s *SparkSchedulerExtender) orderingPolicy(ctx context.Context, name string) driverOrderingPolicy {
+	switch name {
+	case "", fifoOrdering:
+		return fifoOrderingPolicy{}
+	case fairShareOrdering:
+		return &fairShareOrderingPolicy{
+			podLister:            s.podLister,
+			resourceReservations: s.resourceReservations,
+			softReservationStore: s.softReservationStore,
+			tenantLabel:          s.driverOrderingConfig.TenantLabel,
+		}
+	default:
+		svc1log.FromContext(ctx).Warn("unknown driver ordering policy, falling back to fifo",
+			svc1log.SafeParam("driverOrderingPolicy", name))
+		return fifoOrderingPolicy{}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDriverOrdering(t *testing.T) {
+	tests := []struct {
+		name                 string
+		driverOrderingConfig config.DriverOrderingConfig
+		expectSmallAppFits   bool
+	}{{
+		name:               "fifo waits on the earlier driver of the busy tenant",
+		expectSmallAppFits: false,
+	}, {
+		name: "fair-share schedules the tenant with the smaller share first",
+		driverOrderingConfig: config.DriverOrderingConfig{
+			PolicyByInstanceGroup: map[string]string{"batch-medium-priority": "fair-share"},
+			TenantLabel:           "tenant",
+		},
+		expectSmallAppFits: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node1 := extendertest.NewNode("node1", "zone1")
+			node2 := extendertest.NewNode("node2", "zone1")
+			nodeNames := []string{node1.Name, node2.Name}
+			runningApp := tenantSparkPods("running-app", "busy-tenant", 0)
+			tooBigApp := tenantSparkPods("too-big-app", "busy-tenant", 1)
+			tooBigApp[0].Annotations["spark-executor-count"] = "100"
+			smallApp := tenantSparkPods("small-app", "small-tenant", 2)
+
+			testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+				binpacker.SingleAzTightlyPack,
+				config.Install{DriverOrderingConfig: test.driverOrderingConfig},
+				&node1,
+				&node2,
+				&runningApp[0],
+				&tooBigApp[0],
+				&smallApp[0],
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+
+			testHarness.AssertSuccessfulSchedule(t, runningApp[0], nodeNames, "The first application should fit to the empty cluster")
+			testHarness.AssertFailedSchedule(t, tooBigApp[0], nodeNames, "The big application does not fit to the cluster")
+			if test.expectSmallAppFits {
+				testHarness.AssertSuccessfulSchedule(t, smallApp[0], nodeNames, "The tenant without any reservations should go first")
+			} else {
+				testHarness.AssertFailedSchedule(t, smallApp[0], nodeNames, "The small application should wait on the earlier driver")
+			}
+		})
+	}
+}
+
+func tenantSparkPods(sparkApplicationID, tenant string, ageRank int) []v1.Pod {
+	pods := extendertest.StaticAllocationSparkPods(sparkApplicationID, 1)
+	for i := range pods {
+		pods[i].Labels["tenant"] = tenant
+		pods[i].CreationTimestamp = metav1.NewTime(time.Unix(0, 0).Add(time.Duration(ageRank) * time.Hour))
+	}
+	return pods
+}
+
+func TestValidateDriverOrderingConfig(t *testing.T) {
+	tests := []struct {
+		name                 string
+		driverOrderingConfig config.DriverOrderingConfig
+		expectError          bool
+	}{{
+		name: "default configuration",
+	}, {
+		name: "known policies",
+		driverOrderingConfig: config.DriverOrderingConfig{
+			DefaultPolicy:         "fifo",
+			PolicyByInstanceGroup: map[string]string{"batch-medium-priority": "fair-share"},
+		},
+	}, {
+		name:                 "unknown default policy",
+		driverOrderingConfig: config.DriverOrderingConfig{DefaultPolicy: "lifo"},
+		expectError:          true,
+	}, {
+		name: "unknown instance group policy",
+		driverOrderingConfig: config.DriverOrderingConfig{
+			PolicyByInstanceGroup: map[string]string{"batch-medium-priority": "fairshare"},
+		},
+		expectError: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := extender.ValidateDriverOrderingConfig(test.driverOrderingConfig)
+			if test.expectError != (err != nil) {
+				t.Errorf("expected error: %v, got: %v", test.expectError, err)
+			}
+		})
+	}
+}
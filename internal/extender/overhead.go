@@ -16,12 +16,16 @@ package extender
 
 import (
 	"context"
+	"strconv"
 	"sync"
 
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	internaltypes "github.com/palantir/k8s-spark-scheduler/internal/types"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	coreinformers "k8s.io/client-go/informers/core/v1"
@@ -47,9 +51,10 @@ type NodeRequests map[types.UID]PodRequestInfo
 
 // PodRequestInfo holds information about a pod and its requested resources
 type PodRequestInfo struct {
-	podName      string
-	podNamespace string
-	requests     *resources.Resources
+	podName          string
+	podNamespace     string
+	requests         *resources.Resources
+	extendedRequests v1.ResourceList
 }
 
 // NewOverheadComputer creates a new OverheadComputer instance
@@ -89,6 +94,8 @@ func (o *OverheadComputer) getOrCreateNodeRequests(nodeName string) NodeRequests
 
 // GetOverhead fills overhead information for given nodes.
 func (o OverheadComputer) GetOverhead(ctx context.Context, nodes []*v1.Node) resources.NodeGroupResources {
+	span, ctx := tracing.StartSpan(ctx, "compute-overhead", wtracing.WithSpanTag("k8s.node.count", strconv.Itoa(len(nodes))))
+	defer span.Finish()
 	ov, _ := o.getOverheadByNode(ctx, nodes)
 	return ov
 }
@@ -100,6 +107,18 @@ func (o OverheadComputer) GetNonSchedulableOverhead(ctx context.Context, nodes [
 	return nso
 }
 
+// GetExtendedOverhead fills extended resource overhead information for given nodes.
+func (o OverheadComputer) GetExtendedOverhead(ctx context.Context, nodes []*v1.Node) internaltypes.NodeGroupExtendedResources {
+	ov, _ := o.getExtendedOverheadByNode(ctx, nodes)
+	return ov
+}
+
+// GetNonSchedulableExtendedOverhead fills non-schedulable extended resource overhead information for given nodes.
+func (o OverheadComputer) GetNonSchedulableExtendedOverhead(ctx context.Context, nodes []*v1.Node) internaltypes.NodeGroupExtendedResources {
+	_, nso := o.getExtendedOverheadByNode(ctx, nodes)
+	return nso
+}
+
 // getOverheadByNode computes and returns the overhead per node name.
 // This returns (overhead per node, nonSchedulableOverhead per node).
 func (o OverheadComputer) getOverheadByNode(ctx context.Context, nodes []*v1.Node) (resources.NodeGroupResources, resources.NodeGroupResources) {
@@ -152,6 +171,45 @@ func (o *OverheadComputer) computeNodeOverhead(ctx context.Context, nodeName str
 	return overhead, nonSchedulableOverhead
 }
 
+// getExtendedOverheadByNode computes and returns the extended resource overhead per node name.
+// This returns (overhead per node, nonSchedulableOverhead per node).
+func (o OverheadComputer) getExtendedOverheadByNode(ctx context.Context, nodes []*v1.Node) (internaltypes.NodeGroupExtendedResources, internaltypes.NodeGroupExtendedResources) {
+	overhead := internaltypes.NodeGroupExtendedResources{}
+	nonSchedulableOverhead := internaltypes.NodeGroupExtendedResources{}
+	for _, n := range nodes {
+		overhead[n.Name] = v1.ResourceList{}
+		nonSchedulableOverhead[n.Name] = v1.ResourceList{}
+		o.addNodeExtendedOverhead(ctx, n.Name, overhead, nonSchedulableOverhead)
+	}
+	return overhead, nonSchedulableOverhead
+}
+
+// addNodeExtendedOverhead adds the extended resource requests of pods that don't have reservations to overhead, and
+// the ones of pods that are not scheduled by the spark scheduler to nonSchedulableOverhead as well.
+func (o *OverheadComputer) addNodeExtendedOverhead(
+	ctx context.Context,
+	nodeName string,
+	overhead, nonSchedulableOverhead internaltypes.NodeGroupExtendedResources) {
+	o.overheadLock.RLock()
+	defer o.overheadLock.RUnlock()
+	for _, podRequestInfo := range o.resourceRequests[nodeName] {
+		if len(podRequestInfo.extendedRequests) == 0 {
+			continue
+		}
+		pod, err := o.podInformer.Lister().Pods(podRequestInfo.podNamespace).Get(podRequestInfo.podName)
+		if err != nil {
+			continue
+		}
+		if !o.resourceReservationManager.PodHasReservation(ctx, pod) {
+			requests := internaltypes.NodeGroupExtendedResources{nodeName: podRequestInfo.extendedRequests}
+			overhead.Add(requests)
+			if pod.Spec.SchedulerName != common.SparkSchedulerName {
+				nonSchedulableOverhead.Add(requests)
+			}
+		}
+	}
+}
+
 func (o *OverheadComputer) podHasNodeName(obj interface{}) bool {
 	if pod, ok := utils.GetPodFromObjectOrTombstone(obj); ok {
 		return pod.Spec.NodeName != ""
@@ -170,7 +228,7 @@ func (o *OverheadComputer) addPodRequests(obj interface{}) {
 		return
 	}
 	nodeRequests := o.getOrCreateNodeRequests(pod.Spec.NodeName)
-	nodeRequests[pod.UID] = PodRequestInfo{pod.Name, pod.Namespace, podToResources(o.ctx, pod)}
+	nodeRequests[pod.UID] = PodRequestInfo{pod.Name, pod.Namespace, podToResources(o.ctx, pod), podToExtendedResources(pod)}
 }
 
 func (o *OverheadComputer) deletePodRequests(obj interface{}) {
@@ -207,3 +265,23 @@ func podToResources(ctx context.Context, pod *v1.Pod) *resources.Resources {
 
 	return res
 }
+
+// podToExtendedResources returns the extended resource requests of a pod, computed the same way as podToResources
+func podToExtendedResources(pod *v1.Pod) v1.ResourceList {
+	res := v1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, quantity := range internaltypes.ExtendedResourcesFromList(c.Resources.Requests) {
+			current := res[name]
+			current.Add(quantity)
+			res[name] = current
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, quantity := range internaltypes.ExtendedResourcesFromList(c.Resources.Requests) {
+			if quantity.Cmp(res[name]) > 0 {
+				res[name] = quantity
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"sort"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/events"
+	"github.com/palantir/k8s-spark-scheduler/internal/metrics"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+// preemptionVictim is a spark application which can be preempted as a whole to make room for a higher priority driver
+type preemptionVictim struct {
+	appID         string
+	namespace     string
+	driver        *v1.Pod
+	priority      int32
+	usage         resources.NodeGroupResources
+	extendedUsage types.NodeGroupExtendedResources
+}
+
+// ProcessPreemption filters the preemption candidates kube-scheduler computed for a pod. Spark pods are only ever
+// preempted as whole applications by the extender itself, so candidate nodes whose victims include spark pods are
+// dropped, and no candidates are returned for spark pods as their preemption is planned when their driver is scheduled.
+func (s *SparkSchedulerExtender) ProcessPreemption(ctx context.Context, args schedulerapi.ExtenderPreemptionArgs) *schedulerapi.ExtenderPreemptionResult {
+	result := &schedulerapi.ExtenderPreemptionResult{NodeNameToMetaVictims: map[string]*schedulerapi.MetaVictims{}}
+	if args.Pod == nil {
+		return result
+	}
+	if _, ok := args.Pod.Labels[common.SparkRoleLabel]; ok {
+		return result
+	}
+	sparkPodUIDs, err := s.sparkPodUIDs()
+	if err != nil {
+		svc1log.FromContext(ctx).Error("failed to list spark pods, not allowing any preemption", svc1log.Stacktrace(err))
+		return result
+	}
+
+	for nodeName, victims := range args.NodeNameToMetaVictims {
+		if !containsSparkPod(victims.Pods, sparkPodUIDs) {
+			result.NodeNameToMetaVictims[nodeName] = victims
+		}
+	}
+	for nodeName, victims := range args.NodeNameToVictims {
+		metaPods := make([]*schedulerapi.MetaPod, 0, len(victims.Pods))
+		for _, pod := range victims.Pods {
+			metaPods = append(metaPods, &schedulerapi.MetaPod{UID: string(pod.UID)})
+		}
+		if !containsSparkPod(metaPods, sparkPodUIDs) {
+			result.NodeNameToMetaVictims[nodeName] = &schedulerapi.MetaVictims{Pods: metaPods, NumPDBViolations: victims.NumPDBViolations}
+		}
+	}
+	return result
+}
+
+func (s *SparkSchedulerExtender) sparkPodUIDs() (map[string]bool, error) {
+	selector, err := labels.Parse(common.SparkRoleLabel)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := s.podLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		uids[string(pod.UID)] = true
+	}
+	return uids, nil
+}
+
+func containsSparkPod(pods []*schedulerapi.MetaPod, sparkPodUIDs map[string]bool) bool {
+	for _, pod := range pods {
+		if sparkPodUIDs[pod.UID] {
+			return true
+		}
+	}
+	return false
+}
+
+// planPreemption picks whole lower priority applications, lowest priority and youngest first, until the given driver
+// and its executors fit in the capacity they would free up. It returns the victims and the resulting packing, or false
+// if preempting every eligible application would still not make enough room.
+func (s *SparkSchedulerExtender) planPreemption(
+	ctx context.Context,
+	binpacker *internalbinpacker.Binpacker,
+	driver *v1.Pod,
+	applicationResources *types.SparkApplicationResources,
+	driverNodeNames, executorNodeNames []string,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) ([]*preemptionVictim, *binpack.PackingResult, bool) {
+	if driver.Spec.PreemptionPolicy != nil && *driver.Spec.PreemptionPolicy == v1.PreemptNever {
+		return nil, nil, false
+	}
+	candidates := s.preemptionCandidates(podPriority(driver), availableNodesSchedulingMetadata)
+	if len(candidates) == 0 {
+		return nil, nil, false
+	}
+
+	metadata := copySchedulingMetadata(availableNodesSchedulingMetadata)
+	extendedResources := availableExtendedResources.Copy()
+	for i, candidate := range candidates {
+		candidate.free(metadata, extendedResources)
+		packingResult := binpacker.BinpackApplication(
+			ctx,
+			applicationResources,
+			driverNodeNames,
+			executorNodeNames,
+			metadata,
+			extendedResources)
+		if packingResult.HasCapacity {
+			return candidates[:i+1], packingResult, true
+		}
+	}
+	return nil, nil, false
+}
+
+// withPreemptedResources returns copies of the given resources with the resources of the victims added back
+func withPreemptedResources(
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources,
+	victims []*preemptionVictim) (resources.NodeGroupSchedulingMetadata, types.NodeGroupExtendedResources) {
+	metadata := copySchedulingMetadata(availableNodesSchedulingMetadata)
+	extendedResources := availableExtendedResources.Copy()
+	for _, victim := range victims {
+		victim.free(metadata, extendedResources)
+	}
+	return metadata, extendedResources
+}
+
+// free adds the resources the victim holds on the given nodes back to them
+func (v *preemptionVictim) free(metadata resources.NodeGroupSchedulingMetadata, extendedResources types.NodeGroupExtendedResources) {
+	for nodeName, usage := range v.usage {
+		if nodeSchedulingMetadata, ok := metadata[nodeName]; ok {
+			nodeSchedulingMetadata.AvailableResources.Add(usage)
+		}
+	}
+	extendedResources.Add(v.extendedUsage)
+}
+
+// preemptionCandidates returns the applications with a lower priority than the given one holding reservations on the
+// given nodes, in the order they should be preempted
+func (s *SparkSchedulerExtender) preemptionCandidates(
+	priority int32,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) []*preemptionVictim {
+	candidates := make([]*preemptionVictim, 0)
+	for _, rr := range s.resourceReservations.List() {
+		driverReservation, ok := rr.Spec.Reservations[common.Driver]
+		if !ok {
+			continue
+		}
+		if _, ok := availableNodesSchedulingMetadata[driverReservation.Node]; !ok {
+			continue
+		}
+		driver, err := s.podLister.Pods(rr.Namespace).Get(rr.Status.Pods[common.Driver])
+		if err != nil {
+			continue
+		}
+		if podPriority(driver) >= priority {
+			continue
+		}
+		appID := driver.Labels[common.SparkAppIDLabel]
+		usage := resources.UsageForNodes([]*v1beta2.ResourceReservation{rr})
+		extendedUsage := types.ExtendedResourceUsageForNodes([]*v1beta2.ResourceReservation{rr})
+		if sr, ok := s.softReservationStore.GetSoftReservation(appID); ok {
+			for _, reservation := range sr.Reservations {
+				if usage[reservation.Node] == nil {
+					usage[reservation.Node] = resources.Zero()
+				}
+				usage[reservation.Node].AddFromReservation(&reservation)
+				extendedUsage.AddFromReservation(&reservation)
+			}
+		}
+		candidates = append(candidates, &preemptionVictim{
+			appID:         appID,
+			namespace:     rr.Namespace,
+			driver:        driver,
+			priority:      podPriority(driver),
+			usage:         usage,
+			extendedUsage: extendedUsage,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].driver.CreationTimestamp.After(candidates[j].driver.CreationTimestamp.Time)
+	})
+	return candidates
+}
+
+// preemptApplications deletes all pods and reservations of the given applications. The pods of every application are
+// listed before any of them is deleted, so that no application is preempted when the victims can not be resolved. The
+// driver of an application is deleted last, and its reservations are only released once all of its pods are deleted,
+// so that an application whose pods could not all be deleted can be preempted again. Failures to delete pods are
+// logged and reported once all applications were processed.
+func (s *SparkSchedulerExtender) preemptApplications(ctx context.Context, instanceGroup string, preemptor *v1.Pod, victims []*preemptionVictim) error {
+	victimPods := make([][]*v1.Pod, len(victims))
+	for i, victim := range victims {
+		pods, err := s.podLister.Pods(victim.namespace).List(labels.Set(map[string]string{common.SparkAppIDLabel: victim.appID}).AsSelector())
+		if err != nil {
+			return werror.WrapWithContextParams(ctx, err, "failed to list pods of preempted application, not preempting any application",
+				werror.SafeParam("victimSparkAppID", victim.appID),
+				werror.SafeParam("victimNamespace", victim.namespace))
+		}
+		// executors are deleted before their driver
+		sort.SliceStable(pods, func(i, j int) bool {
+			return pods[j].Labels[common.SparkRoleLabel] == common.Driver && pods[i].Labels[common.SparkRoleLabel] != common.Driver
+		})
+		victimPods[i] = pods
+	}
+	var firstErr error
+	failedPodCount := 0
+	preemptedCount := 0
+	for i, victim := range victims {
+		logger := svc1log.FromContext(svc1log.WithLoggerParams(ctx,
+			svc1log.SafeParam("victimSparkAppID", victim.appID),
+			svc1log.SafeParam("victimNamespace", victim.namespace)))
+		logger.Info("preempting spark application", svc1log.SafeParam("victimPriority", victim.priority))
+		allDeleted := true
+		for _, pod := range victimPods[i] {
+			if pod.Labels[common.SparkRoleLabel] == common.Driver && !allDeleted {
+				// the driver is kept while executors are left, so that the application can be preempted again
+				continue
+			}
+			err := s.coreClient.Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				logger.Error("failed to delete pod of preempted application", svc1log.SafeParam("victimPodName", pod.Name), svc1log.Stacktrace(err))
+				if firstErr == nil {
+					firstErr = werror.WrapWithContextParams(ctx, err, "failed to delete pod of preempted application", werror.SafeParam("victimPodName", pod.Name))
+				}
+				failedPodCount++
+				allDeleted = false
+			}
+		}
+		if !allDeleted {
+			continue
+		}
+		s.resourceReservationManager.ReleaseApplication(ctx, victim.appID, victim.namespace)
+		events.EmitApplicationPreempted(ctx, instanceGroup, victim.appID, victim.namespace, preemptor.Labels[common.SparkAppIDLabel])
+		preemptedCount++
+	}
+	metrics.ReportPreemption(ctx, instanceGroup, preemptedCount)
+	if firstErr != nil {
+		return werror.WrapWithContextParams(ctx, firstErr, "failed to preempt all applications",
+			werror.SafeParam("preemptedApplicationCount", preemptedCount),
+			werror.SafeParam("victimCount", len(victims)),
+			werror.SafeParam("failedPodCount", failedPodCount))
+	}
+	return nil
+}
+
+// withTerminatingPods returns a copy of the given scheduling metadata where the resources of terminating spark pods
+// without a reservation, such as the pods of preempted applications, are available. These pods are accounted for as
+// overhead until they are gone.
+func (s *SparkSchedulerExtender) withTerminatingPods(ctx context.Context, availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) (resources.NodeGroupSchedulingMetadata, error) {
+	selector, err := labels.Parse(common.SparkRoleLabel)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := s.podLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	metadata := copySchedulingMetadata(availableNodesSchedulingMetadata)
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil || s.resourceReservationManager.PodHasReservation(ctx, pod) {
+			continue
+		}
+		if nodeSchedulingMetadata, ok := metadata[pod.Spec.NodeName]; ok {
+			nodeSchedulingMetadata.AvailableResources.Add(podToResources(ctx, pod))
+		}
+	}
+	return metadata, nil
+}
+
+func podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+func copySchedulingMetadata(metadata resources.NodeGroupSchedulingMetadata) resources.NodeGroupSchedulingMetadata {
+	metadataCopy := make(resources.NodeGroupSchedulingMetadata, len(metadata))
+	for nodeName, nodeSchedulingMetadata := range metadata {
+		nodeCopy := *nodeSchedulingMetadata
+		nodeCopy.AvailableResources = nodeSchedulingMetadata.AvailableResources.Copy()
+		metadataCopy[nodeName] = &nodeCopy
+	}
+	return metadataCopy
+}
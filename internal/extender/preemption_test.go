@@ -0,0 +1,246 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+func TestPreemption(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	lowPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("low-priority-app", 1, "1", "4", "1", "4")
+	highPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("high-priority-app", 1, "1", "4", "1", "4")
+	highPriority := int32(100)
+	for i := range highPriorityApp {
+		highPriorityApp[i].Spec.Priority = &highPriority
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{EnablePreemption: true},
+		&node1,
+		&lowPriorityApp[0],
+		&lowPriorityApp[1],
+		&highPriorityApp[0],
+		&highPriorityApp[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	for _, pod := range lowPriorityApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the low priority application")
+	}
+
+	// a second low priority application can not preempt an application of the same priority
+	samePriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("same-priority-app", 1, "1", "4", "1", "4")
+	testHarness.AssertFailedSchedule(t, samePriorityApp[0], nodeNames, "Applications of the same priority should not be preempted")
+
+	testHarness.AssertFailedSchedule(t, highPriorityApp[0], nodeNames, "The driver should wait on the pods of the preempted application")
+	if _, ok := testHarness.ResourceReservationCache.Get(lowPriorityApp[0].Namespace, "low-priority-app"); ok {
+		t.Error("The reservation of the preempted application should be deleted")
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(highPriorityApp[0].Namespace, "high-priority-app"); ok {
+		t.Error("The high priority application should not have a reservation while the preempted pods terminate")
+	}
+
+	testHarness.AssertSuccessfulSchedule(t, highPriorityApp[0], nodeNames, "The driver should fit once the preempted pods are gone")
+	if _, ok := testHarness.ResourceReservationCache.Get(highPriorityApp[0].Namespace, "high-priority-app"); !ok {
+		t.Error("The high priority application should have a reservation")
+	}
+}
+
+func TestPreemptionWaitsForTerminatingVictims(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name, node2.Name}
+	lowPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("low-priority-app", 1, "1", "4", "1", "4")
+	for i := range lowPriorityApp {
+		lowPriorityApp[i].UID = k8stypes.UID(lowPriorityApp[i].Name)
+		lowPriorityApp[i].Spec.Containers = []v1.Container{{
+			Name: "spark",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")},
+			},
+		}}
+	}
+	mediumPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("medium-priority-app", 0, "1", "1", "1", "1")
+	mediumPriority := int32(50)
+	mediumPriorityApp[0].Spec.Priority = &mediumPriority
+	highPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("high-priority-app", 1, "1", "4", "1", "4")
+	highPriority := int32(100)
+	for i := range highPriorityApp {
+		highPriorityApp[i].Spec.Priority = &highPriority
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{EnablePreemption: true},
+		&node1,
+		&node2,
+		&lowPriorityApp[0],
+		&lowPriorityApp[1],
+		&mediumPriorityApp[0],
+		&highPriorityApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	fakeClient := testHarness.KubeClient.(*fake.Clientset)
+	podResource := v1.SchemeGroupVersion.WithResource("pods")
+	// pods are only marked as terminating on deletion, as the kubelet would until their containers stopped
+	fakeClient.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		obj, err := fakeClient.Tracker().Get(podResource, deleteAction.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*v1.Pod).DeepCopy()
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+		return true, nil, fakeClient.Tracker().Update(podResource, pod, deleteAction.GetNamespace())
+	})
+
+	// the pods are bound through the api server, so that they are accounted for as overhead once they lose their reservation
+	for _, pod := range lowPriorityApp {
+		node1Names := []string{node1.Name}
+		result := testHarness.Extender.Predicate(testHarness.Ctx, schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &node1Names})
+		if result.NodeNames == nil {
+			t.Fatalf("There should be enough capacity to schedule the low priority application: %v", result.FailedNodes)
+		}
+		if bindResult := testHarness.Bind(pod, node1.Name); bindResult.Error != "" {
+			t.Fatalf("Binding %s should succeed, got error: %s", pod.Name, bindResult.Error)
+		}
+		waitForPod(t, testHarness, pod, func(p *v1.Pod) bool { return p.Spec.NodeName != "" })
+	}
+	testHarness.AssertSuccessfulSchedule(t, mediumPriorityApp[0], []string{node2.Name}, "There should be enough capacity to schedule the medium priority application")
+
+	testHarness.AssertFailedSchedule(t, highPriorityApp[0], nodeNames, "The driver should wait on the pods of the preempted application")
+	if _, ok := testHarness.ResourceReservationCache.Get(lowPriorityApp[0].Namespace, "low-priority-app"); ok {
+		t.Error("The lowest priority application should be preempted")
+	}
+	for _, pod := range lowPriorityApp {
+		waitForPod(t, testHarness, pod, func(p *v1.Pod) bool { return p.DeletionTimestamp != nil })
+	}
+
+	result := testHarness.Schedule(t, highPriorityApp[0], nodeNames)
+	if result.NodeNames != nil || !strings.Contains(result.FailedNodes[node1.Name], "terminating pods") {
+		t.Fatalf("The driver should keep waiting on the terminating pods, got %v", result.FailedNodes)
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(mediumPriorityApp[0].Namespace, "medium-priority-app"); !ok {
+		t.Error("Applications should not be preempted while terminating pods free up enough resources")
+	}
+
+	for _, pod := range lowPriorityApp {
+		if err := fakeClient.Tracker().Delete(podResource, pod.Namespace, pod.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; ; i++ {
+		if result := testHarness.Schedule(t, highPriorityApp[0], nodeNames); result.NodeNames != nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("The driver should fit once the preempted pods are gone")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(mediumPriorityApp[0].Namespace, "medium-priority-app"); !ok {
+		t.Error("The medium priority application should not be preempted")
+	}
+}
+
+func TestPreemptionKeepsReservationsOfPartiallyDeletedApplications(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	lowPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("low-priority-app", 1, "1", "4", "1", "4")
+	highPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("high-priority-app", 1, "1", "4", "1", "4")
+	highPriority := int32(100)
+	for i := range highPriorityApp {
+		highPriorityApp[i].Spec.Priority = &highPriority
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{EnablePreemption: true},
+		&node1,
+		&lowPriorityApp[0],
+		&lowPriorityApp[1],
+		&highPriorityApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	for _, pod := range lowPriorityApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the low priority application")
+	}
+
+	failDeletes := true
+	testHarness.KubeClient.(*fake.Clientset).PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !failDeletes || action.(k8stesting.DeleteAction).GetName() != lowPriorityApp[1].Name {
+			return false, nil, nil
+		}
+		return true, nil, fmt.Errorf("failed to delete pod")
+	})
+
+	testHarness.AssertFailedSchedule(t, highPriorityApp[0], nodeNames, "Preemption should fail while a pod of the victim can not be deleted")
+	if _, ok := testHarness.ResourceReservationCache.Get(lowPriorityApp[0].Namespace, "low-priority-app"); !ok {
+		t.Error("The reservation of an application whose pods are not all deleted should be kept")
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(highPriorityApp[0].Namespace, "high-priority-app"); ok {
+		t.Error("The high priority application should not have a reservation")
+	}
+	if _, err := testHarness.KubeClient.CoreV1().Pods(lowPriorityApp[0].Namespace).Get(testHarness.Ctx, lowPriorityApp[0].Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("The driver of an application whose executors are not all deleted should be kept, got: %v", err)
+	}
+
+	failDeletes = false
+	testHarness.AssertFailedSchedule(t, highPriorityApp[0], nodeNames, "The driver should wait on the pods of the application preempted again")
+	if _, ok := testHarness.ResourceReservationCache.Get(lowPriorityApp[0].Namespace, "low-priority-app"); ok {
+		t.Error("The reservation of the preempted application should be deleted")
+	}
+	testHarness.AssertSuccessfulSchedule(t, highPriorityApp[0], nodeNames, "The driver should fit once the preempted pods are gone")
+}
+
+// waitForPod waits until the informer of the harness observed the given pod in the expected state
+func waitForPod(t *testing.T, testHarness *extendertest.Harness, pod v1.Pod, condition func(*v1.Pod) bool) {
+	for i := 0; i < 100; i++ {
+		obj, ok, err := testHarness.PodStore.GetByKey(pod.Namespace + "/" + pod.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && condition(obj.(*v1.Pod)) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("pod %s did not reach the expected state", pod.Name)
+}
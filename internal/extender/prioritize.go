@@ -0,0 +1,156 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+// Prioritize scores the nodes in the ExtenderArgs for the given pod. Nodes holding a reservation for the pod get the
+// maximum score. For drivers without a reservation, nodes are scored by their position in the driver node ordering and
+// by the packing efficiency the binpacker achieves when the driver is placed on them. Executors without a reservation
+// are scored by their position in the executor node ordering.
+func (s *SparkSchedulerExtender) Prioritize(ctx context.Context, args schedulerapi.ExtenderArgs) *schedulerapi.HostPriorityList {
+	params := internal.PodSafeParams(*args.Pod)
+	role := args.Pod.Labels[common.SparkRoleLabel]
+	params["podSparkRole"] = role
+	params["sparkAppID"] = args.Pod.Labels[common.SparkAppIDLabel]
+	ctx = svc1log.WithLoggerParams(ctx, svc1log.SafeParams(params))
+
+	var nodeNames []string
+	if args.NodeNames != nil {
+		nodeNames = *args.NodeNames
+	}
+
+	var scores map[string]int64
+	var err error
+	switch role {
+	case common.Driver:
+		scores, err = s.scoreDriverNodes(ctx, args.Pod, nodeNames)
+	case common.Executor:
+		scores, err = s.scoreExecutorNodes(ctx, args.Pod, nodeNames)
+	}
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to score nodes, returning zero scores", svc1log.SafeParam("reason", err.Error()))
+	}
+
+	result := make(schedulerapi.HostPriorityList, 0, len(nodeNames))
+	for _, name := range nodeNames {
+		result = append(result, schedulerapi.HostPriority{Host: name, Score: scores[name]})
+	}
+	return &result
+}
+
+func (s *SparkSchedulerExtender) scoreDriverNodes(ctx context.Context, driver *v1.Pod, nodeNames []string) (map[string]int64, error) {
+	if rr, ok := s.resourceReservationManager.GetResourceReservation(driver.Labels[common.SparkAppIDLabel], driver.Namespace); ok {
+		return map[string]int64{rr.Spec.Reservations[common.Driver].Node: schedulerapi.MaxExtenderPriority}, nil
+	}
+	sc, err := s.newDriverSchedulingContext(ctx, driver, nodeNames)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]int64, len(sc.driverNodeNames))
+	for i, name := range sc.driverNodeNames {
+		packingResult := sc.binpacker.BinpackApplication(
+			ctx,
+			sc.applicationResources,
+			[]string{name},
+			sc.executorNodeNames,
+			sc.nodesSchedulingMetadata,
+			sc.availableExtendedResources)
+		if !packingResult.HasCapacity {
+			continue
+		}
+		efficiency := computeAvgPackingEfficiencyForResult(sc.nodesSchedulingMetadata, packingResult)
+		// rank and packing efficiency contribute equally, both normalized to [0, 1]
+		rank := 1 - float64(i)/float64(len(sc.driverNodeNames))
+		scores[name] = int64((rank + efficiency.Max) / 2 * float64(schedulerapi.MaxExtenderPriority))
+	}
+	return scores, nil
+}
+
+func (s *SparkSchedulerExtender) scoreExecutorNodes(ctx context.Context, executor *v1.Pod, nodeNames []string) (map[string]int64, error) {
+	scores := make(map[string]int64, len(nodeNames))
+	alreadyBoundNode, found, err := s.resourceReservationManager.FindAlreadyBoundReservationNode(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		scores[alreadyBoundNode] = schedulerapi.MaxExtenderPriority
+		return scores, nil
+	}
+	unboundReservationNodes, foundUnbound, err := s.resourceReservationManager.FindUnboundReservationNodes(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+	if foundUnbound {
+		for _, name := range unboundReservationNodes {
+			scores[name] = schedulerapi.MaxExtenderPriority
+		}
+		return scores, nil
+	}
+
+	settings := s.podInstanceGroupSettings(ctx, executor)
+	availableNodes := s.getNodes(ctx, nodeNames)
+	usage := s.resourceReservationManager.GetReservedResources()
+	overhead := s.overheadComputer.GetOverhead(ctx, availableNodes)
+	_, executorNodeNames := settings.nodeSorter.PotentialNodes(resources.NodeSchedulingMetadataForNodes(settings.overcommittedNodes(availableNodes), usage, overhead), nodeNames)
+	// nodes without a reservation never score as high as a reserved node
+	for i, name := range executorNodeNames {
+		rank := 1 - float64(i)/float64(len(executorNodeNames))
+		scores[name] = int64(rank * float64(schedulerapi.MaxExtenderPriority-1))
+	}
+	return scores, nil
+}
+
+// fittingDriverNodes returns the reserved driver node followed by every other candidate node that could host the
+// driver instead, given that the application's executor reservations are already accounted for. Single AZ binpackers
+// keep the driver in the zone of its executors, so only nodes of the reserved node's zone are returned for them.
+func (s *SparkSchedulerExtender) fittingDriverNodes(ctx context.Context, driver *v1.Pod, nodeNames []string, reservedNode string) []string {
+	fittingNodes := []string{reservedNode}
+	sc, err := s.newDriverSchedulingContext(ctx, driver, nodeNames)
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to compute alternative driver nodes", svc1log.SafeParam("reason", err.Error()))
+		return fittingNodes
+	}
+	reservedZone := ""
+	if sc.binpacker.IsSingleAz {
+		reservedMetadata, ok := sc.nodesSchedulingMetadata[reservedNode]
+		if !ok {
+			return fittingNodes
+		}
+		reservedZone = reservedMetadata.ZoneLabel
+	}
+	for _, name := range sc.driverNodeNames {
+		if name == reservedNode {
+			continue
+		}
+		if sc.binpacker.IsSingleAz && sc.nodesSchedulingMetadata[name] != nil && sc.nodesSchedulingMetadata[name].ZoneLabel != reservedZone {
+			continue
+		}
+		if metadata, ok := sc.nodesSchedulingMetadata[name]; ok && !sc.applicationResources.DriverResources.GreaterThan(metadata.AvailableResources) &&
+			sc.availableExtendedResources.Fits(name, sc.applicationResources.DriverExtendedResources) {
+			fittingNodes = append(fittingNodes, name)
+		}
+	}
+	return fittingNodes
+}
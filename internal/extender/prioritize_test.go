@@ -0,0 +1,116 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+func TestPrioritize(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name, node2.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("2-executor-app", 2)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{UseExtenderAsScorer: true},
+		&node1,
+		&node2,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+		&podsToSchedule[2],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	driverScores := testHarness.Prioritize(podsToSchedule[0], nodeNames)
+	if driverScores[node1.Name] == 0 || driverScores[node2.Name] == 0 {
+		t.Errorf("Both nodes should fit the application and get a positive score, got %v", driverScores)
+	}
+
+	result := testHarness.Schedule(t, podsToSchedule[0], nodeNames)
+	if result.NodeNames == nil || len(*result.NodeNames) != 2 {
+		t.Fatalf("Driver predicate should return every node the driver fits on, got %v", result.NodeNames)
+	}
+	reservedNode := (*result.NodeNames)[0]
+
+	driverScores = testHarness.Prioritize(podsToSchedule[0], nodeNames)
+	if driverScores[reservedNode] != schedulerapi.MaxExtenderPriority {
+		t.Errorf("Reserved driver node should get the maximum score, got %v", driverScores)
+	}
+
+	executorScores := testHarness.Prioritize(podsToSchedule[1], nodeNames)
+	for _, name := range nodeNames {
+		if executorScores[name] != 0 && executorScores[name] != schedulerapi.MaxExtenderPriority {
+			t.Errorf("Executor scores should only favor reserved nodes, got %v", executorScores)
+		}
+	}
+	if executorScores[reservedNode] != schedulerapi.MaxExtenderPriority {
+		t.Errorf("Tightly packed executors should be reserved on the driver node, got %v", executorScores)
+	}
+}
+
+func TestSingleAzDriverAlternativesStayInZone(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	node3 := extendertest.NewNode("node3", "zone2")
+	for _, node := range []*v1.Node{&node1, &node2, &node3} {
+		node.Labels[v1.LabelZoneFailureDomain] = node.Labels[v1.LabelTopologyZone]
+	}
+	nodeNames := []string{node1.Name, node2.Name, node3.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("single-az-app", 1)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{UseExtenderAsScorer: true},
+		&node1,
+		&node2,
+		&node3,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	zones := map[string]string{node1.Name: "zone1", node2.Name: "zone1", node3.Name: "zone2"}
+	result := testHarness.Schedule(t, podsToSchedule[0], nodeNames)
+	if result.NodeNames == nil || len(*result.NodeNames) == 0 {
+		t.Fatalf("Driver predicate should return the reserved node, got %v", result.NodeNames)
+	}
+	reservedZone := zones[(*result.NodeNames)[0]]
+	zoneNodeCount := 0
+	for _, zone := range zones {
+		if zone == reservedZone {
+			zoneNodeCount++
+		}
+	}
+	if len(*result.NodeNames) != zoneNodeCount {
+		t.Errorf("Driver predicate should return every node of the reserved zone, got %v", *result.NodeNames)
+	}
+	for _, name := range *result.NodeNames {
+		if zones[name] != reservedZone {
+			t.Errorf("Driver of a single AZ application should not be offered nodes of another zone, got %v", *result.NodeNames)
+		}
+	}
+}
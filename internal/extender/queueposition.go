@@ -0,0 +1,344 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-logging/wlog/wapp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	v1affinityhelper "k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+const (
+	queuePositionPollingInterval time.Duration = 30 * time.Second
+)
+
+// QueueStatus is the place of a pending driver in the FIFO queue of its instance group
+type QueueStatus struct {
+	// Position is the position of the driver in the queue, starting from 1 for the earliest pending driver
+	Position int `json:"position"`
+	// BlockingDriver is the earliest driver of the queue that does not fit to the cluster, if the driver is behind it
+	BlockingDriver string `json:"blockingDriver,omitempty"`
+	// ResourcesNeeded are the resources of the driver and its minimum executors
+	ResourcesNeeded *ResourcesExplanation `json:"resourcesNeeded,omitempty"`
+	// EstimatedStart is when the blocking driver is expected to fit, estimated from the expected runtimes of the
+	// running applications. It is only set on the blocking driver, and only if the running applications have an
+	// expected runtime annotation.
+	EstimatedStart *metav1.Time `json:"estimatedStart,omitempty"`
+}
+
+// QueuePositionMarker periodically annotates pending spark scheduler managed drivers of FIFO instance groups with their
+// QueueStatus, and removes the annotation once they are scheduled
+type QueuePositionMarker struct {
+	extender   *SparkSchedulerExtender
+	coreClient corev1.CoreV1Interface
+}
+
+// NewQueuePositionMarker creates a new QueuePositionMarker
+func NewQueuePositionMarker(extender *SparkSchedulerExtender, coreClient corev1.CoreV1Interface) *QueuePositionMarker {
+	return &QueuePositionMarker{
+		extender:   extender,
+		coreClient: coreClient,
+	}
+}
+
+// Start starts periodic updates of the queue statuses of pending drivers
+func (q *QueuePositionMarker) Start(ctx context.Context) {
+	_ = wapp.RunWithFatalLogging(ctx, q.doStart)
+}
+
+func (q *QueuePositionMarker) doStart(ctx context.Context) error {
+	t := time.NewTicker(queuePositionPollingInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if q.extender.isActive() {
+				q.UpdateQueueStatuses(ctx)
+			}
+		}
+	}
+}
+
+// UpdateQueueStatuses computes the queue status of every pending driver, and patches the drivers whose status changed
+func (q *QueuePositionMarker) UpdateQueueStatuses(ctx context.Context) {
+	selector := labels.Set(map[string]string{common.SparkRoleLabel: common.Driver}).AsSelector()
+	drivers, err := q.extender.podLister.List(selector)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("failed to list drivers", svc1log.Stacktrace(err))
+		return
+	}
+	queues := make(map[string][]*v1.Pod)
+	for _, driver := range drivers {
+		if driver.Spec.SchedulerName != common.SparkSchedulerName {
+			continue
+		}
+		if len(driver.Spec.NodeName) != 0 || driver.DeletionTimestamp != nil {
+			if _, ok := driver.Annotations[common.QueueStatusAnnotation]; ok {
+				q.patchQueueStatus(ctx, driver, nil)
+			}
+			continue
+		}
+		instanceGroup, _ := internal.FindInstanceGroupFromPodSpec(driver.Spec, q.extender.instanceGroupLabel)
+		queues[instanceGroup] = append(queues[instanceGroup], driver)
+	}
+	for instanceGroup, queue := range queues {
+		if !q.extender.instanceGroupSettings(ctx, instanceGroup).isFIFO {
+			// drivers are not queued in this instance group, so they have no position
+			for _, driver := range queue {
+				if _, ok := driver.Annotations[common.QueueStatusAnnotation]; ok {
+					q.patchQueueStatus(ctx, driver, nil)
+				}
+			}
+			continue
+		}
+		q.updateQueue(ctx, instanceGroup, queue)
+	}
+}
+
+func (q *QueuePositionMarker) updateQueue(ctx context.Context, instanceGroup string, queue []*v1.Pod) {
+	sc, ok := q.schedulingContext(ctx, instanceGroup, queue[0])
+	if !ok {
+		return
+	}
+	queuedDrivers := q.orderQueue(ctx, sc.settings, queue, sc.nodesSchedulingMetadata)
+	sortedQueue := make([]*v1.Pod, 0, len(queuedDrivers))
+	for _, queuedDriver := range queuedDrivers {
+		sortedQueue = append(sortedQueue, queuedDriver.driver)
+	}
+	blockingDriver, estimatedStart := q.blockingDriver(ctx, sc, sortedQueue)
+	var blocking *queuedDriver
+	for _, queuedDriver := range queuedDrivers {
+		if blockingDriver != nil && isSamePod(queuedDriver.driver, blockingDriver) {
+			blocking = queuedDriver
+		}
+	}
+	for _, queuedDriver := range queuedDrivers {
+		status := &QueueStatus{
+			Position: queuedDriver.position,
+		}
+		if queuedDriver.applicationResources != nil {
+			needed := gangResources(queuedDriver.applicationResources)
+			status.ResourcesNeeded = resourcesExplanation(needed)
+		}
+		switch {
+		case blocking == nil:
+		case queuedDriver == blocking:
+			status.EstimatedStart = estimatedStart
+		case queuedDriver.waitsOn(blocking):
+			status.BlockingDriver = podKey(blockingDriver)
+		}
+		q.patchQueueStatus(ctx, queuedDriver.driver, status)
+	}
+}
+
+// queuedDriver is a pending driver along with what its place in the queue of its instance group depends on
+type queuedDriver struct {
+	driver               *v1.Pod
+	applicationResources *types.SparkApplicationResources
+	// index is the place of the driver in the order of the queue, and orderedAhead the number of drivers ordered
+	// before it, which can be less than index for drivers the ordering does not tell apart
+	index        int
+	orderedAhead int
+	// position is one more than the number of drivers the driver waits on
+	position int
+	// queue is the queue quota the driver counts towards, if hasQueue is set
+	queue    string
+	hasQueue bool
+	// exceedsMaxQuota is set if the driver would go over the max quota of its queue, so other drivers do not wait on it
+	exceedsMaxQuota bool
+	// overGuarantee is set if the driver would go over the guaranteed quota of its queue
+	overGuarantee bool
+}
+
+// orderQueue orders the pending drivers of a queue the way planDriver does, and computes the position of each one
+// from the drivers queuedDriversAhead would return for it. The ordering and the resources of the drivers are computed
+// once, and the drivers each one waits on are counted in a single pass over the order. The drivers are returned
+// sorted by their position.
+func (q *QueuePositionMarker) orderQueue(
+	ctx context.Context,
+	settings *instanceGroupSettings,
+	queue []*v1.Pod,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) []*queuedDriver {
+	var queueUsage map[string]*resources.Resources
+	if settings.queueQuotas != nil {
+		queueUsage = q.extender.queueUsage(settings.queueQuotas)
+	}
+	isAhead := q.extender.orderingPolicy(ctx, settings.driverOrderingPolicy).isAhead(ctx, availableNodesSchedulingMetadata)
+	queuedDrivers := make([]*queuedDriver, 0, len(queue))
+	for _, driver := range queue {
+		queued := &queuedDriver{driver: driver}
+		if applicationResources, err := q.extender.podLister.sparkResources(ctx, driver); err == nil {
+			queued.applicationResources = applicationResources
+		}
+		if settings.queueQuotas != nil && queued.applicationResources != nil {
+			if name, ok := settings.queueQuotas.queueForPod(driver); ok {
+				gang := gangResources(queued.applicationResources)
+				queued.queue, queued.hasQueue = name, true
+				_, queued.exceedsMaxQuota = exceededMaxQueue(settings.queueQuotas, name, gang, queueUsage)
+				queued.overGuarantee = isOverGuarantee(settings.queueQuotas, name, gang, queueUsage)
+			}
+		}
+		queuedDrivers = append(queuedDrivers, queued)
+	}
+	sort.SliceStable(queuedDrivers, func(i, j int) bool {
+		return isAhead(queuedDrivers[i].driver, queuedDrivers[j].driver)
+	})
+
+	// the drivers ordered ahead of a driver are a prefix of the order, which grows along it, so the drivers waited on
+	// are counted as the prefix grows
+	waitedOn, overGuarantee := 0, 0
+	overGuaranteeByQueue := make(map[string]int)
+	for i, queued := range queuedDrivers {
+		queued.index = i
+		for ; queued.orderedAhead < i; queued.orderedAhead++ {
+			earlier := queuedDrivers[queued.orderedAhead]
+			if !isAhead(earlier.driver, queued.driver) {
+				break
+			}
+			if earlier.exceedsMaxQuota {
+				continue
+			}
+			waitedOn++
+			if earlier.overGuarantee {
+				overGuarantee++
+				overGuaranteeByQueue[earlier.queue]++
+			}
+		}
+		queued.position = waitedOn + 1
+		if queued.isWithinGuarantee() {
+			// drivers of other queues over their guarantee do not block a driver within its own
+			queued.position -= overGuarantee - overGuaranteeByQueue[queued.queue]
+		}
+		if i+1 < len(queuedDrivers) {
+			queuedDrivers[i+1].orderedAhead = queued.orderedAhead
+		}
+	}
+	sort.SliceStable(queuedDrivers, func(i, j int) bool {
+		return queuedDrivers[i].position < queuedDrivers[j].position
+	})
+	return queuedDrivers
+}
+
+// isWithinGuarantee tells whether the driver stays within the guaranteed quota of its queue
+func (d *queuedDriver) isWithinGuarantee() bool {
+	return d.hasQueue && !d.overGuarantee
+}
+
+// waitsOn tells whether the given driver is one of the drivers the driver waits on, the way queuedDriversAhead filters
+// the drivers ordered ahead of it
+func (d *queuedDriver) waitsOn(other *queuedDriver) bool {
+	if other.index >= d.orderedAhead || other.exceedsMaxQuota {
+		return false
+	}
+	return !(d.isWithinGuarantee() && other.overGuarantee && other.queue != d.queue)
+}
+
+// schedulingContext computes the scheduling context of the instance group on the nodes the given driver can run on
+func (q *QueuePositionMarker) schedulingContext(ctx context.Context, instanceGroup string, driver *v1.Pod) (*driverSchedulingContext, bool) {
+	nodes, err := utils.ListWithPredicate(q.extender.nodeLister, func(node *v1.Node) (bool, error) {
+		return v1affinityhelper.GetRequiredNodeAffinity(driver).Match(node)
+	})
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to list nodes of instance group", svc1log.SafeParam("instanceGroup", instanceGroup), svc1log.Stacktrace(err))
+		return nil, false
+	}
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	sc, err := q.extender.newDriverSchedulingContext(ctx, driver, nodeNames)
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to compute the scheduling context of instance group", svc1log.SafeParam("instanceGroup", instanceGroup), svc1log.Stacktrace(err))
+		return nil, false
+	}
+	return sc, true
+}
+
+// blockingDriver fits the drivers of the queue to the cluster in order, and returns the first one that does not fit
+// along with the time it is expected to fit, if it can be estimated
+func (q *QueuePositionMarker) blockingDriver(ctx context.Context, sc *driverSchedulingContext, sortedQueue []*v1.Pod) (*v1.Pod, *metav1.Time) {
+	blockingDriver, _ := q.extender.fitEarlierDrivers(ctx, sc.settings, sortedQueue, sc.driverNodeNames, sc.executorNodeNames, sc.nodesSchedulingMetadata, sc.availableExtendedResources)
+	if blockingDriver == nil {
+		return nil, nil
+	}
+	applicationResources, err := q.extender.podLister.sparkResources(ctx, blockingDriver)
+	if err != nil {
+		return blockingDriver, nil
+	}
+	start, _, _, ok := q.extender.estimateStart(
+		ctx, q.extender.applicationBinpacker(ctx, blockingDriver, sc.settings.binpacker), time.Now(), applicationResources,
+		sc.driverNodeNames, sc.executorNodeNames, sc.nodesSchedulingMetadata, sc.availableExtendedResources)
+	if !ok {
+		return blockingDriver, nil
+	}
+	estimatedStart := metav1.NewTime(start)
+	return blockingDriver, &estimatedStart
+}
+
+func containsPod(pods []*v1.Pod, pod *v1.Pod) bool {
+	for _, p := range pods {
+		if isSamePod(p, pod) {
+			return true
+		}
+	}
+	return false
+}
+
+// patchQueueStatus sets the queue status annotation of the driver if it changed, or removes it if status is nil
+func (q *QueuePositionMarker) patchQueueStatus(ctx context.Context, driver *v1.Pod, status *QueueStatus) {
+	var value interface{}
+	if status != nil {
+		serialized, err := json.Marshal(status)
+		if err != nil {
+			svc1log.FromContext(ctx).Error("failed to serialize queue status", svc1log.Stacktrace(err))
+			return
+		}
+		if driver.Annotations[common.QueueStatusAnnotation] == string(serialized) {
+			return
+		}
+		value = string(serialized)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{common.QueueStatusAnnotation: value},
+		},
+	})
+	if err != nil {
+		svc1log.FromContext(ctx).Error("failed to serialize queue status patch", svc1log.Stacktrace(err))
+		return
+	}
+	if _, err := q.coreClient.Pods(driver.Namespace).Patch(ctx, driver.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		svc1log.FromContext(ctx).Warn("failed to patch queue status of driver",
+			svc1log.SafeParam("podName", driver.Name),
+			svc1log.SafeParam("podNamespace", driver.Namespace),
+			svc1log.Stacktrace(err))
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestQueuePositionMarker(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	runningApp := backfillSparkPods("running-app", "4", 0, "10m")
+	blockedApp := backfillSparkPods("blocked-app", "4", 1, "")
+	smallApp := backfillSparkPods("small-app", "1", 2, "")
+	for _, driver := range []*v1.Pod{&runningApp[0], &blockedApp[0], &smallApp[0]} {
+		driver.Spec.SchedulerName = common.SparkSchedulerName
+	}
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&runningApp[0],
+		&runningApp[1],
+		&blockedApp[0],
+		&smallApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	for _, pod := range runningApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, nodeNames, "There should be enough capacity to schedule the running application")
+		if result := testHarness.Bind(pod, node1.Name); result.Error != "" {
+			t.Fatalf("binding should succeed: %s", result.Error)
+		}
+	}
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		obj, exists, err := testHarness.PodStore.Get(&runningApp[0])
+		return exists && obj.(*v1.Pod).Spec.NodeName != "", err
+	})
+	if err != nil {
+		t.Fatal("the running driver should be bound")
+	}
+
+	testHarness.QueuePositionMarker.UpdateQueueStatuses(testHarness.Ctx)
+
+	if status := queueStatus(t, testHarness, &runningApp[0]); status != nil {
+		t.Errorf("the running driver should not have a queue status, got %+v", status)
+	}
+	blockedStatus := queueStatus(t, testHarness, &blockedApp[0])
+	if blockedStatus == nil || blockedStatus.Position != 1 || blockedStatus.BlockingDriver != "" {
+		t.Fatalf("the blocked driver should be first in the queue, got %+v", blockedStatus)
+	}
+	if blockedStatus.ResourcesNeeded == nil || blockedStatus.ResourcesNeeded.CPU != "8" {
+		t.Errorf("the blocked application should need 8 cpus, got %+v", blockedStatus.ResourcesNeeded)
+	}
+	if blockedStatus.EstimatedStart == nil ||
+		blockedStatus.EstimatedStart.Time.Before(time.Now().Add(9*time.Minute)) ||
+		blockedStatus.EstimatedStart.Time.After(time.Now().Add(11*time.Minute)) {
+		t.Errorf("the blocked driver should be expected to start once the running application finishes, got %v", blockedStatus.EstimatedStart)
+	}
+	smallStatus := queueStatus(t, testHarness, &smallApp[0])
+	if smallStatus == nil || smallStatus.Position != 2 || smallStatus.BlockingDriver != "namespace/"+blockedApp[0].Name {
+		t.Errorf("the small driver should be second in the queue behind the blocked driver, got %+v", smallStatus)
+	}
+}
+
+func TestQueuePositionFollowsQueueQuotas(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	// the earlier application exceeds the max quota of its queue, so it does not hold back the other queue
+	cappedApp := queuedSparkPods("capped-app", "capped-team", 0)
+	cappedApp[0].Annotations["spark-executor-count"] = "100"
+	otherApp := queuedSparkPods("other-app", "other-team", 1)
+	for _, driver := range []*v1.Pod{&cappedApp[0], &otherApp[0]} {
+		driver.Spec.SchedulerName = common.SparkSchedulerName
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{QueuesConfig: config.QueuesConfig{
+			QueueLabel: "queue",
+			Queues: map[string]config.QueueConfig{
+				"capped-team": {Max: config.QueueResources{CPU: "4"}},
+				"other-team":  {},
+			},
+		}},
+		&node1,
+		&cappedApp[0],
+		&otherApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.QueuePositionMarker.UpdateQueueStatuses(testHarness.Ctx)
+
+	if status := queueStatus(t, testHarness, &cappedApp[0]); status == nil || status.Position != 1 {
+		t.Errorf("the capped driver should be first in the queue, got %+v", status)
+	}
+	if status := queueStatus(t, testHarness, &otherApp[0]); status == nil || status.Position != 1 || status.BlockingDriver != "" {
+		t.Errorf("the other driver should not queue behind a driver over its queue's max quota, got %+v", status)
+	}
+}
+
+func TestQueuePositionMatchesDriversAhead(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	// every application needs 3 cpus, which is over the guarantee of greedy-team and the max quota of capped-team
+	greedyApp := queuedSparkPods("greedy-app", "greedy-team", 0)
+	cappedApp := queuedSparkPods("capped-app", "capped-team", 1)
+	smallApp := queuedSparkPods("small-app", "small-team", 2)
+	laterGreedyApp := queuedSparkPods("later-greedy-app", "greedy-team", 3)
+	laterSmallApp := queuedSparkPods("later-small-app", "small-team", 4)
+	drivers := []*v1.Pod{&greedyApp[0], &cappedApp[0], &smallApp[0], &laterGreedyApp[0], &laterSmallApp[0]}
+	objects := make([]runtime.Object, 0, len(drivers)+1)
+	objects = append(objects, &node1)
+	for _, driver := range drivers {
+		driver.Spec.SchedulerName = common.SparkSchedulerName
+		objects = append(objects, driver)
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{QueuesConfig: config.QueuesConfig{
+			QueueLabel: "queue",
+			Queues: map[string]config.QueueConfig{
+				"greedy-team": {Guaranteed: config.QueueResources{CPU: "1"}},
+				"capped-team": {Max: config.QueueResources{CPU: "2"}},
+				"small-team":  {Guaranteed: config.QueueResources{CPU: "4", Memory: "4Gi", NvidiaGPU: "1"}},
+			},
+		}},
+		objects...,
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.QueuePositionMarker.UpdateQueueStatuses(testHarness.Ctx)
+
+	expectedPositions := []int{1, 2, 1, 3, 2}
+	for i, driver := range drivers {
+		status := queueStatus(t, testHarness, driver)
+		if status == nil || status.Position != expectedPositions[i] {
+			t.Errorf("expected %s to be at position %d, got %+v", driver.Name, expectedPositions[i], status)
+			continue
+		}
+		if driver == &cappedApp[0] {
+			// the capped driver fails on the max quota of its queue before the drivers ahead of it are listed
+			continue
+		}
+		explanation, err := testHarness.Extender.Explain(testHarness.Ctx, driver.Namespace, driver.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Position != len(explanation.DriversAhead)+1 {
+			t.Errorf("expected the position of %s to count the drivers it waits on when scheduled, %v, got %d",
+				driver.Name, explanation.DriversAhead, status.Position)
+		}
+	}
+}
+
+func queueStatus(t *testing.T, testHarness *extendertest.Harness, pod *v1.Pod) *extender.QueueStatus {
+	driver, err := testHarness.KubeClient.CoreV1().Pods(pod.Namespace).Get(testHarness.Ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := driver.Annotations[common.QueueStatusAnnotation]
+	if !ok {
+		return nil
+	}
+	var status extender.QueueStatus
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		t.Fatalf("failed to parse queue status %q: %v", value, err)
+	}
+	return &status
+}
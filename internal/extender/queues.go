@@ -0,0 +1,309 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QueueQuotas assigns drivers to named queues and holds the resource quotas of each queue
+type QueueQuotas struct {
+	queueLabel string
+	queues     map[string]*queue
+	// instanceGroup limits the queues to the drivers of an instance group, when the quotas are specific to it
+	instanceGroupLabel string
+	instanceGroup      string
+}
+
+type queue struct {
+	name       string
+	parent     string
+	guaranteed queueLimits
+	max        queueLimits
+}
+
+// queueLimits is a set of resource limits, nil limits are unlimited
+type queueLimits struct {
+	cpu       *resource.Quantity
+	memory    *resource.Quantity
+	nvidiaGPU *resource.Quantity
+}
+
+// NewQueueQuotas parses and validates the queues configuration. It returns nil when no queues are configured.
+func NewQueueQuotas(queuesConfig config.QueuesConfig) (*QueueQuotas, error) {
+	if len(queuesConfig.Queues) == 0 {
+		return nil, nil
+	}
+	queues := make(map[string]*queue, len(queuesConfig.Queues))
+	for name, queueConfig := range queuesConfig.Queues {
+		guaranteed, err := parseQueueLimits(queueConfig.Guaranteed)
+		if err != nil {
+			return nil, werror.Wrap(err, "failed to parse guaranteed resources of queue", werror.SafeParam("queue", name))
+		}
+		guaranteed = guaranteed.withZeroDefaults()
+		max, err := parseQueueLimits(queueConfig.Max)
+		if err != nil {
+			return nil, werror.Wrap(err, "failed to parse max resources of queue", werror.SafeParam("queue", name))
+		}
+		queues[name] = &queue{
+			name:       name,
+			parent:     queueConfig.Parent,
+			guaranteed: guaranteed,
+			max:        max,
+		}
+	}
+	for name, q := range queues {
+		visited := map[string]bool{name: true}
+		for parent := q.parent; parent != ""; parent = queues[parent].parent {
+			if _, ok := queues[parent]; !ok {
+				return nil, werror.Error("queue has an unknown parent", werror.SafeParam("queue", name), werror.SafeParam("parent", parent))
+			}
+			if visited[parent] {
+				return nil, werror.Error("queue hierarchy has a cycle", werror.SafeParam("queue", name))
+			}
+			visited[parent] = true
+		}
+	}
+	return &QueueQuotas{
+		queueLabel: queuesConfig.QueueLabel,
+		queues:     queues,
+	}, nil
+}
+
+func parseQueueLimits(queueResources config.QueueResources) (queueLimits, error) {
+	var limits queueLimits
+	var err error
+	if limits.cpu, err = parseOptionalQuantity(queueResources.CPU); err != nil {
+		return limits, err
+	}
+	if limits.memory, err = parseOptionalQuantity(queueResources.Memory); err != nil {
+		return limits, err
+	}
+	if limits.nvidiaGPU, err = parseOptionalQuantity(queueResources.NvidiaGPU); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+func parseOptionalQuantity(value string) (*resource.Quantity, error) {
+	if value == "" {
+		return nil, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, err
+	}
+	return &quantity, nil
+}
+
+// withZeroDefaults returns the limits with unset limits set to zero
+func (l queueLimits) withZeroDefaults() queueLimits {
+	zero := resources.Zero()
+	if l.cpu == nil {
+		l.cpu = &zero.CPU
+	}
+	if l.memory == nil {
+		l.memory = &zero.Memory
+	}
+	if l.nvidiaGPU == nil {
+		l.nvidiaGPU = &zero.NvidiaGPU
+	}
+	return l
+}
+
+// isExceededBy returns true if any of the given resources is over its limit
+func (l queueLimits) isExceededBy(r *resources.Resources) bool {
+	return (l.cpu != nil && r.CPU.Cmp(*l.cpu) > 0) ||
+		(l.memory != nil && r.Memory.Cmp(*l.memory) > 0) ||
+		(l.nvidiaGPU != nil && r.NvidiaGPU.Cmp(*l.nvidiaGPU) > 0)
+}
+
+// forInstanceGroup returns the quotas restricted to the drivers of the given instance group
+func (q *QueueQuotas) forInstanceGroup(instanceGroupLabel, instanceGroup string) *QueueQuotas {
+	scoped := *q
+	scoped.instanceGroupLabel = instanceGroupLabel
+	scoped.instanceGroup = instanceGroup
+	return &scoped
+}
+
+// queueForPod returns the name of the queue the given driver belongs to, if it belongs to a configured queue
+func (q *QueueQuotas) queueForPod(pod *v1.Pod) (string, bool) {
+	if q.instanceGroup != "" {
+		if instanceGroup, _ := internal.FindInstanceGroupFromPodSpec(pod.Spec, q.instanceGroupLabel); instanceGroup != q.instanceGroup {
+			return "", false
+		}
+	}
+	name := pod.Namespace
+	if label, ok := pod.Labels[q.queueLabel]; ok && q.queueLabel != "" {
+		name = label
+	}
+	_, ok := q.queues[name]
+	return name, ok
+}
+
+// ancestry returns the given queue followed by all of its parents
+func (q *QueueQuotas) ancestry(name string) []*queue {
+	result := make([]*queue, 0, 1)
+	for current, ok := q.queues[name]; ok; current, ok = q.queues[current.parent] {
+		result = append(result, current)
+	}
+	return result
+}
+
+// queueUsage returns the resources reserved by the applications of every queue, including the usage of their child queues
+func (s *SparkSchedulerExtender) queueUsage(queueQuotas *QueueQuotas) map[string]*resources.Resources {
+	usage := make(map[string]*resources.Resources, len(queueQuotas.queues))
+	for name := range queueQuotas.queues {
+		usage[name] = resources.Zero()
+	}
+	for _, rr := range s.resourceReservations.List() {
+		driver, err := s.podLister.Pods(rr.Namespace).Get(rr.Status.Pods[common.Driver])
+		if err != nil {
+			continue
+		}
+		name, ok := queueQuotas.queueForPod(driver)
+		if !ok {
+			continue
+		}
+		appUsage := resources.Zero()
+		for _, reservation := range rr.Spec.Reservations {
+			appUsage.AddFromReservation(&reservation)
+		}
+		if sr, ok := s.softReservationStore.GetSoftReservation(driver.Labels[common.SparkAppIDLabel]); ok {
+			for _, reservation := range sr.Reservations {
+				appUsage.AddFromReservation(&reservation)
+			}
+		}
+		for _, q := range queueQuotas.ancestry(name) {
+			usage[q.name].Add(appUsage)
+		}
+	}
+	return usage
+}
+
+// fitsQueueQuota checks whether the driver and its minimum executors fit under the max quota of the driver's queue and
+// all of its parents
+func (s *SparkSchedulerExtender) fitsQueueQuota(ctx context.Context, queueQuotas *QueueQuotas, driver *v1.Pod, applicationResources *types.SparkApplicationResources, usage map[string]*resources.Resources) error {
+	name, ok := queueQuotas.queueForPod(driver)
+	if !ok {
+		return nil
+	}
+	if exceededQueue, ok := exceededMaxQueue(queueQuotas, name, gangResources(applicationResources), usage); ok {
+		svc1log.FromContext(ctx).Info("application would exceed the max quota of its queue",
+			svc1log.SafeParam("queue", name),
+			svc1log.SafeParam("exceededQueue", exceededQueue),
+			svc1log.SafeParam("queueUsage", usage[exceededQueue]))
+		return werror.ErrorWithContextParams(ctx, "application would exceed the max quota of its queue",
+			werror.SafeParam("queue", name),
+			werror.SafeParam("exceededQueue", exceededQueue))
+	}
+	return nil
+}
+
+// filterEarlierDriversByQueueQuota drops the earlier drivers which would exceed the max quota of their own queue, as
+// they can not be scheduled before their queue frees up and must not block drivers of other queues meanwhile
+func (s *SparkSchedulerExtender) filterEarlierDriversByQueueQuota(
+	ctx context.Context,
+	queueQuotas *QueueQuotas,
+	earlierDrivers []*v1.Pod,
+	usage map[string]*resources.Resources) []*v1.Pod {
+	filtered := make([]*v1.Pod, 0, len(earlierDrivers))
+	for _, earlierDriver := range earlierDrivers {
+		earlierName, ok := queueQuotas.queueForPod(earlierDriver)
+		if ok {
+			earlierApplicationResources, err := s.podLister.sparkResources(ctx, earlierDriver)
+			if err == nil {
+				if exceededQueue, ok := exceededMaxQueue(queueQuotas, earlierName, gangResources(earlierApplicationResources), usage); ok {
+					svc1log.FromContext(ctx).Debug("not waiting on earlier driver which would exceed the max quota of its queue",
+						svc1log.SafeParam("earlierDriverName", earlierDriver.Name),
+						svc1log.SafeParam("earlierDriverQueue", earlierName),
+						svc1log.SafeParam("exceededQueue", exceededQueue))
+					continue
+				}
+			}
+		}
+		filtered = append(filtered, earlierDriver)
+	}
+	return filtered
+}
+
+// exceededMaxQueue returns the first queue out of the given queue and its parents whose max quota is exceeded once the
+// gang is added to its usage
+func exceededMaxQueue(queueQuotas *QueueQuotas, name string, gang *resources.Resources, usage map[string]*resources.Resources) (string, bool) {
+	for _, q := range queueQuotas.ancestry(name) {
+		queueUsage := usage[q.name].Copy()
+		queueUsage.Add(gang)
+		if q.max.isExceededBy(queueUsage) {
+			return q.name, true
+		}
+	}
+	return "", false
+}
+
+// filterEarlierDriversByQueueGuarantee drops the earlier drivers which should not block the given driver. If the
+// driver's queue is still within its guaranteed quota with this application, earlier drivers of other queues which
+// would go over their own guarantee are not waited on.
+func (s *SparkSchedulerExtender) filterEarlierDriversByQueueGuarantee(
+	ctx context.Context,
+	queueQuotas *QueueQuotas,
+	driver *v1.Pod,
+	applicationResources *types.SparkApplicationResources,
+	earlierDrivers []*v1.Pod,
+	usage map[string]*resources.Resources) []*v1.Pod {
+	name, ok := queueQuotas.queueForPod(driver)
+	if !ok || isOverGuarantee(queueQuotas, name, gangResources(applicationResources), usage) {
+		return earlierDrivers
+	}
+	filtered := make([]*v1.Pod, 0, len(earlierDrivers))
+	for _, earlierDriver := range earlierDrivers {
+		earlierName, ok := queueQuotas.queueForPod(earlierDriver)
+		if ok && earlierName != name {
+			earlierApplicationResources, err := s.podLister.sparkResources(ctx, earlierDriver)
+			if err == nil && isOverGuarantee(queueQuotas, earlierName, gangResources(earlierApplicationResources), usage) {
+				svc1log.FromContext(ctx).Debug("not waiting on earlier driver of a queue over its guarantee",
+					svc1log.SafeParam("earlierDriverName", earlierDriver.Name),
+					svc1log.SafeParam("earlierDriverQueue", earlierName))
+				continue
+			}
+		}
+		filtered = append(filtered, earlierDriver)
+	}
+	return filtered
+}
+
+func isOverGuarantee(queueQuotas *QueueQuotas, name string, gang *resources.Resources, usage map[string]*resources.Resources) bool {
+	queueUsage := usage[name].Copy()
+	queueUsage.Add(gang)
+	return queueQuotas.queues[name].guaranteed.isExceededBy(queueUsage)
+}
+
+// gangResources returns the total resources of the driver and the minimum executor count of an application
+func gangResources(applicationResources *types.SparkApplicationResources) *resources.Resources {
+	gang := applicationResources.DriverResources.Copy()
+	for i := 0; i < applicationResources.MinExecutorCount; i++ {
+		gang.Add(applicationResources.ExecutorResources)
+	}
+	return gang
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewQueueQuotas(t *testing.T) {
+	tests := []struct {
+		name        string
+		queues      map[string]config.QueueConfig
+		expectError bool
+	}{{
+		name:   "valid hierarchy",
+		queues: map[string]config.QueueConfig{"org": {Max: config.QueueResources{CPU: "10"}}, "team": {Parent: "org"}},
+	}, {
+		name:        "unknown parent",
+		queues:      map[string]config.QueueConfig{"team": {Parent: "org"}},
+		expectError: true,
+	}, {
+		name:        "cycle",
+		queues:      map[string]config.QueueConfig{"a": {Parent: "b"}, "b": {Parent: "a"}},
+		expectError: true,
+	}, {
+		name:        "unparseable quantity",
+		queues:      map[string]config.QueueConfig{"team": {Guaranteed: config.QueueResources{Memory: "lots"}}},
+		expectError: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := extender.NewQueueQuotas(config.QueuesConfig{Queues: test.queues})
+			if test.expectError != (err != nil) {
+				t.Errorf("expected error: %v, got: %v", test.expectError, err)
+			}
+		})
+	}
+}
+
+func TestQueueMaxQuota(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name, node2.Name}
+	firstApp := queuedSparkPods("first-app", "team", 0)
+	secondApp := queuedSparkPods("second-app", "team", 1)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{QueuesConfig: config.QueuesConfig{
+			QueueLabel: "queue",
+			Queues: map[string]config.QueueConfig{
+				"org":  {Max: config.QueueResources{CPU: "4"}},
+				"team": {Parent: "org"},
+			},
+		}},
+		&node1,
+		&node2,
+		&firstApp[0],
+		&secondApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.AssertSuccessfulSchedule(t, firstApp[0], nodeNames, "The first application fits in the quota of the parent queue")
+	testHarness.AssertFailedSchedule(t, secondApp[0], nodeNames, "The second application would exceed the quota of the parent queue")
+}
+
+func TestQueueGuaranteeSkipsEarlierDrivers(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	// the earlier application does not fit to the cluster, and would block every later driver in FIFO order
+	tooBigApp := queuedSparkPods("too-big-app", "greedy-team", 0)
+	tooBigApp[0].Annotations["spark-executor-count"] = "100"
+	smallApp := queuedSparkPods("small-app", "small-team", 1)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{QueuesConfig: config.QueuesConfig{
+			QueueLabel: "queue",
+			Queues: map[string]config.QueueConfig{
+				"greedy-team": {Guaranteed: config.QueueResources{CPU: "1", Memory: "1Gi", NvidiaGPU: "1"}},
+				"small-team":  {Guaranteed: config.QueueResources{CPU: "4", Memory: "4Gi", NvidiaGPU: "1"}},
+			},
+		}},
+		&node1,
+		&tooBigApp[0],
+		&smallApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.AssertFailedSchedule(t, tooBigApp[0], nodeNames, "The big application does not fit to the cluster")
+	testHarness.AssertSuccessfulSchedule(t, smallApp[0], nodeNames, "The small application is within its queue's guarantee and should not wait")
+}
+
+func TestQueueMaxQuotaSkipsEarlierDrivers(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	// the earlier application exceeds the max quota of its queue, so it can not be scheduled before its queue frees up
+	cappedApp := queuedSparkPods("capped-app", "capped-team", 0)
+	cappedApp[0].Annotations["spark-executor-count"] = "100"
+	otherApp := queuedSparkPods("other-app", "other-team", 1)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{QueuesConfig: config.QueuesConfig{
+			QueueLabel: "queue",
+			Queues: map[string]config.QueueConfig{
+				"capped-team": {Max: config.QueueResources{CPU: "4"}},
+				"other-team":  {},
+			},
+		}},
+		&node1,
+		&cappedApp[0],
+		&otherApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	testHarness.AssertFailedSchedule(t, cappedApp[0], nodeNames, "The capped application exceeds the max quota of its queue")
+	testHarness.AssertSuccessfulSchedule(t, otherApp[0], nodeNames, "The other application should not wait on a driver over its queue's max quota")
+}
+
+func queuedSparkPods(sparkApplicationID, queue string, ageRank int) []v1.Pod {
+	pods := extendertest.StaticAllocationSparkPods(sparkApplicationID, 2)
+	for i := range pods {
+		pods[i].Labels["queue"] = queue
+		pods[i].CreationTimestamp = metav1.NewTime(time.Unix(0, 0).Add(time.Duration(ageRank) * time.Hour))
+	}
+	return pods
+}
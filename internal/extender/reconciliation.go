@@ -0,0 +1,212 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	rrinformers "github.com/palantir/k8s-spark-scheduler-lib/pkg/client/informers/externalversions/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-logging/wlog/wapp"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientcache "k8s.io/client-go/tools/cache"
+)
+
+const incrementalReconciliationInterval = 5 * time.Second
+
+type applicationKey struct {
+	namespace string
+	appID     string
+}
+
+// pendingApplications is the set of applications whose pods were scheduled, or whose resource reservation was
+// deleted, since they were last reconciled
+type pendingApplications struct {
+	lock sync.Mutex
+	apps map[applicationKey]struct{}
+}
+
+func newPendingApplications() *pendingApplications {
+	return &pendingApplications{apps: make(map[applicationKey]struct{})}
+}
+
+func (p *pendingApplications) add(namespace, appID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.apps[applicationKey{namespace: namespace, appID: appID}] = struct{}{}
+}
+
+func (p *pendingApplications) takeAll() []applicationKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	apps := make([]applicationKey, 0, len(p.apps))
+	for app := range p.apps {
+		apps = append(apps, app)
+	}
+	p.apps = make(map[applicationKey]struct{})
+	return apps
+}
+
+func (p *pendingApplications) clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.apps = make(map[applicationKey]struct{})
+}
+
+// StartIncrementalReconciliation tracks the applications whose pods get scheduled or whose resource reservation gets
+// deleted, so that they are reconciled one by one instead of through a full resync. They are reconciled in the
+// background by the active replica, and on every scheduling request.
+func (s *SparkSchedulerExtender) StartIncrementalReconciliation(
+	ctx context.Context,
+	podInformer coreinformers.PodInformer,
+	resourceReservationInformer rrinformers.ResourceReservationInformer) {
+	podInformer.Informer().AddEventHandler(
+		clientcache.FilteringResourceEventHandler{
+			FilterFunc: utils.IsSparkSchedulerPod,
+			Handler: clientcache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					if pod, ok := obj.(*v1.Pod); ok && pod.Spec.NodeName != "" {
+						s.pendingApplications.add(pod.Namespace, pod.Labels[common.SparkAppIDLabel])
+					}
+				},
+				UpdateFunc: utils.OnPodScheduled(ctx, func(pod *v1.Pod) {
+					s.pendingApplications.add(pod.Namespace, pod.Labels[common.SparkAppIDLabel])
+				}),
+			},
+		},
+	)
+	resourceReservationInformer.Informer().AddEventHandler(
+		clientcache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(clientcache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if rr, ok := obj.(*v1beta2.ResourceReservation); ok {
+					s.pendingApplications.add(rr.Namespace, rr.Name)
+				}
+			},
+		},
+	)
+	go func() {
+		_ = wapp.RunWithFatalLogging(ctx, s.doIncrementalReconciliation)
+	}()
+}
+
+func (s *SparkSchedulerExtender) doIncrementalReconciliation(ctx context.Context) error {
+	t := time.NewTicker(incrementalReconciliationInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if !s.isActive() {
+				continue
+			}
+			if _, err := s.reconcile(ctx); err != nil {
+				svc1log.FromContext(ctx).Error("failed to reconcile, retrying later", svc1log.Stacktrace(err))
+			}
+		}
+	}
+}
+
+// reconcile runs the full reconciliation once when leader election is disabled, as the leader runs it when it is
+// elected, and afterwards only reconciles the applications which changed since. It returns whether the full
+// reconciliation ran.
+func (s *SparkSchedulerExtender) reconcile(ctx context.Context) (bool, error) {
+	s.reconciliationLock.Lock()
+	defer s.reconciliationLock.Unlock()
+	if s.isLeaderElectionEnabled || s.hasReconciled {
+		s.reconcilePendingApplications(ctx)
+		return false, nil
+	}
+	span, ctx := tracing.StartSpan(ctx, "reconciliation")
+	err := s.syncResourceReservationsAndDemands(ctx)
+	tracing.TagError(span, err)
+	span.Finish()
+	if err != nil {
+		return false, err
+	}
+	s.hasReconciled = true
+	return true, nil
+}
+
+// reconcilePendingApplications reconciles the resource reservations, demands and soft reservations of the pending
+// applications. It only lists the pods of these applications, and only computes the available resources of the
+// cluster when a driver has no resource reservation, so it is cheap enough to run on every scheduling request.
+// It has to be called while holding reconciliationLock.
+func (s *SparkSchedulerExtender) reconcilePendingApplications(ctx context.Context) {
+	apps := s.pendingApplications.takeAll()
+	if len(apps) == 0 {
+		return
+	}
+	span, ctx := tracing.StartSpan(ctx, "incremental-reconciliation", wtracing.WithSpanTag("spark.app.count", strconv.Itoa(len(apps))))
+	defer span.Finish()
+	logger := svc1log.FromContext(ctx)
+
+	r := s.newReconciler()
+	var drivers []*v1.Pod
+	extraExecutorsWithNoRRs := make(map[string][]*v1.Pod)
+	for _, app := range apps {
+		pods, err := s.podLister.Pods(app.namespace).List(labels.Set(map[string]string{common.SparkAppIDLabel: app.appID}).AsSelector())
+		if err != nil {
+			logger.Error("failed to list pods of application, retrying later",
+				svc1log.SafeParam("appID", app.appID), svc1log.Stacktrace(err))
+			s.pendingApplications.add(app.namespace, app.appID)
+			continue
+		}
+		for _, pod := range pods {
+			if pod.Labels[common.SparkRoleLabel] == common.Driver {
+				drivers = append(drivers, pod)
+			}
+		}
+		var rrs []*v1beta2.ResourceReservation
+		if rr, ok := s.resourceReservations.Get(app.namespace, app.appID); ok {
+			rrs = append(rrs, rr)
+		}
+		sp, ok := unreservedSparkPodsBySparkID(ctx, rrs, s.softReservationStore, pods)[app.appID]
+		if !ok {
+			continue
+		}
+		if sp.inconsistentDriver != nil && r.availableResources == nil {
+			if err := s.loadAvailableResources(ctx, r); err != nil {
+				logger.Error("failed to compute available resources, retrying later",
+					svc1log.SafeParam("appID", app.appID), svc1log.Stacktrace(err))
+				s.pendingApplications.add(app.namespace, app.appID)
+				continue
+			}
+		}
+		logger.Info("reconciling application", svc1log.SafeParam("appID", app.appID))
+		extraExecutors := r.syncResourceReservations(ctx, sp)
+		if len(extraExecutors) > 0 {
+			extraExecutorsWithNoRRs[sp.appID] = extraExecutors
+		}
+		r.syncDemands(ctx, sp)
+	}
+	r.syncSoftReservations(ctx, drivers, extraExecutorsWithNoRRs)
+	for appID, extraExecutors := range extraExecutorsWithNoRRs {
+		s.resourceReservationManager.PersistSoftReservation(ctx, appID, extraExecutors[0].Namespace)
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler/internal/cache"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+const (
+	// RecordedPredicates is the verb of recorded predicates requests
+	RecordedPredicates = "predicates"
+	// RecordedPrioritize is the verb of recorded prioritize requests
+	RecordedPrioritize = "prioritize"
+)
+
+// fullStateInterval is how often the full cluster state is recorded, records in between only hold the changes since
+// the previous record
+const fullStateInterval = 10 * time.Minute
+
+// SchedulingRecord holds a request the extender received, the cluster state it was decided on, and the decision. The
+// cluster state is either recorded in full in State, or as the Changes since the previous record.
+type SchedulingRecord struct {
+	Time           time.Time                          `json:"time"`
+	Verb           string                             `json:"verb"`
+	Args           schedulerapi.ExtenderArgs          `json:"args"`
+	FilterResult   *schedulerapi.ExtenderFilterResult `json:"filterResult,omitempty"`
+	HostPriorities *schedulerapi.HostPriorityList     `json:"hostPriorities,omitempty"`
+	State          *ClusterState                      `json:"state,omitempty"`
+	Changes        *ClusterStateChanges               `json:"changes,omitempty"`
+}
+
+// ClusterState is the part of the cluster state scheduling decisions depend on. Objects only keep the fields the
+// extender reads.
+type ClusterState struct {
+	Nodes                []v1.Node                                 `json:"nodes"`
+	Pods                 []v1.Pod                                  `json:"pods"`
+	ResourceReservations []v1beta2.ResourceReservation             `json:"resourceReservations,omitempty"`
+	SoftReservations     map[string]map[string]v1beta2.Reservation `json:"softReservations,omitempty"`
+}
+
+// ClusterStateChanges are the objects of the cluster state that were added or changed since the previous record, and
+// the keys of the ones that were deleted. Pods and resource reservations are keyed by namespace/name, and soft
+// reservations by application id.
+type ClusterStateChanges struct {
+	Nodes                       []v1.Node                                 `json:"nodes,omitempty"`
+	DeletedNodes                []string                                  `json:"deletedNodes,omitempty"`
+	Pods                        []v1.Pod                                  `json:"pods,omitempty"`
+	DeletedPods                 []string                                  `json:"deletedPods,omitempty"`
+	ResourceReservations        []v1beta2.ResourceReservation             `json:"resourceReservations,omitempty"`
+	DeletedResourceReservations []string                                  `json:"deletedResourceReservations,omitempty"`
+	SoftReservations            map[string]map[string]v1beta2.Reservation `json:"softReservations,omitempty"`
+	DeletedSoftReservations     []string                                  `json:"deletedSoftReservations,omitempty"`
+}
+
+// SchedulingRecorder writes a SchedulingRecord per request as a line of JSON
+type SchedulingRecorder struct {
+	lock                 sync.Mutex
+	encoder              *json.Encoder
+	nodeLister           corelisters.NodeLister
+	podLister            corelisters.PodLister
+	resourceReservations *cache.ResourceReservationCache
+	softReservationStore *cache.SoftReservationStore
+	// recorded is the cluster state as of the last snapshot, which the next one is diffed against
+	recorded *recordedState
+	// lastWritten is closed once the record of the last snapshot is written
+	lastWritten chan struct{}
+}
+
+type recordedState struct {
+	fullStateTime        time.Time
+	nodes                map[string]*v1.Node
+	pods                 map[string]*v1.Pod
+	resourceReservations map[string]v1beta2.ResourceReservation
+	softReservations     map[string]map[string]v1beta2.Reservation
+}
+
+// NewSchedulingRecorder creates a SchedulingRecorder writing to the given writer
+func NewSchedulingRecorder(
+	writer io.Writer,
+	nodeLister corelisters.NodeLister,
+	podLister corelisters.PodLister,
+	resourceReservations *cache.ResourceReservationCache,
+	softReservationStore *cache.SoftReservationStore) *SchedulingRecorder {
+	lastWritten := make(chan struct{})
+	close(lastWritten)
+	return &SchedulingRecorder{
+		encoder:              json.NewEncoder(writer),
+		nodeLister:           nodeLister,
+		podLister:            podLister,
+		resourceReservations: resourceReservations,
+		softReservationStore: softReservationStore,
+		lastWritten:          lastWritten,
+	}
+}
+
+// RecordPredicate snapshots the cluster state, runs the predicate and records both along with its result. Only the
+// snapshot is taken under the lock, so requests still run concurrently, and records are written in the order of their
+// snapshots so that every record's changes apply on top of the previous one.
+func (r *SchedulingRecorder) RecordPredicate(
+	ctx context.Context,
+	args schedulerapi.ExtenderArgs,
+	predicate func() *schedulerapi.ExtenderFilterResult) *schedulerapi.ExtenderFilterResult {
+	record, previous, written := r.newRecord(ctx, RecordedPredicates, args)
+	record.FilterResult = predicate()
+	r.write(ctx, record, previous, written)
+	return record.FilterResult
+}
+
+// RecordPrioritize behaves like RecordPredicate for prioritize requests
+func (r *SchedulingRecorder) RecordPrioritize(
+	ctx context.Context,
+	args schedulerapi.ExtenderArgs,
+	prioritize func() *schedulerapi.HostPriorityList) *schedulerapi.HostPriorityList {
+	record, previous, written := r.newRecord(ctx, RecordedPrioritize, args)
+	record.HostPriorities = prioritize()
+	r.write(ctx, record, previous, written)
+	return record.HostPriorities
+}
+
+// newRecord snapshots the cluster state into a new record, and returns it along with the channel closed once the
+// previous record is written and the one to close once this one is
+func (r *SchedulingRecorder) newRecord(
+	ctx context.Context,
+	verb string,
+	args schedulerapi.ExtenderArgs) (*SchedulingRecord, <-chan struct{}, chan<- struct{}) {
+	record := &SchedulingRecord{
+		Time: time.Now(),
+		Verb: verb,
+		Args: schedulerapi.ExtenderArgs{NodeNames: args.NodeNames},
+	}
+	if args.Pod != nil {
+		record.Args.Pod = compactPod(args.Pod)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	current := r.snapshot(ctx)
+	if r.recorded == nil || record.Time.Sub(r.recorded.fullStateTime) >= fullStateInterval {
+		current.fullStateTime = record.Time
+		record.State = current.fullState()
+	} else {
+		current.fullStateTime = r.recorded.fullStateTime
+		record.Changes = current.changesSince(r.recorded)
+	}
+	r.recorded = current
+	previous, written := r.lastWritten, make(chan struct{})
+	r.lastWritten = written
+	return record, previous, written
+}
+
+func (r *SchedulingRecorder) snapshot(ctx context.Context) *recordedState {
+	state := &recordedState{
+		nodes:                make(map[string]*v1.Node),
+		pods:                 make(map[string]*v1.Pod),
+		resourceReservations: make(map[string]v1beta2.ResourceReservation),
+		softReservations:     make(map[string]map[string]v1beta2.Reservation),
+	}
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to list nodes to record", svc1log.Stacktrace(err))
+	}
+	for _, node := range nodes {
+		state.nodes[node.Name] = node
+	}
+	pods, err := r.podLister.List(labels.Everything())
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to list pods to record", svc1log.Stacktrace(err))
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		state.pods[objectKey(pod.ObjectMeta)] = pod
+	}
+	for _, rr := range r.resourceReservations.List() {
+		state.resourceReservations[objectKey(rr.ObjectMeta)] = v1beta2.ResourceReservation{
+			ObjectMeta: compactObjectMeta(rr.ObjectMeta),
+			Spec:       rr.Spec,
+			Status:     rr.Status,
+		}
+	}
+	for appID, softReservation := range r.softReservationStore.GetAllSoftReservationsCopy() {
+		if len(softReservation.Reservations) == 0 {
+			continue
+		}
+		state.softReservations[appID] = softReservation.Reservations
+	}
+	return state
+}
+
+func (s *recordedState) fullState() *ClusterState {
+	state := &ClusterState{}
+	for _, name := range sortedKeys(s.nodes) {
+		state.Nodes = append(state.Nodes, *compactNode(s.nodes[name]))
+	}
+	for _, key := range sortedKeys(s.pods) {
+		state.Pods = append(state.Pods, *compactPod(s.pods[key]))
+	}
+	for _, key := range sortedKeys(s.resourceReservations) {
+		state.ResourceReservations = append(state.ResourceReservations, s.resourceReservations[key])
+	}
+	if len(s.softReservations) > 0 {
+		state.SoftReservations = s.softReservations
+	}
+	return state
+}
+
+// changesSince diffs the state against a previous one. Nodes and pods are the objects of the informer caches, which
+// replace objects rather than update them, so only the ones that are not the same objects as before are compared.
+func (s *recordedState) changesSince(previous *recordedState) *ClusterStateChanges {
+	changes := &ClusterStateChanges{}
+	for _, name := range sortedKeys(s.nodes) {
+		node := s.nodes[name]
+		if old, ok := previous.nodes[name]; !ok || !sameObject(old.ObjectMeta, node.ObjectMeta, old == node) {
+			changes.Nodes = append(changes.Nodes, *compactNode(node))
+		}
+	}
+	changes.DeletedNodes = deletedKeys(previous.nodes, s.nodes)
+	for _, key := range sortedKeys(s.pods) {
+		pod := s.pods[key]
+		if old, ok := previous.pods[key]; !ok || !sameObject(old.ObjectMeta, pod.ObjectMeta, old == pod) {
+			changes.Pods = append(changes.Pods, *compactPod(pod))
+		}
+	}
+	changes.DeletedPods = deletedKeys(previous.pods, s.pods)
+	for _, key := range sortedKeys(s.resourceReservations) {
+		rr := s.resourceReservations[key]
+		if old, ok := previous.resourceReservations[key]; !ok || !reflect.DeepEqual(old, rr) {
+			changes.ResourceReservations = append(changes.ResourceReservations, rr)
+		}
+	}
+	changes.DeletedResourceReservations = deletedKeys(previous.resourceReservations, s.resourceReservations)
+	for appID, reservations := range s.softReservations {
+		if old, ok := previous.softReservations[appID]; !ok || !reflect.DeepEqual(old, reservations) {
+			if changes.SoftReservations == nil {
+				changes.SoftReservations = make(map[string]map[string]v1beta2.Reservation)
+			}
+			changes.SoftReservations[appID] = reservations
+		}
+	}
+	changes.DeletedSoftReservations = deletedKeys(previous.softReservations, s.softReservations)
+	return changes
+}
+
+// sameObject tells whether an object is unchanged, which it is if it is the same object or has the same resource version
+func sameObject(old, current metav1.ObjectMeta, identical bool) bool {
+	return identical || (current.ResourceVersion != "" && old.ResourceVersion == current.ResourceVersion)
+}
+
+func (r *SchedulingRecorder) write(ctx context.Context, record *SchedulingRecord, previous <-chan struct{}, written chan<- struct{}) {
+	defer close(written)
+	<-previous
+	if err := r.encoder.Encode(record); err != nil {
+		svc1log.FromContext(ctx).Warn("failed to record scheduling request", svc1log.Stacktrace(err))
+	}
+}
+
+func objectKey(meta metav1.ObjectMeta) string {
+	return meta.Namespace + "/" + meta.Name
+}
+
+func sortedKeys[V any](objects map[string]V) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func deletedKeys[V any](previous, current map[string]V) []string {
+	var deleted []string
+	for _, key := range sortedKeys(previous) {
+		if _, ok := current[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted
+}
+
+func compactObjectMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              meta.Name,
+		Namespace:         meta.Namespace,
+		UID:               meta.UID,
+		Labels:            meta.Labels,
+		Annotations:       meta.Annotations,
+		OwnerReferences:   meta.OwnerReferences,
+		CreationTimestamp: meta.CreationTimestamp,
+		DeletionTimestamp: meta.DeletionTimestamp,
+	}
+}
+
+func compactNode(node *v1.Node) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: compactObjectMeta(node.ObjectMeta),
+		Spec: v1.NodeSpec{
+			Unschedulable: node.Spec.Unschedulable,
+			Taints:        node.Spec.Taints,
+		},
+		Status: v1.NodeStatus{
+			Capacity:    node.Status.Capacity,
+			Allocatable: node.Status.Allocatable,
+			Conditions:  node.Status.Conditions,
+		},
+	}
+}
+
+// compactPod keeps the fields of a pod that scheduling depends on, which leaves out the containers' images, commands
+// and volumes. Drivers keep the spark properties of their environment and arguments, which are read to size
+// applications, and every other value is dropped as it may hold credentials.
+func compactPod(pod *v1.Pod) *v1.Pod {
+	isDriver := pod.Labels[common.SparkRoleLabel] == common.Driver
+	return &v1.Pod{
+		ObjectMeta: compactObjectMeta(pod.ObjectMeta),
+		Spec: v1.PodSpec{
+			NodeName:          pod.Spec.NodeName,
+			SchedulerName:     pod.Spec.SchedulerName,
+			NodeSelector:      pod.Spec.NodeSelector,
+			Affinity:          pod.Spec.Affinity,
+			Tolerations:       pod.Spec.Tolerations,
+			Priority:          pod.Spec.Priority,
+			PriorityClassName: pod.Spec.PriorityClassName,
+			Containers:        compactContainers(pod.Spec.Containers, isDriver),
+			InitContainers:    compactContainers(pod.Spec.InitContainers, false),
+			Overhead:          pod.Spec.Overhead,
+		},
+		Status: v1.PodStatus{
+			Phase:      pod.Status.Phase,
+			Conditions: pod.Status.Conditions,
+			StartTime:  pod.Status.StartTime,
+		},
+	}
+}
+
+func compactContainers(containers []v1.Container, keepSparkConf bool) []v1.Container {
+	if containers == nil {
+		return nil
+	}
+	compacted := make([]v1.Container, 0, len(containers))
+	for _, container := range containers {
+		compactedContainer := v1.Container{
+			Name:      container.Name,
+			Resources: container.Resources,
+		}
+		if keepSparkConf {
+			compactedContainer.Env = sparkConfEnv(container.Env)
+			compactedContainer.Args = sparkConfArgs(container.Args)
+		}
+		compacted = append(compacted, compactedContainer)
+	}
+	return compacted
+}
+
+// sparkConfEnv keeps the -Dspark.* fields of environment values, and drops values read from other sources
+func sparkConfEnv(env []v1.EnvVar) []v1.EnvVar {
+	var compacted []v1.EnvVar
+	for _, envVar := range env {
+		var fields []string
+		for _, field := range strings.Fields(envVar.Value) {
+			if strings.HasPrefix(field, "-Dspark.") {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			compacted = append(compacted, v1.EnvVar{Name: envVar.Name, Value: strings.Join(fields, " ")})
+		}
+	}
+	return compacted
+}
+
+// sparkConfArgs keeps the --conf pairs of arguments
+func sparkConfArgs(args []string) []string {
+	var compacted []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--conf" {
+			compacted = append(compacted, args[i], args[i+1])
+			i++
+		}
+	}
+	return compacted
+}
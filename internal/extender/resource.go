@@ -16,7 +16,8 @@ package extender
 
 import (
 	"context"
-	"time"
+	"strconv"
+	"sync"
 
 	demandapi "github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/scaler/v1alpha2"
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
@@ -32,8 +33,11 @@ import (
 	"github.com/palantir/k8s-spark-scheduler/internal/events"
 	"github.com/palantir/k8s-spark-scheduler/internal/metrics"
 	ns "github.com/palantir/k8s-spark-scheduler/internal/sort"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	v1 "k8s.io/api/core/v1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/labels"
@@ -49,14 +53,15 @@ const (
 	failureFit                    = "failure-fit"
 	failureEarlierDriver          = "failure-earlier-driver"
 	failureNonSparkPod            = "failure-non-spark-pod"
+	failureQueueQuota             = "failure-queue-quota"
+	failureNotLeader              = "failure-not-leader"
+	failurePreemptionPending      = "failure-preemption-pending"
 	success                       = "success"
 	successRescheduled            = "success-rescheduled"
 	successAlreadyBound           = "success-already-bound"
 	successScheduledExtraExecutor = "success-scheduled-extra-executor"
-	// TODO: make this configurable
-	// leaderElectionInterval is the default LeaseDuration for core clients.
-	// obtained from k8s.io/component-base/config/v1alpha1
-	leaderElectionInterval = 15 * time.Second
+	successPreempted              = "success-preempted"
+	successBackfilled             = "success-backfilled"
 )
 
 // SparkSchedulerExtender is a kubernetes scheduler extended responsible for ensuring
@@ -76,13 +81,39 @@ type SparkSchedulerExtender struct {
 
 	isFIFO                                              bool
 	fifoConfig                                          config.FifoConfig
-	binpacker                                           *internalbinpacker.Binpacker
+	driverOrderingConfig                                config.DriverOrderingConfig
+	binpackers                                          *internalbinpacker.InstanceGroupBinpackers
 	shouldScheduleDynamicallyAllocatedExecutorsInSameAZ bool
 	overheadComputer                                    *OverheadComputer
-	lastRequest                                         time.Time
 	instanceGroupLabel                                  string
+	useExtenderAsScorer                                 bool
+	isPreemptionEnabled                                 bool
+	queueQuotas                                         *QueueQuotas
+	// instanceGroupConfigs overrides the settings above per instance group, it is nil unless InstanceGroupConfigs are watched
+	instanceGroupConfigs *InstanceGroupConfigs
+
+	// isLeaderElectionEnabled makes the extender serve predicates only while isLeading is set, which happens once it
+	// is elected and has reconciled. leadershipLock makes StartLeading and StopLeading update isLeading atomically with
+	// the checks of the leadership context
+	isLeaderElectionEnabled bool
+	isLeading               int32
+	leadershipLock          sync.Mutex
+
+	// reconciliationLock serializes the full and incremental reconciliations and guards hasReconciled, which records
+	// whether the full one ran when leader election is disabled
+	reconciliationLock  sync.Mutex
+	pendingApplications *pendingApplications
+	hasReconciled       bool
 
 	wasteMetricsReporter *metrics.WasteMetricsReporter
+	podEvents            events.PodEventRecorder
+}
+
+// podOutcomeEventReasons are the reasons of the events published on pods for the outcomes that leave them pending
+var podOutcomeEventReasons = map[string]string{
+	failureFit:           events.ReasonInsufficientCapacity,
+	failureEarlierDriver: events.ReasonWaitingForEarlierDriver,
+	failureUnbound:       events.ReasonNoFreeExecutorReservation,
 }
 
 // NewExtender is responsible for creating and initializing a SparkSchedulerExtender
@@ -97,12 +128,19 @@ func NewExtender(
 	apiExtensionsClient apiextensionsclientset.Interface,
 	isFIFO bool,
 	fifoConfig config.FifoConfig,
-	binpacker *internalbinpacker.Binpacker,
+	driverOrderingConfig config.DriverOrderingConfig,
+	binpackers *internalbinpacker.InstanceGroupBinpackers,
 	shouldScheduleDynamicallyAllocatedExecutorsInSameAZ bool,
 	overheadComputer *OverheadComputer,
 	instanceGroupLabel string,
 	nodeSorter *ns.NodeSorter,
-	wasteMetricsReporter *metrics.WasteMetricsReporter) *SparkSchedulerExtender {
+	wasteMetricsReporter *metrics.WasteMetricsReporter,
+	useExtenderAsScorer bool,
+	isPreemptionEnabled bool,
+	isLeaderElectionEnabled bool,
+	queueQuotas *QueueQuotas,
+	instanceGroupConfigs *InstanceGroupConfigs,
+	podEvents events.PodEventRecorder) *SparkSchedulerExtender {
 	return &SparkSchedulerExtender{
 		nodeLister:                 nodeLister,
 		podLister:                  podLister,
@@ -114,12 +152,20 @@ func NewExtender(
 		apiExtensionsClient:        apiExtensionsClient,
 		isFIFO:                     isFIFO,
 		fifoConfig:                 fifoConfig,
-		binpacker:                  binpacker,
+		driverOrderingConfig:       driverOrderingConfig,
+		binpackers:                 binpackers,
 		shouldScheduleDynamicallyAllocatedExecutorsInSameAZ: shouldScheduleDynamicallyAllocatedExecutorsInSameAZ,
-		overheadComputer:     overheadComputer,
-		instanceGroupLabel:   instanceGroupLabel,
-		nodeSorter:           nodeSorter,
-		wasteMetricsReporter: wasteMetricsReporter,
+		overheadComputer:        overheadComputer,
+		instanceGroupLabel:      instanceGroupLabel,
+		nodeSorter:              nodeSorter,
+		wasteMetricsReporter:    wasteMetricsReporter,
+		useExtenderAsScorer:     useExtenderAsScorer,
+		isPreemptionEnabled:     isPreemptionEnabled,
+		isLeaderElectionEnabled: isLeaderElectionEnabled,
+		queueQuotas:             queueQuotas,
+		instanceGroupConfigs:    instanceGroupConfigs,
+		podEvents:               podEvents,
+		pendingApplications:     newPendingApplications(),
 	}
 }
 
@@ -138,20 +184,42 @@ func (s *SparkSchedulerExtender) Predicate(ctx context.Context, args schedulerap
 	params["podSparkRole"] = role
 	params["instanceGroup"] = instanceGroup
 	params["sparkAppID"] = sparkAppID
+	span, ctx := tracing.StartSpan(ctx, "predicate", append(tracing.PodTags(args.Pod), wtracing.WithSpanTag("spark.instance.group", instanceGroup))...)
+	defer span.Finish()
 
-	timer := metrics.NewScheduleTimer(ctx, instanceGroup, args.Pod)
+	timer := metrics.NewScheduleTimer(ctx, instanceGroup, s.podBinpacker(ctx, args.Pod, s.instanceGroupSettings(ctx, instanceGroup).binpacker).Name, args.Pod)
 	logger.Info("starting scheduling pod")
 
+	if !s.isActive() {
+		logger.Info("rejecting pod as this replica is not the leader")
+		span.Tag("outcome", failureNotLeader)
+		return s.failWithMessage(ctx, failureNotLeader, args, "this replica of the extender is not the leader")
+	}
+
 	err := s.reconcileIfNeeded(ctx, timer)
 	if err != nil {
 		msg := "failed to reconcile"
 		logger.Error(msg, svc1log.Stacktrace(err))
+		tracing.TagError(span, err)
 		return s.failWithMessage(ctx, failureInternal, args, msg)
 	}
 	s.resourceReservationManager.CompactDynamicAllocationApplications(ctx)
 
 	nodeName, outcome, err := s.selectNode(ctx, instanceGroup, args.Pod.Labels[common.SparkRoleLabel], args.Pod, *args.NodeNames)
 	timer.Mark(ctx, role, outcome)
+	span.Tag("outcome", outcome)
+	span.Tag("k8s.node.name", nodeName)
+	tracing.TagError(span, err)
+	message := outcome
+	if err != nil {
+		message = err.Error()
+	}
+	if role == common.Driver {
+		s.podLister.recordDriverOutcome(ctx, args.Pod, outcome, message)
+	}
+	if reason, ok := podOutcomeEventReasons[outcome]; ok {
+		s.podEvents.Event(args.Pod, v1.EventTypeWarning, reason, message)
+	}
 	if err != nil {
 		if outcome == failureInternal {
 			logger.Error("internal error scheduling pod", svc1log.Stacktrace(err))
@@ -162,7 +230,7 @@ func (s *SparkSchedulerExtender) Predicate(ctx context.Context, args schedulerap
 	}
 
 	if role == common.Driver {
-		appResources, err := sparkResources(ctx, args.Pod)
+		appResources, err := s.podLister.sparkResources(ctx, args.Pod)
 		if err != nil {
 			logger.Error("internal error scheduling pod", svc1log.Stacktrace(err))
 			return s.failWithMessage(ctx, failureInternal, args, err.Error())
@@ -178,6 +246,13 @@ func (s *SparkSchedulerExtender) Predicate(ctx context.Context, args schedulerap
 			appResources.MaxExecutorCount)
 	}
 
+	if role == common.Driver && s.useExtenderAsScorer {
+		// leave the final choice to the scheduler's scoring, the driver reservation follows the pod if it binds elsewhere
+		fittingNodes := s.fittingDriverNodes(ctx, args.Pod, *args.NodeNames, nodeName)
+		logger.Info("returning all nodes fitting the driver", svc1log.SafeParam("reservedNodeName", nodeName), svc1log.SafeParam("nodeNames", fittingNodes))
+		return &schedulerapi.ExtenderFilterResult{NodeNames: &fittingNodes}
+	}
+
 	logger.Info("scheduling pod to node", svc1log.SafeParam("nodeName", nodeName))
 	return &schedulerapi.ExtenderFilterResult{NodeNames: &[]string{nodeName}}
 }
@@ -191,16 +266,16 @@ func (s *SparkSchedulerExtender) failWithMessage(ctx context.Context, outcome st
 	return &schedulerapi.ExtenderFilterResult{FailedNodes: failedNodes}
 }
 
+// reconcileIfNeeded reconciles the applications which changed since the last reconciliation, running the full
+// reconciliation first if it did not run yet
 func (s *SparkSchedulerExtender) reconcileIfNeeded(ctx context.Context, timer *metrics.ScheduleTimer) error {
-	now := time.Now()
-	if now.After(s.lastRequest.Add(leaderElectionInterval)) {
-		err := s.syncResourceReservationsAndDemands(ctx)
-		if err != nil {
-			return err
-		}
+	fullyReconciled, err := s.reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	if fullyReconciled {
 		timer.MarkReconciliationFinished(ctx)
 	}
-	s.lastRequest = now
 	return nil
 }
 
@@ -219,37 +294,60 @@ func (s *SparkSchedulerExtender) selectNode(ctx context.Context, instanceGroup s
 	}
 }
 
-// fitEarlierDrivers binpacks all given spark applications to the cluster and
-// accounts for their resource usage in availableNodesSchedulingMetadata
+// queuedDriversAhead returns the pending drivers which have to fit to the cluster before the given driver, in the order
+// they should be fitted. They are ordered by the driver ordering policy of the instance group, and drivers which
+// should not block the given driver because of queue quotas are left out. queueUsage is only read if the instance
+// group has queue quotas, and the queue guarantee is not considered if applicationResources is nil.
+func (s *SparkSchedulerExtender) queuedDriversAhead(
+	ctx context.Context,
+	settings *instanceGroupSettings,
+	driver *v1.Pod,
+	applicationResources *types.SparkApplicationResources,
+	pendingDrivers []*v1.Pod,
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	queueUsage map[string]*resources.Resources) []*v1.Pod {
+	isAhead := s.orderingPolicy(ctx, settings.driverOrderingPolicy).isAhead(ctx, availableNodesSchedulingMetadata)
+	queuedDrivers := driversAhead(isAhead, driver, pendingDrivers)
+	if settings.queueQuotas != nil {
+		queuedDrivers = s.filterEarlierDriversByQueueQuota(ctx, settings.queueQuotas, queuedDrivers, queueUsage)
+		if applicationResources != nil {
+			queuedDrivers = s.filterEarlierDriversByQueueGuarantee(ctx, settings.queueQuotas, driver, applicationResources, queuedDrivers, queueUsage)
+		}
+	}
+	return queuedDrivers
+}
+
+// fitEarlierDrivers binpacks all given spark applications to the cluster and accounts for
+// their resource usage in availableNodesSchedulingMetadata and availableExtendedResources. It returns
+// the first driver that does not fit and blocks the remaining drivers, if any.
 func (s *SparkSchedulerExtender) fitEarlierDrivers(
 	ctx context.Context,
-	instanceGroup string,
+	settings *instanceGroupSettings,
 	drivers []*v1.Pod,
 	nodeNames, executorNodeNames []string,
-	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) bool {
+	availableNodesSchedulingMetadata resources.NodeGroupSchedulingMetadata,
+	availableExtendedResources types.NodeGroupExtendedResources) (*v1.Pod, bool) {
 	for _, driver := range drivers {
-		applicationResources, err := sparkResources(ctx, driver)
+		applicationResources, err := s.podLister.sparkResources(ctx, driver)
 		if err != nil {
 			svc1log.FromContext(ctx).Warn("failed to get driver resources, skipping driver",
 				svc1log.SafeParam("faultyDriverName", driver.Name),
 				svc1log.SafeParam("reason", err.Error))
 			continue
 		}
-		packingResult := s.binpacker.BinpackFunc(
+		packingResult := s.applicationBinpacker(ctx, driver, settings.binpacker).BinpackApplication(
 			ctx,
-			applicationResources.DriverResources,
-			applicationResources.ExecutorResources,
-			applicationResources.MinExecutorCount,
-			nodeNames, executorNodeNames, availableNodesSchedulingMetadata)
+			applicationResources,
+			nodeNames, executorNodeNames, availableNodesSchedulingMetadata, availableExtendedResources)
 		if !packingResult.HasCapacity {
-			if s.shouldSkipDriverFifo(driver, instanceGroup) {
+			if settings.shouldSkipDriverFifo(driver) {
 				svc1log.FromContext(ctx).Debug("Skipping non-fitting driver from FIFO consideration because it is not too old yet",
 					svc1log.SafeParam("earlierDriverName", driver.Name))
 				continue
 			}
 			svc1log.FromContext(ctx).Warn("failed to fit one of the earlier drivers",
 				svc1log.SafeParam("earlierDriverName", driver.Name))
-			return false
+			return driver, false
 		}
 
 		availableNodesSchedulingMetadata.SubtractUsageIfExists(sparkResourceUsage(
@@ -257,16 +355,9 @@ func (s *SparkSchedulerExtender) fitEarlierDrivers(
 			applicationResources.ExecutorResources,
 			packingResult.DriverNode,
 			packingResult.ExecutorNodes))
+		availableExtendedResources.Sub(internalbinpacker.ExtendedResourceUsage(applicationResources, packingResult.DriverNode, packingResult.ExecutorNodes))
 	}
-	return true
-}
-
-func (s *SparkSchedulerExtender) shouldSkipDriverFifo(pod *v1.Pod, instanceGroup string) bool {
-	enforceAfterPodAgeConfig := s.fifoConfig.DefaultEnforceAfterPodAge
-	if instanceGroupCustomConfig, ok := s.fifoConfig.EnforceAfterPodAgeByInstanceGroup[instanceGroup]; ok {
-		enforceAfterPodAgeConfig = instanceGroupCustomConfig
-	}
-	return pod.CreationTimestamp.Add(enforceAfterPodAgeConfig).After(time.Now())
+	return nil, true
 }
 
 func (s *SparkSchedulerExtender) selectDriverNode(
@@ -289,43 +380,25 @@ func (s *SparkSchedulerExtender) selectDriverNode(
 			svc1log.SafeParam("nodeNames", nodeNames))
 		return driverReservedNode, success, nil
 	}
-	availableNodes, err := utils.ListWithPredicate(s.nodeLister, func(node *v1.Node) (bool, error) {
-		match, error := v1affinityhelper.GetRequiredNodeAffinity(driver).Match(node)
-		return match, error
-	})
+	plan, outcome, err := s.planDriver(ctx, instanceGroup, driver, nodeNames)
 	if err != nil {
-		return "", failureInternal, err
-	}
-
-	usage := s.resourceReservationManager.GetReservedResources()
-	overhead := s.overheadComputer.GetOverhead(ctx, availableNodes)
-
-	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(availableNodes, usage, overhead)
-	driverNodeNames, executorNodeNames := s.nodeSorter.PotentialNodes(availableNodesSchedulingMetadata, nodeNames)
-	applicationResources, err := sparkResources(ctx, driver)
-	if err != nil {
-		return "", failureInternal, werror.Wrap(err, "failed to get spark resources")
-	}
-	if s.isFIFO {
-		queuedDrivers, err := s.podLister.ListEarlierDrivers(driver)
-		if err != nil {
-			return "", failureInternal, werror.Wrap(err, "failed to list earlier drivers")
-		}
-		ok := s.fitEarlierDrivers(ctx, instanceGroup, queuedDrivers, driverNodeNames, executorNodeNames, availableNodesSchedulingMetadata)
-		if !ok {
-			s.demandsManager.CreateDemandForApplicationInAnyZone(ctx, driver, applicationResources)
-			return "", failureEarlierDriver, werror.Error("earlier drivers do not fit to the cluster")
+		if outcome == failureEarlierDriver || outcome == failureFit {
+			s.demandsManager.CreateDemandForApplicationInAnyZone(ctx, driver, plan.sc.applicationResources)
 		}
+		return "", outcome, err
 	}
-
-	packingResult := s.binpacker.BinpackFunc(
-		ctx,
-		applicationResources.DriverResources,
-		applicationResources.ExecutorResources,
-		applicationResources.MinExecutorCount,
-		driverNodeNames,
-		executorNodeNames,
-		availableNodesSchedulingMetadata)
+	if outcome == successPreempted {
+		if err := s.preemptApplications(ctx, instanceGroup, driver, plan.victims); err != nil {
+			return "", failureInternal, err
+		}
+		// the driver is scheduled once the pods of the preempted applications are gone, until then they still hold
+		// their resources on the nodes
+		return "", failurePreemptionPending, werror.Error("waiting for the pods of preempted applications to terminate")
+	}
+	availableNodes := plan.sc.availableNodes
+	availableNodesSchedulingMetadata := plan.sc.nodesSchedulingMetadata
+	applicationResources := plan.sc.applicationResources
+	packingResult := plan.packingResult
 	efficiency := computeAvgPackingEfficiencyForResult(availableNodesSchedulingMetadata, packingResult)
 
 	svc1log.FromContext(ctx).Debug("binpacking result",
@@ -336,20 +409,16 @@ func (s *SparkSchedulerExtender) selectDriverNode(
 		svc1log.SafeParam("maxExecutorCount", applicationResources.MaxExecutorCount),
 		svc1log.SafeParam("hasCapacity", packingResult.HasCapacity),
 		svc1log.SafeParam("candidateDriverNodes", nodeNames),
-		svc1log.SafeParam("candidateExecutorNodes", executorNodeNames),
+		svc1log.SafeParam("candidateExecutorNodes", plan.sc.executorNodeNames),
 		svc1log.SafeParam("driverNode", packingResult.DriverNode),
 		svc1log.SafeParam("executorNodes", packingResult.ExecutorNodes),
 		svc1log.SafeParam("avg packing efficiency CPU", efficiency.CPU),
 		svc1log.SafeParam("avg packing efficiency Memory", efficiency.Memory),
 		svc1log.SafeParam("avg packing efficiency GPU", efficiency.GPU),
 		svc1log.SafeParam("avg packing efficiency Max", efficiency.Max),
-		svc1log.SafeParam("binpacker", s.binpacker.Name))
-	if !packingResult.HasCapacity {
-		s.demandsManager.CreateDemandForApplicationInAnyZone(ctx, driver, applicationResources)
-		return "", failureFit, werror.Error("application does not fit to the cluster")
-	}
+		svc1log.SafeParam("binpacker", plan.sc.binpacker.Name))
 
-	metrics.ReportPackingEfficiency(ctx, instanceGroup, s.binpacker.Name, efficiency)
+	metrics.ReportPackingEfficiency(ctx, instanceGroup, plan.sc.binpacker.Name, efficiency)
 
 	s.demandsManager.DeleteDemandIfExists(ctx, driver, "SparkSchedulerExtender")
 	metrics.ReportInitialDriverExecutorCollocationMetric(ctx, instanceGroup, packingResult.DriverNode, packingResult.ExecutorNodes)
@@ -362,11 +431,175 @@ func (s *SparkSchedulerExtender) selectDriverNode(
 		applicationResources,
 		packingResult.DriverNode,
 		packingResult.ExecutorNodes,
+		plan.sc.binpackStrategy,
 	)
 	if err != nil {
 		return "", failureInternal, err
 	}
-	return packingResult.DriverNode, success, nil
+	s.podEvents.Eventf(driver, v1.EventTypeNormal, events.ReasonApplicationReserved,
+		"reserved resources for the driver on node %s and %d executors on nodes %v",
+		packingResult.DriverNode, len(packingResult.ExecutorNodes), packingResult.ExecutorNodes)
+	return packingResult.DriverNode, outcome, nil
+}
+
+// driverPlan is the placement of a driver and its executors decided by planDriver, along with what led to it
+type driverPlan struct {
+	sc *driverSchedulingContext
+	// driversAhead are the pending drivers fitted before the driver when FIFO is turned on
+	driversAhead []*v1.Pod
+	// blockingDriver is the earlier driver that did not fit, if any
+	blockingDriver *v1.Pod
+	packingResult  *binpack.PackingResult
+	// victims are the applications to preempt for the placement, if the outcome is successPreempted
+	victims []*preemptionVictim
+	// nodesSchedulingMetadata and availableExtendedResources are the resources the placement was packed on, which
+	// include the resources of the victims
+	nodesSchedulingMetadata    resources.NodeGroupSchedulingMetadata
+	availableExtendedResources types.NodeGroupExtendedResources
+}
+
+// planDriver decides where the driver and its executors go without making any reservation, demand or preemption. The
+// returned plan is nil only if the scheduling context could not be built.
+func (s *SparkSchedulerExtender) planDriver(
+	ctx context.Context,
+	instanceGroup string,
+	driver *v1.Pod,
+	nodeNames []string) (*driverPlan, string, error) {
+	sc, err := s.newDriverSchedulingContext(ctx, driver, nodeNames)
+	if err != nil {
+		return nil, failureInternal, err
+	}
+	plan := &driverPlan{
+		sc:                         sc,
+		nodesSchedulingMetadata:    sc.nodesSchedulingMetadata,
+		availableExtendedResources: sc.availableExtendedResources,
+	}
+	settings := sc.settings
+	availableNodesSchedulingMetadata := sc.nodesSchedulingMetadata
+	availableExtendedResources := sc.availableExtendedResources
+	driverNodeNames, executorNodeNames := sc.driverNodeNames, sc.executorNodeNames
+	applicationResources := sc.applicationResources
+	outcome := success
+	var queueUsage map[string]*resources.Resources
+	if settings.queueQuotas != nil {
+		queueUsage = s.queueUsage(settings.queueQuotas)
+		if err := s.fitsQueueQuota(ctx, settings.queueQuotas, driver, applicationResources, queueUsage); err != nil {
+			return plan, failureQueueQuota, err
+		}
+	}
+	if settings.isFIFO {
+		pendingDrivers, err := s.podLister.ListPendingDrivers(driver)
+		if err != nil {
+			return plan, failureInternal, werror.Wrap(err, "failed to list pending drivers")
+		}
+		queuedDrivers := s.queuedDriversAhead(ctx, settings, driver, applicationResources, pendingDrivers, availableNodesSchedulingMetadata, queueUsage)
+		plan.driversAhead = queuedDrivers
+		blockingDriver, ok := s.fitEarlierDrivers(ctx, settings, queuedDrivers, driverNodeNames, executorNodeNames, availableNodesSchedulingMetadata, availableExtendedResources)
+		if !ok {
+			plan.blockingDriver = blockingDriver
+			if !s.canBackfill(ctx, sc.binpacker, driver, applicationResources, blockingDriver, driverNodeNames, executorNodeNames, availableNodesSchedulingMetadata, availableExtendedResources) {
+				return plan, failureEarlierDriver, werror.Error("earlier drivers do not fit to the cluster")
+			}
+			outcome = successBackfilled
+		}
+	}
+
+	plan.packingResult = sc.binpacker.BinpackApplication(
+		ctx,
+		applicationResources,
+		driverNodeNames,
+		executorNodeNames,
+		availableNodesSchedulingMetadata,
+		availableExtendedResources)
+	if !plan.packingResult.HasCapacity && s.isPreemptionEnabled {
+		terminatingMetadata, err := s.withTerminatingPods(ctx, availableNodesSchedulingMetadata)
+		if err != nil {
+			return plan, failureInternal, werror.Wrap(err, "failed to list terminating pods")
+		}
+		if sc.binpacker.BinpackApplication(ctx, applicationResources, driverNodeNames, executorNodeNames, terminatingMetadata, availableExtendedResources).HasCapacity {
+			return plan, failurePreemptionPending, werror.Error("waiting for terminating pods to free up resources")
+		}
+		if victims, preemptionPackingResult, ok := s.planPreemption(ctx, sc.binpacker, driver, applicationResources, driverNodeNames, executorNodeNames, terminatingMetadata, availableExtendedResources); ok {
+			plan.victims = victims
+			plan.packingResult = preemptionPackingResult
+			plan.nodesSchedulingMetadata, plan.availableExtendedResources = withPreemptedResources(terminatingMetadata, availableExtendedResources, victims)
+			outcome = successPreempted
+		}
+	}
+	if !plan.packingResult.HasCapacity {
+		return plan, failureFit, werror.Error("application does not fit to the cluster")
+	}
+	return plan, outcome, nil
+}
+
+// driverSchedulingContext is the view of the cluster used to place a driver and its executors
+type driverSchedulingContext struct {
+	availableNodes          []*v1.Node
+	nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata
+	driverNodeNames         []string
+	executorNodeNames       []string
+	applicationResources    *types.SparkApplicationResources
+	// availableExtendedResources tracks resources that nodesSchedulingMetadata does not account for
+	availableExtendedResources types.NodeGroupExtendedResources
+	settings                   *instanceGroupSettings
+	// binpacker packs the driver's application, it is the binpacker of the instance group unless the driver selects a
+	// binpack strategy, which is then recorded on its resource reservation
+	binpacker       *internalbinpacker.Binpacker
+	binpackStrategy string
+}
+
+// newDriverSchedulingContext lists the nodes matching the driver's required affinity, computes their scheduling metadata
+// accounting for existing reservations and overhead, and sorts the candidate nodes for the driver and its executors
+func (s *SparkSchedulerExtender) newDriverSchedulingContext(ctx context.Context, driver *v1.Pod, nodeNames []string) (*driverSchedulingContext, error) {
+	span, _ := tracing.StartSpan(ctx, "list-nodes")
+	availableNodes, err := utils.ListWithPredicate(s.nodeLister, func(node *v1.Node) (bool, error) {
+		match, error := v1affinityhelper.GetRequiredNodeAffinity(driver).Match(node)
+		return match, error
+	})
+	span.Tag("k8s.node.count", strconv.Itoa(len(availableNodes)))
+	tracing.TagError(span, err)
+	span.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := s.podInstanceGroupSettings(ctx, driver)
+	usage := s.resourceReservationManager.GetReservedResources()
+	overhead := s.overheadComputer.GetOverhead(ctx, availableNodes)
+
+	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(settings.overcommittedNodes(availableNodes), usage, overhead)
+	driverNodeNames, executorNodeNames := settings.nodeSorter.PotentialNodes(availableNodesSchedulingMetadata, nodeNames)
+	applicationResources, err := s.podLister.sparkResources(ctx, driver)
+	if err != nil {
+		return nil, werror.Wrap(err, "failed to get spark resources")
+	}
+	binpacker, binpackStrategy := settings.binpacker, ""
+	if strategy, ok := driverBinpackStrategy(ctx, s.binpackers, driver); ok {
+		binpacker, binpackStrategy = strategy, strategy.Name
+	}
+	return &driverSchedulingContext{
+		availableNodes:             availableNodes,
+		nodesSchedulingMetadata:    availableNodesSchedulingMetadata,
+		driverNodeNames:            driverNodeNames,
+		executorNodeNames:          executorNodeNames,
+		applicationResources:       applicationResources,
+		availableExtendedResources: s.availableExtendedResources(ctx, availableNodes),
+		settings:                   settings,
+		binpacker:                  binpacker,
+		binpackStrategy:            binpackStrategy,
+	}, nil
+}
+
+// availableExtendedResources finds the extended resources available per node by subtracting reservations and overhead
+// from allocatable
+func (s *SparkSchedulerExtender) availableExtendedResources(ctx context.Context, nodes []*v1.Node) types.NodeGroupExtendedResources {
+	available := make(types.NodeGroupExtendedResources, len(nodes))
+	for _, n := range nodes {
+		available[n.Name] = types.ExtendedResourcesFromList(n.Status.Allocatable)
+	}
+	available.Sub(s.resourceReservationManager.GetReservedExtendedResources())
+	available.Sub(s.overheadComputer.GetExtendedOverhead(ctx, nodes))
+	return available
 }
 
 func computeAvgPackingEfficiencyForResult(
@@ -596,16 +829,21 @@ func (s *SparkSchedulerExtender) rescheduleExecutor(ctx context.Context, executo
 	if err != nil {
 		return "", failureInternal, err
 	}
-	sparkResources, err := sparkResources(ctx, driver)
+	sparkResources, err := s.podLister.sparkResources(ctx, driver)
 	if err != nil {
 		return "", failureInternal, err
 	}
 	executorResources := &resources.Resources{CPU: sparkResources.ExecutorResources.CPU, Memory: sparkResources.ExecutorResources.Memory, NvidiaGPU: sparkResources.ExecutorResources.NvidiaGPU}
+	span, _ := tracing.StartSpan(ctx, "list-nodes")
 	availableNodes := s.getNodes(ctx, nodeNames)
+	span.Tag("k8s.node.count", strconv.Itoa(len(availableNodes)))
+	span.Finish()
 
+	settings := s.podInstanceGroupSettings(ctx, executor)
+	binpacker := s.reservedBinpacker(executor, settings.binpacker)
 	shouldScheduleIntoSingleAZ := false
 	singleAzZone := ""
-	if s.binpacker.IsSingleAz && s.shouldScheduleDynamicallyAllocatedExecutorsInSameAZ {
+	if binpacker.IsSingleAz && s.shouldScheduleDynamicallyAllocatedExecutorsInSameAZ {
 		svc1log.FromContext(ctx).Info("Dynamic Allocation single AZ scheduling enabled, attempting to get zone to schedule into.")
 		zone, allPodsInSameAz, err := s.getCommonZoneForExecutorsApplication(ctx, executor)
 		if err != nil {
@@ -637,19 +875,30 @@ func (s *SparkSchedulerExtender) rescheduleExecutor(ctx context.Context, executo
 
 	usage := s.resourceReservationManager.GetReservedResources()
 	overhead := s.overheadComputer.GetOverhead(ctx, availableNodes)
-	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(availableNodes, usage, overhead)
+	overcommittedNodes := settings.overcommittedNodes(availableNodes)
+	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(overcommittedNodes, usage, overhead)
 
 	usage.Add(overhead)
-	availableResources := resources.AvailableForNodes(availableNodes, usage)
+	availableResources := resources.AvailableForNodes(overcommittedNodes, usage)
 
-	_, executorNodeNames := s.nodeSorter.PotentialNodes(availableNodesSchedulingMetadata, nodeNames)
+	_, executorNodeNames := settings.nodeSorter.PotentialNodes(availableNodesSchedulingMetadata, nodeNames)
+	if len(sparkResources.ExecutorExtendedResources) > 0 {
+		availableExtendedResources := s.availableExtendedResources(ctx, availableNodes)
+		fittingNodeNames := make([]string, 0, len(executorNodeNames))
+		for _, name := range executorNodeNames {
+			if availableExtendedResources.Fits(name, sparkResources.ExecutorExtendedResources) {
+				fittingNodeNames = append(fittingNodeNames, name)
+			}
+		}
+		executorNodeNames = fittingNodeNames
+	}
 
 	potentialSuccessOutcome := successRescheduled
 	if isExtraExecutor {
 		potentialSuccessOutcome = successScheduledExtraExecutor
 	}
 
-	if s.binpacker.Name == internalbinpacker.SingleAzMinimalFragmentation {
+	if binpacker.MinimalFragmentationReschedule {
 		name, ok := s.rescheduleExecutorWithMinimalFragmentation(executor, executorNodeNames, availableNodesSchedulingMetadata, overhead, executorResources)
 		if ok {
 			return name, potentialSuccessOutcome, nil
@@ -703,5 +952,5 @@ func (s *SparkSchedulerExtender) rescheduleExecutorWithMinimalFragmentation(
 }
 
 func (s *SparkSchedulerExtender) isSuccessOutcome(outcome string) bool {
-	return outcome == success || outcome == successAlreadyBound || outcome == successRescheduled || outcome == successScheduledExtraExecutor
+	return outcome == success || outcome == successAlreadyBound || outcome == successRescheduled || outcome == successScheduledExtraExecutor || outcome == successPreempted || outcome == successBackfilled
 }
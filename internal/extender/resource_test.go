@@ -15,13 +15,20 @@
 package extender_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/binpack"
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	"github.com/palantir/k8s-spark-scheduler/config"
 	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	"github.com/palantir/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
 )
 
 func TestScheduler(t *testing.T) {
@@ -371,6 +378,190 @@ func TestDynamicAllocationScheduling(t *testing.T) {
 	}
 }
 
+func TestBinpackerByInstanceGroup(t *testing.T) {
+	tests := []struct {
+		name                       string
+		binpackAlgoByInstanceGroup map[string]string
+		expectSuccess              bool
+	}{{
+		name:          "the default single az binpacker does not fit the application to a single zone",
+		expectSuccess: false,
+	}, {
+		name:                       "the binpacker of the instance group spreads the application over both zones",
+		binpackAlgoByInstanceGroup: map[string]string{"batch-medium-priority": "tightly-pack"},
+		expectSuccess:              true,
+	}, {
+		name:                       "the binpacker of other instance groups does not apply",
+		binpackAlgoByInstanceGroup: map[string]string{"other-instance-group": "tightly-pack"},
+		expectSuccess:              false,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node1 := extendertest.NewNode("node1", "zone1")
+			node2 := extendertest.NewNode("node2", "zone2")
+			// binpackers read zones from the legacy zone label
+			node1.Labels[v1.LabelZoneFailureDomain] = "zone1"
+			node2.Labels[v1.LabelZoneFailureDomain] = "zone2"
+			nodeNames := []string{node1.Name, node2.Name}
+			// the application needs 11 cpus, while each zone only has 8
+			podsToSchedule := extendertest.StaticAllocationSparkPods("10-executor-app", 10)
+
+			testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+				binpacker.SingleAzTightlyPack,
+				config.Install{BinpackAlgoByInstanceGroup: test.binpackAlgoByInstanceGroup},
+				&node1,
+				&node2,
+				&podsToSchedule[0],
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+
+			if test.expectSuccess {
+				testHarness.AssertSuccessfulSchedule(t, podsToSchedule[0], nodeNames, "The driver should fit across zones")
+			} else {
+				testHarness.AssertFailedSchedule(t, podsToSchedule[0], nodeNames, "The driver should not fit to a single zone")
+			}
+		})
+	}
+}
+
+func TestBinpackStrategyAnnotation(t *testing.T) {
+	tests := []struct {
+		name                     string
+		allowedBinpackStrategies []string
+		expectSuccess            bool
+	}{{
+		name:          "strategies which are not allowed fall back to the binpacker of the instance group",
+		expectSuccess: false,
+	}, {
+		name:                     "the allowed strategy spreads the application over both zones",
+		allowedBinpackStrategies: []string{"tightly-pack"},
+		expectSuccess:            true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node1 := extendertest.NewNode("node1", "zone1")
+			node2 := extendertest.NewNode("node2", "zone2")
+			node1.Labels[v1.LabelZoneFailureDomain] = "zone1"
+			node2.Labels[v1.LabelZoneFailureDomain] = "zone2"
+			nodeNames := []string{node1.Name, node2.Name}
+			podsToSchedule := extendertest.StaticAllocationSparkPods("10-executor-app", 10)
+			podsToSchedule[0].Annotations[common.BinpackStrategy] = "tightly-pack"
+
+			testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+				binpacker.SingleAzTightlyPack,
+				config.Install{AllowedBinpackStrategies: test.allowedBinpackStrategies},
+				&node1,
+				&node2,
+				&podsToSchedule[0],
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+
+			if !test.expectSuccess {
+				testHarness.AssertFailedSchedule(t, podsToSchedule[0], nodeNames, "The driver should not fit to a single zone")
+				return
+			}
+			testHarness.AssertSuccessfulSchedule(t, podsToSchedule[0], nodeNames, "The driver should fit across zones")
+			rr, ok := testHarness.ResourceReservationCache.Get(podsToSchedule[0].Namespace, "10-executor-app")
+			if !ok {
+				t.Fatal("expected a resource reservation to be created")
+			}
+			if strategy := rr.Annotations[common.BinpackStrategyAnnotation]; strategy != "tightly-pack" {
+				t.Errorf("expected the binpack strategy to be recorded on the resource reservation, got %q", strategy)
+			}
+		})
+	}
+}
+
+func TestScheduleTimerTaggedWithApplicationBinpacker(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node1.Labels[v1.LabelZoneFailureDomain] = "zone1"
+	nodeNames := []string{node1.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("strategy-app", 1)
+	podsToSchedule[0].Annotations[common.BinpackStrategy] = "tightly-pack"
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{AllowedBinpackStrategies: []string{"tightly-pack"}},
+		&node1,
+		&podsToSchedule[0],
+		&podsToSchedule[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	registry := metrics.NewRootMetricsRegistry()
+	ctx := metrics.WithRegistry(testHarness.Ctx, registry)
+	for _, pod := range podsToSchedule {
+		pod := pod
+		result := testHarness.Extender.Predicate(ctx, schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &nodeNames})
+		if result.NodeNames == nil || len(*result.NodeNames) == 0 {
+			t.Fatalf("%s should be scheduled, got %+v", pod.Name, result)
+		}
+	}
+
+	binpackerTags := make(map[string]bool)
+	registry.Each(func(name string, tags metrics.Tags, _ metrics.MetricVal) {
+		if name != "foundry.spark.scheduler.requests" {
+			return
+		}
+		for _, tag := range tags {
+			if tag.Key() == "binpacker" {
+				binpackerTags[tag.Value()] = true
+			}
+		}
+	})
+	if len(binpackerTags) != 1 || !binpackerTags["tightly-pack"] {
+		t.Errorf("driver and executor requests should be tagged with the binpack strategy of the application, got %v", binpackerTags)
+	}
+}
+
+func TestUnknownBinpackerOfInstanceGroup(t *testing.T) {
+	_, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{BinpackAlgoByInstanceGroup: map[string]string{"batch-medium-priority": "unknown-algorithm"}},
+	)
+	if err == nil {
+		t.Fatal("expected an unknown binpack algorithm of an instance group to be rejected")
+	}
+}
+
+func TestRegisteredBinpacker(t *testing.T) {
+	if _, ok := binpacker.LookupBinpacker("never-fits"); !ok {
+		err := binpacker.Register(binpacker.Binpacker{
+			Name: "never-fits",
+			BinpackFunc: func(ctx context.Context, driverResources, executorResources *resources.Resources, executorCount int,
+				driverNodePriorityOrder, executorNodePriorityOrder []string, nodesSchedulingMetadata resources.NodeGroupSchedulingMetadata) *binpack.PackingResult {
+				return binpack.EmptyPackingResult()
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := binpacker.Register(binpacker.Binpacker{Name: "never-fits", BinpackFunc: binpack.TightlyPack}); err == nil {
+		t.Error("expected registering a binpacker twice to fail")
+	}
+
+	node1 := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node1.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("2-executor-app", 2)
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{BinpackAlgoByInstanceGroup: map[string]string{"batch-medium-priority": "never-fits"}},
+		&node1,
+		&podsToSchedule[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender with a registered binpacker")
+	}
+	testHarness.AssertFailedSchedule(t, podsToSchedule[0], nodeNames, "The registered binpacker should be used for the instance group")
+}
+
 func executor(sparkApplicationId string, i int) string {
 	return fmt.Sprintf("%s-spark-exec-%d", sparkApplicationId, i)
 }
@@ -16,8 +16,10 @@ package extender
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -29,9 +31,11 @@ import (
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
 	"github.com/palantir/k8s-spark-scheduler/internal/metrics"
+	"github.com/palantir/k8s-spark-scheduler/internal/tracing"
 	"github.com/palantir/k8s-spark-scheduler/internal/types"
 	werror "github.com/palantir/witchcraft-go-error"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -50,19 +54,27 @@ type ResourceReservationManager interface {
 	GetResourceReservation(appID string, namespace string) (*v1beta2.ResourceReservation, bool)
 	PodHasReservation(ctx context.Context, pod *v1.Pod) bool
 	GetReservedResources() resources.NodeGroupResources
+	GetReservedExtendedResources() types.NodeGroupExtendedResources
 	CompactDynamicAllocationApplications(ctx context.Context)
 	ReserveForExecutorOnUnboundReservation(ctx context.Context, executor *v1.Pod, node string) error
 	ReserveForExecutorOnRescheduledNode(ctx context.Context, executor *v1.Pod, node string) error
+	MoveReservationForExecutor(ctx context.Context, executor *v1.Pod, node string) error
+	MoveReservationForDriver(ctx context.Context, driver *v1.Pod, node string) error
 	GetRemainingAllowedExecutorCount(ctx context.Context, appID string, namespace string) (int, error)
 	GetSoftResourceReservation(appID string) (*cache.SoftReservation, bool)
 	FindAlreadyBoundReservationNode(ctx context.Context, executor *v1.Pod) (string, bool, error)
 	FindUnboundReservationNodes(ctx context.Context, executor *v1.Pod) ([]string, bool, error)
+	ReleaseReservationForPod(ctx context.Context, pod *v1.Pod) error
+	ReleaseApplication(ctx context.Context, appID string, namespace string)
+	PersistSoftReservation(ctx context.Context, appID string, namespace string)
+	RestoreSoftReservations(ctx context.Context)
 	CreateReservations(
 		ctx context.Context,
 		driver *v1.Pod,
 		applicationResources *types.SparkApplicationResources,
 		driverNode string,
-		executorNodes []string) (*v1beta2.ResourceReservation, error)
+		executorNodes []string,
+		binpackStrategy string) (*v1beta2.ResourceReservation, error)
 }
 
 type defaultResourceReservationManager struct {
@@ -73,6 +85,7 @@ type defaultResourceReservationManager struct {
 	dynamicAllocationCompactionApps      map[string]string
 	dynamicAllocationCompactionSliceLock sync.Mutex
 	context                              context.Context
+	persistSoftReservations              bool
 }
 
 // NewResourceReservationManager creates and returns a ResourceReservationManager
@@ -81,12 +94,14 @@ func NewResourceReservationManager(
 	resourceReservations *cache.ResourceReservationCache,
 	softReservationStore *cache.SoftReservationStore,
 	podLister *SparkPodLister,
-	informer coreinformers.PodInformer) ResourceReservationManager {
+	informer coreinformers.PodInformer,
+	persistSoftReservations bool) ResourceReservationManager {
 	rrm := &defaultResourceReservationManager{
-		resourceReservations: resourceReservations,
-		softReservationStore: softReservationStore,
-		podLister:            podLister,
-		context:              ctx,
+		resourceReservations:    resourceReservations,
+		softReservationStore:    softReservationStore,
+		podLister:               podLister,
+		context:                 ctx,
+		persistSoftReservations: persistSoftReservations,
 	}
 
 	informer.Informer().AddEventHandler(
@@ -97,6 +112,14 @@ func NewResourceReservationManager(
 			},
 		},
 	)
+	informer.Informer().AddEventHandler(
+		clientcache.FilteringResourceEventHandler{
+			FilterFunc: utils.IsSparkSchedulerPod,
+			Handler: clientcache.ResourceEventHandlerFuncs{
+				UpdateFunc: utils.OnPodScheduled(ctx, rrm.onDriverPodScheduled),
+			},
+		},
+	)
 
 	return rrm
 }
@@ -132,18 +155,23 @@ func (rrm *defaultResourceReservationManager) PodHasReservation(ctx context.Cont
 }
 
 // CreateReservations creates the necessary reservations for an application whether those are resource reservation objects or
-// in-memory soft reservations for extra executors.
+// in-memory soft reservations for extra executors. The binpack strategy the driver selected, if any, is recorded on the
+// resource reservation.
 func (rrm *defaultResourceReservationManager) CreateReservations(
 	ctx context.Context,
 	driver *v1.Pod,
 	applicationResources *types.SparkApplicationResources,
 	driverNode string,
-	executorNodes []string) (*v1beta2.ResourceReservation, error) {
+	executorNodes []string,
+	binpackStrategy string) (*v1beta2.ResourceReservation, error) {
+	span, ctx := tracing.StartSpan(ctx, "create-reservations", tracing.PodTags(driver)...)
+	defer span.Finish()
 	rr, ok := rrm.GetResourceReservation(driver.Labels[common.SparkAppIDLabel], driver.Namespace)
 	if !ok {
-		rr = newResourceReservation(driverNode, executorNodes, driver, applicationResources.DriverResources, applicationResources.ExecutorResources)
+		rr = newResourceReservation(driverNode, executorNodes, driver, applicationResources, binpackStrategy)
 		svc1log.FromContext(ctx).Debug("creating executor resource reservations", svc1log.SafeParams(logging.RRSafeParamV1Beta2(rr)))
-		err := rrm.resourceReservations.Create(rr)
+		err := rrm.resourceReservations.Create(ctx, rr)
+		tracing.TagError(span, err)
 		if err != nil {
 			return nil, werror.WrapWithContextParams(ctx, err, "failed to create resource reservation", werror.SafeParam("reservationName", rr.Name))
 		}
@@ -227,19 +255,86 @@ func (rrm *defaultResourceReservationManager) ReserveForExecutorOnUnboundReserva
 	return werror.ErrorWithContextParams(ctx, "failed to find free reservation on requested node for executor")
 }
 
+// ReleaseReservationForPod gives back the reservation held by the passed pod. For a driver this removes all of the
+// application's reservations, for an executor only the reservation it is bound to is freed up for another executor.
+func (rrm *defaultResourceReservationManager) ReleaseReservationForPod(ctx context.Context, pod *v1.Pod) error {
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	return rrm.releaseReservationForPod(ctx, pod)
+}
+
+func (rrm *defaultResourceReservationManager) releaseReservationForPod(ctx context.Context, pod *v1.Pod) error {
+	appID := pod.Labels[common.SparkAppIDLabel]
+	if pod.Labels[common.SparkRoleLabel] == common.Driver {
+		rrm.releaseApplication(ctx, appID, pod.Namespace)
+		return nil
+	}
+
+	if resourceReservation, ok := rrm.GetResourceReservation(appID, pod.Namespace); ok {
+		for reservationName, podName := range resourceReservation.Status.Pods {
+			if reservationName == common.Driver || podName != pod.Name {
+				continue
+			}
+			copyResourceReservation := resourceReservation.DeepCopy()
+			delete(copyResourceReservation.Status.Pods, reservationName)
+			if err := rrm.resourceReservations.Update(ctx, copyResourceReservation); err != nil {
+				return werror.WrapWithContextParams(ctx, err, "failed to release resource reservation", werror.SafeParam("reservationName", reservationName))
+			}
+			return nil
+		}
+	}
+	rrm.softReservationStore.ReleaseExecutorReservation(appID, pod.Name)
+	rrm.persistSoftReservation(ctx, appID, pod.Namespace)
+	return nil
+}
+
+// ReleaseApplication removes the resource reservation and the soft reservations of the passed application
+func (rrm *defaultResourceReservationManager) ReleaseApplication(ctx context.Context, appID string, namespace string) {
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	rrm.releaseApplication(ctx, appID, namespace)
+}
+
+func (rrm *defaultResourceReservationManager) releaseApplication(ctx context.Context, appID string, namespace string) {
+	rrm.resourceReservations.Delete(ctx, namespace, appID)
+	rrm.softReservationStore.RemoveDriverReservation(appID)
+}
+
 // ReserveForExecutorOnRescheduledNode creates a reservation for the passed executor on the passed node by replacing another unbound reservation.
 // This reservation could either be a resource reservation, or a soft reservation if dynamic allocation is enabled.
 func (rrm *defaultResourceReservationManager) ReserveForExecutorOnRescheduledNode(ctx context.Context, executor *v1.Pod, node string) error {
 	rrm.mutex.Lock()
 	defer rrm.mutex.Unlock()
+	return rrm.reserveForExecutorOnRescheduledNode(ctx, executor, node)
+}
+
+// MoveReservationForExecutor releases the reservation the passed executor holds, if any, and reserves the passed node for
+// it instead. Both happen while holding the lock, so that no other executor can take the released reservation.
+func (rrm *defaultResourceReservationManager) MoveReservationForExecutor(ctx context.Context, executor *v1.Pod, node string) error {
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	if err := rrm.releaseReservationForPod(ctx, executor); err != nil {
+		return err
+	}
+	return rrm.reserveForExecutorOnRescheduledNode(ctx, executor, node)
+}
 
+func (rrm *defaultResourceReservationManager) reserveForExecutorOnRescheduledNode(ctx context.Context, executor *v1.Pod, node string) error {
 	unboundReservationsToNodes, err := rrm.getUnboundReservations(ctx, executor.Labels[common.SparkAppIDLabel], executor.Namespace)
 	if err != nil {
 		return err
 	}
 
 	if len(unboundReservationsToNodes) > 0 {
-		return rrm.bindExecutorToResourceReservation(ctx, executor, getAKeyFromMap(unboundReservationsToNodes), node)
+		// an unbound reservation already on the node is taken over first, so that the reserved resources stay in place
+		reservationName := getAKeyFromMap(unboundReservationsToNodes)
+		for name, reservationNode := range unboundReservationsToNodes {
+			if reservationNode == node {
+				reservationName = name
+				break
+			}
+		}
+		return rrm.bindExecutorToResourceReservation(ctx, executor, reservationName, node)
 	}
 
 	// Try to get a soft reservation if it is a dynamic allocation application
@@ -248,7 +343,11 @@ func (rrm *defaultResourceReservationManager) ReserveForExecutorOnRescheduledNod
 		return werror.WrapWithContextParams(ctx, err, "failed to count free extra executor spots remaining")
 	}
 	if extraExecutorFreeSpots > 0 {
-		return rrm.bindExecutorToSoftReservation(ctx, executor, node)
+		if err := rrm.bindExecutorToSoftReservation(ctx, executor, node); err != nil {
+			return err
+		}
+		rrm.persistSoftReservation(ctx, executor.Labels[common.SparkAppIDLabel], executor.Namespace)
+		return nil
 	}
 
 	return werror.ErrorWithContextParams(ctx, "failed to find free reservation for executor")
@@ -262,6 +361,13 @@ func (rrm *defaultResourceReservationManager) GetReservedResources() resources.N
 	return usage
 }
 
+// GetReservedExtendedResources returns the extended resources per node that are reserved for drivers and executors.
+func (rrm *defaultResourceReservationManager) GetReservedExtendedResources() types.NodeGroupExtendedResources {
+	usage := types.ExtendedResourceUsageForNodes(rrm.resourceReservations.List())
+	usage.Add(rrm.softReservationStore.UsedSoftReservationExtendedResources())
+	return usage
+}
+
 // CompactDynamicAllocationApplications compacts reservations for executors belonging to dynamic allocation applications by moving
 // any soft reservations to resource reservations occupied by now-dead executors. This ensures we have relatively up to date resource
 // reservation objects and report correctly on reserved usage.
@@ -269,6 +375,9 @@ func (rrm *defaultResourceReservationManager) CompactDynamicAllocationApplicatio
 	timer := metrics.GetAndStartSoftReservationCompactionTimer()
 	defer timer.MarkCompactionComplete(ctx)
 	dynamicAllocationAppsToCompact := rrm.drainDynamicAllocationCompactionApps()
+	span, ctx := tracing.StartSpan(ctx, "compact-dynamic-allocation-applications",
+		wtracing.WithSpanTag("spark.app.count", strconv.Itoa(len(dynamicAllocationAppsToCompact))))
+	defer span.Finish()
 
 	rrm.mutex.Lock()
 	defer rrm.mutex.Unlock()
@@ -320,6 +429,7 @@ func (rrm *defaultResourceReservationManager) compactSoftReservationPod(ctx cont
 					return
 				}
 				rrm.softReservationStore.RemoveExecutorReservation(appID, pod.Name)
+				rrm.persistSoftReservation(ctx, appID, pod.Namespace)
 				return
 			}
 		}
@@ -332,6 +442,87 @@ func (rrm *defaultResourceReservationManager) compactSoftReservationPod(ctx cont
 			return
 		}
 		rrm.softReservationStore.RemoveExecutorReservation(appID, pod.Name)
+		rrm.persistSoftReservation(ctx, appID, pod.Namespace)
+	}
+}
+
+// PersistSoftReservation writes the soft reservation of the application to the annotation of its resource reservation
+// through the async client, if soft reservations are persisted.
+func (rrm *defaultResourceReservationManager) PersistSoftReservation(ctx context.Context, appID string, namespace string) {
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	rrm.persistSoftReservation(ctx, appID, namespace)
+}
+
+// persistSoftReservation is a helper method of PersistSoftReservation and is assumed to have been called inside a lock
+// of the rrm.mutex, so that it does not race with other updates of the resource reservation
+func (rrm *defaultResourceReservationManager) persistSoftReservation(ctx context.Context, appID string, namespace string) {
+	if !rrm.persistSoftReservations {
+		return
+	}
+	rr, ok := rrm.GetResourceReservation(appID, namespace)
+	if !ok {
+		return
+	}
+	sr, ok := rrm.softReservationStore.GetSoftReservation(appID)
+	if !ok {
+		return
+	}
+	serialized, err := json.Marshal(sr)
+	if err != nil {
+		svc1log.FromContext(ctx).Error("failed to serialize soft reservation", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
+		return
+	}
+	if rr.Annotations[common.SoftReservationsAnnotation] == string(serialized) {
+		return
+	}
+	copyResourceReservation := rr.DeepCopy()
+	if copyResourceReservation.Annotations == nil {
+		copyResourceReservation.Annotations = make(map[string]string, 1)
+	}
+	copyResourceReservation.Annotations[common.SoftReservationsAnnotation] = string(serialized)
+	if err := rrm.resourceReservations.Update(ctx, copyResourceReservation); err != nil {
+		svc1log.FromContext(ctx).Error("failed to persist soft reservation", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
+	}
+}
+
+// RestoreSoftReservations loads the soft reservations persisted on resource reservations into the SoftReservationStore,
+// if soft reservations are persisted. Reservations of executors which are no longer active are restored as dead ones.
+func (rrm *defaultResourceReservationManager) RestoreSoftReservations(ctx context.Context) {
+	if !rrm.persistSoftReservations {
+		return
+	}
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	for _, rr := range rrm.resourceReservations.List() {
+		serialized, ok := rr.Annotations[common.SoftReservationsAnnotation]
+		if !ok {
+			continue
+		}
+		appID := rr.Name
+		var sr cache.SoftReservation
+		if err := json.Unmarshal([]byte(serialized), &sr); err != nil {
+			svc1log.FromContext(ctx).Error("failed to parse persisted soft reservation, skipping", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
+			continue
+		}
+		activePods, err := rrm.getActivePods(ctx, appID, rr.Namespace)
+		if err != nil {
+			svc1log.FromContext(ctx).Error("failed to get active pods of application, skipping", svc1log.SafeParam("appID", appID), svc1log.Stacktrace(err))
+			continue
+		}
+		if sr.Reservations == nil {
+			sr.Reservations = make(map[string]v1beta2.Reservation)
+		}
+		if sr.Status == nil {
+			sr.Status = make(map[string]bool)
+		}
+		for podName := range sr.Reservations {
+			if _, ok := activePods[podName]; !ok {
+				delete(sr.Reservations, podName)
+				sr.Status[podName] = false
+			}
+		}
+		rrm.softReservationStore.RestoreSoftReservation(appID, &sr)
 	}
 }
 
@@ -356,7 +547,7 @@ func (rrm *defaultResourceReservationManager) bindExecutorToResourceReservation(
 	reservationObject.Node = node
 	copyResourceReservation.Spec.Reservations[reservationName] = reservationObject
 	copyResourceReservation.Status.Pods[reservationName] = executor.Name
-	err := rrm.resourceReservations.Update(copyResourceReservation)
+	err := rrm.resourceReservations.Update(ctx, copyResourceReservation)
 	if err != nil {
 		return werror.WrapWithContextParams(ctx, err, "failed to update resource reservationName", werror.SafeParam("reservationName", reservationName))
 	}
@@ -393,17 +584,13 @@ func (rrm *defaultResourceReservationManager) bindExecutorToSoftReservation(ctx
 	if err != nil {
 		return err
 	}
-	sparkResources, err := sparkResources(ctx, driver)
+	sparkResources, err := rrm.podLister.sparkResources(ctx, driver)
 	if err != nil {
 		return err
 	}
 	softReservation := v1beta2.Reservation{
-		Node: node,
-		Resources: v1beta2.ResourceList{
-			string(v1beta2.ResourceCPU):       &sparkResources.ExecutorResources.CPU,
-			string(v1beta2.ResourceMemory):    &sparkResources.ExecutorResources.Memory,
-			string(v1beta2.ResourceNvidiaGPU): &sparkResources.ExecutorResources.NvidiaGPU,
-		},
+		Node:      node,
+		Resources: reservationResources(sparkResources.ExecutorResources, sparkResources.ExecutorExtendedResources),
 	}
 	return rrm.softReservationStore.AddReservationForPod(ctx, driver.Labels[common.SparkAppIDLabel], executor.Name, softReservation)
 }
@@ -442,7 +629,7 @@ func (rrm *defaultResourceReservationManager) getFreeSoftReservationSpots(ctx co
 	if err != nil {
 		return 0, err
 	}
-	sparkResources, err := sparkResources(ctx, driver)
+	sparkResources, err := rrm.podLister.sparkResources(ctx, driver)
 	if err != nil {
 		return 0, err
 	}
@@ -481,6 +668,53 @@ func (rrm *defaultResourceReservationManager) onExecutorPodDeletion(obj interfac
 	}
 }
 
+// onDriverPodScheduled moves the driver reservation to the node the driver was bound to, which can differ from the
+// reserved node when the scheduler chooses among several fitting nodes
+func (rrm *defaultResourceReservationManager) onDriverPodScheduled(pod *v1.Pod) {
+	if pod.Labels[common.SparkRoleLabel] != common.Driver || pod.Spec.NodeName == "" {
+		return
+	}
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	rr, ok := rrm.GetResourceReservation(pod.Labels[common.SparkAppIDLabel], pod.Namespace)
+	if !ok {
+		return
+	}
+	driverReservation, ok := rr.Spec.Reservations[common.Driver]
+	if !ok || driverReservation.Node == pod.Spec.NodeName {
+		return
+	}
+	svc1log.FromContext(rrm.context).Info("driver was bound to a node other than its reserved node, moving its reservation",
+		svc1log.SafeParam("sparkAppID", pod.Labels[common.SparkAppIDLabel]),
+		svc1log.SafeParam("reservedNodeName", driverReservation.Node),
+		svc1log.SafeParam("nodeName", pod.Spec.NodeName))
+	if err := rrm.moveDriverReservation(rrm.context, rr, pod.Spec.NodeName); err != nil {
+		svc1log.FromContext(rrm.context).Error("failed to move driver reservation", svc1log.Stacktrace(err))
+	}
+}
+
+// MoveReservationForDriver moves the driver reservation of the passed driver's application to the passed node
+func (rrm *defaultResourceReservationManager) MoveReservationForDriver(ctx context.Context, driver *v1.Pod, node string) error {
+	rrm.mutex.Lock()
+	defer rrm.mutex.Unlock()
+	rr, ok := rrm.GetResourceReservation(driver.Labels[common.SparkAppIDLabel], driver.Namespace)
+	if !ok {
+		return werror.ErrorWithContextParams(ctx, "failed to get resource reservation")
+	}
+	return rrm.moveDriverReservation(ctx, rr, node)
+}
+
+func (rrm *defaultResourceReservationManager) moveDriverReservation(ctx context.Context, rr *v1beta2.ResourceReservation, node string) error {
+	driverReservation, ok := rr.Spec.Reservations[common.Driver]
+	if !ok || driverReservation.Node == node {
+		return nil
+	}
+	copyResourceReservation := rr.DeepCopy()
+	driverReservation.Node = node
+	copyResourceReservation.Spec.Reservations[common.Driver] = driverReservation
+	return rrm.resourceReservations.Update(ctx, copyResourceReservation)
+}
+
 func (rrm *defaultResourceReservationManager) addPodForDynamicAllocationCompaction(pod *v1.Pod) {
 	rrm.dynamicAllocationCompactionSliceLock.Lock()
 	defer rrm.dynamicAllocationCompactionSliceLock.Unlock()
@@ -488,26 +722,27 @@ func (rrm *defaultResourceReservationManager) addPodForDynamicAllocationCompacti
 }
 
 // newResourceReservation builds a reservation object with the pods and resources passed and returns it.
-func newResourceReservation(driverNode string, executorNodes []string, driver *v1.Pod, driverResources, executorResources *resources.Resources) *v1beta2.ResourceReservation {
+func newResourceReservation(
+	driverNode string,
+	executorNodes []string,
+	driver *v1.Pod,
+	applicationResources *types.SparkApplicationResources,
+	binpackStrategy string) *v1beta2.ResourceReservation {
 	reservations := make(map[string]v1beta2.Reservation, len(executorNodes)+1)
 	reservations["driver"] = v1beta2.Reservation{
-		Node: driverNode,
-		Resources: v1beta2.ResourceList{
-			string(v1beta2.ResourceCPU):       &driverResources.CPU,
-			string(v1beta2.ResourceMemory):    &driverResources.Memory,
-			string(v1beta2.ResourceNvidiaGPU): &driverResources.NvidiaGPU,
-		},
+		Node:      driverNode,
+		Resources: reservationResources(applicationResources.DriverResources, applicationResources.DriverExtendedResources),
 	}
 	for idx, nodeName := range executorNodes {
 		reservations[executorReservationName(idx)] = v1beta2.Reservation{
-			Node: nodeName,
-			Resources: v1beta2.ResourceList{
-				string(v1beta2.ResourceCPU):       &executorResources.CPU,
-				string(v1beta2.ResourceMemory):    &executorResources.Memory,
-				string(v1beta2.ResourceNvidiaGPU): &executorResources.NvidiaGPU,
-			},
+			Node:      nodeName,
+			Resources: reservationResources(applicationResources.ExecutorResources, applicationResources.ExecutorExtendedResources),
 		}
 	}
+	var annotations map[string]string
+	if binpackStrategy != "" {
+		annotations = map[string]string{common.BinpackStrategyAnnotation: binpackStrategy}
+	}
 	return &v1beta2.ResourceReservation{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              driver.Labels[common.SparkAppIDLabel],
@@ -517,6 +752,7 @@ func newResourceReservation(driverNode string, executorNodes []string, driver *v
 			Labels: map[string]string{
 				v1beta1.AppIDLabel: driver.Labels[common.SparkAppIDLabel],
 			},
+			Annotations: annotations,
 		},
 		Spec: v1beta2.ResourceReservationSpec{
 			Reservations: reservations,
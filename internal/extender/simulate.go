@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	werror "github.com/palantir/witchcraft-go-error"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1affinityhelper "k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+const (
+	simulatedNamespace = "default"
+	// maxSimulatedExecutorCount bounds the search for the largest executor count that fits
+	maxSimulatedExecutorCount = 1 << 14
+)
+
+// SimulationRequest describes an application to simulate the scheduling of
+type SimulationRequest struct {
+	DriverResources   SimulatedResources `json:"driverResources"`
+	ExecutorResources SimulatedResources `json:"executorResources"`
+	ExecutorCount     int                `json:"executorCount"`
+	InstanceGroup     string             `json:"instanceGroup"`
+	NodeSelector      map[string]string  `json:"nodeSelector,omitempty"`
+	// Namespace is the namespace the application would be submitted to, which selects its queue and tenant
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SimulatedResources holds the resources of the driver or of an executor of a simulated application, as quantities
+type SimulatedResources struct {
+	CPU       string `json:"cpu"`
+	Memory    string `json:"memory"`
+	NvidiaGPU string `json:"nvidiaGpu,omitempty"`
+	// Extended holds any other resources by name
+	Extended map[string]string `json:"extended,omitempty"`
+}
+
+// SimulationResult describes whether a simulated application would be scheduled now
+type SimulationResult struct {
+	Fits    bool   `json:"fits"`
+	Outcome string `json:"outcome"`
+	// Reason is the reason the application would fail to schedule, if it would
+	Reason    string                `json:"reason,omitempty"`
+	Placement *PlacementExplanation `json:"placement,omitempty"`
+	// MaxExecutorCount is the largest number of executors that would fit along with the driver, after the drivers
+	// waiting ahead of it and the applications it would preempt
+	MaxExecutorCount int `json:"maxExecutorCount"`
+}
+
+// Simulate plans the scheduling of an application of the requested shape behind the currently pending drivers, without
+// making any reservation, demand or preemption
+func (s *SparkSchedulerExtender) Simulate(ctx context.Context, request SimulationRequest) (*SimulationResult, error) {
+	driver, err := s.simulatedDriver(request)
+	if err != nil {
+		return nil, err
+	}
+	// validate the requested resources before planning, so that invalid requests are not reported as scheduling failures
+	if _, err := s.podLister.sparkResources(ctx, driver); err != nil {
+		return nil, err
+	}
+	nodes, err := utils.ListWithPredicate(s.nodeLister, func(node *v1.Node) (bool, error) {
+		return v1affinityhelper.GetRequiredNodeAffinity(driver).Match(node)
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+
+	plan, outcome, err := s.planDriver(ctx, request.InstanceGroup, driver, nodeNames)
+	result := &SimulationResult{
+		Fits:    s.isSuccessOutcome(outcome),
+		Outcome: outcome,
+	}
+	if err != nil {
+		result.Reason = err.Error()
+	}
+	if plan == nil {
+		return result, nil
+	}
+	if plan.packingResult != nil && plan.packingResult.HasCapacity {
+		result.Placement = &PlacementExplanation{
+			HasCapacity:   true,
+			DriverNode:    plan.packingResult.DriverNode,
+			ExecutorNodes: plan.packingResult.ExecutorNodes,
+		}
+	}
+	if outcome != failureEarlierDriver && outcome != failureQueueQuota {
+		result.MaxExecutorCount = s.maxExecutorCount(ctx, plan)
+	}
+	return result, nil
+}
+
+// maxExecutorCount finds the largest executor count the binpacker fits along with the driver, on the resources the plan
+// was packed on, which are the ones left after the drivers ahead and freed by the preemptions of the plan
+func (s *SparkSchedulerExtender) maxExecutorCount(ctx context.Context, plan *driverPlan) int {
+	fits := func(count int) bool {
+		applicationResources := *plan.sc.applicationResources
+		applicationResources.MinExecutorCount = count
+		applicationResources.MaxExecutorCount = count
+		return plan.sc.binpacker.BinpackApplication(
+			ctx,
+			&applicationResources,
+			plan.sc.driverNodeNames,
+			plan.sc.executorNodeNames,
+			plan.nodesSchedulingMetadata,
+			plan.availableExtendedResources).HasCapacity
+	}
+	if !fits(0) {
+		return 0
+	}
+	low, high := 0, 1
+	for high <= maxSimulatedExecutorCount && fits(high) {
+		low, high = high, high*2
+	}
+	if high > maxSimulatedExecutorCount {
+		return low
+	}
+	// low fits and high does not
+	for high-low > 1 {
+		mid := (low + high) / 2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// simulatedDriver creates a driver pod with the annotations of the requested application, that is younger than every
+// pending driver
+func (s *SparkSchedulerExtender) simulatedDriver(request SimulationRequest) (*v1.Pod, error) {
+	if request.InstanceGroup == "" {
+		return nil, werror.Error("instanceGroup is required")
+	}
+	if request.ExecutorCount < 0 {
+		return nil, werror.Error("executorCount can not be negative")
+	}
+	annotations := map[string]string{
+		common.DriverCPU:      request.DriverResources.CPU,
+		common.DriverMemory:   request.DriverResources.Memory,
+		common.ExecutorCPU:    request.ExecutorResources.CPU,
+		common.ExecutorMemory: request.ExecutorResources.Memory,
+		common.ExecutorCount:  strconv.Itoa(request.ExecutorCount),
+	}
+	if request.DriverResources.NvidiaGPU != "" {
+		annotations[common.DriverNvidiaGPUs] = request.DriverResources.NvidiaGPU
+	}
+	if request.ExecutorResources.NvidiaGPU != "" {
+		annotations[common.ExecutorNvidiaGPUs] = request.ExecutorResources.NvidiaGPU
+	}
+	for name, quantity := range request.DriverResources.Extended {
+		annotations[common.DriverResourcePrefix+name] = quantity
+	}
+	for name, quantity := range request.ExecutorResources.Extended {
+		annotations[common.ExecutorResourcePrefix+name] = quantity
+	}
+	nodeSelector := make(map[string]string, len(request.NodeSelector)+1)
+	for key, value := range request.NodeSelector {
+		nodeSelector[key] = value
+	}
+	nodeSelector[s.instanceGroupLabel] = request.InstanceGroup
+	namespace := request.Namespace
+	if namespace == "" {
+		namespace = simulatedNamespace
+	}
+	now := time.Now()
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("simulated-driver-%d", now.UnixNano()),
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(now),
+			Labels: map[string]string{
+				common.SparkRoleLabel: common.Driver,
+			},
+			Annotations: annotations,
+		},
+		Spec: v1.PodSpec{
+			SchedulerName: common.SparkSchedulerName,
+			NodeSelector:  nodeSelector,
+		},
+	}, nil
+}
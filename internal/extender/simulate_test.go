@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+)
+
+func TestSimulate(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	pendingApp := extendertest.StaticAllocationSparkPodsWithSizes("pending-app", 0, "1", "5", "1", "1")
+	pendingApp[0].Spec.SchedulerName = common.SparkSchedulerName
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&pendingApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	tests := []struct {
+		name                     string
+		executorCount            int
+		expectedFits             bool
+		expectedMaxExecutorCount int
+	}{{
+		name:                     "fits on what the pending application leaves",
+		executorCount:            2,
+		expectedFits:             true,
+		expectedMaxExecutorCount: 2,
+	}, {
+		name:                     "does not fit once the pending application is accounted for",
+		executorCount:            3,
+		expectedFits:             false,
+		expectedMaxExecutorCount: 2,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := testHarness.Extender.Simulate(testHarness.Ctx, extender.SimulationRequest{
+				DriverResources:   extender.SimulatedResources{CPU: "1", Memory: "1Gi"},
+				ExecutorResources: extender.SimulatedResources{CPU: "1", Memory: "1Gi"},
+				ExecutorCount:     test.executorCount,
+				InstanceGroup:     "batch-medium-priority",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Fits != test.expectedFits {
+				t.Errorf("expected fits to be %v, got %v with outcome %v", test.expectedFits, result.Fits, result.Outcome)
+			}
+			if test.expectedFits && (result.Placement == nil || len(result.Placement.ExecutorNodes) != test.executorCount) {
+				t.Errorf("expected a placement for %d executors, got %v", test.executorCount, result.Placement)
+			}
+			if result.MaxExecutorCount != test.expectedMaxExecutorCount {
+				t.Errorf("expected at most %d executors to fit, got %d", test.expectedMaxExecutorCount, result.MaxExecutorCount)
+			}
+		})
+	}
+
+	if _, err := testHarness.Extender.Simulate(testHarness.Ctx, extender.SimulationRequest{InstanceGroup: "batch-medium-priority"}); err == nil {
+		t.Error("expected a request without resources to be rejected")
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(pendingApp[0].Namespace, "pending-app"); ok {
+		t.Error("simulating should not reserve resources")
+	}
+}
+
+func TestSimulatePreemption(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	lowPriorityApp := extendertest.StaticAllocationSparkPodsWithSizes("low-priority-app", 1, "1", "4", "1", "4")
+	lowPriority := int32(-1)
+	for i := range lowPriorityApp {
+		lowPriorityApp[i].Spec.Priority = &lowPriority
+	}
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{EnablePreemption: true},
+		&node1,
+		&lowPriorityApp[0],
+		&lowPriorityApp[1],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	for _, pod := range lowPriorityApp {
+		testHarness.AssertSuccessfulSchedule(t, pod, []string{node1.Name}, "There should be enough capacity to schedule the low priority application")
+	}
+
+	result, err := testHarness.Extender.Simulate(testHarness.Ctx, extender.SimulationRequest{
+		DriverResources:   extender.SimulatedResources{CPU: "1", Memory: "1Gi"},
+		ExecutorResources: extender.SimulatedResources{CPU: "1", Memory: "1Gi"},
+		ExecutorCount:     2,
+		InstanceGroup:     "batch-medium-priority",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Fits {
+		t.Fatalf("expected the application to fit by preempting the low priority application, got outcome %v", result.Outcome)
+	}
+	if result.MaxExecutorCount != 7 {
+		t.Errorf("expected the executors to fit on the resources freed by preemption, got %d", result.MaxExecutorCount)
+	}
+	if _, ok := testHarness.ResourceReservationCache.Get(lowPriorityApp[0].Namespace, "low-priority-app"); !ok {
+		t.Error("simulating should not preempt applications")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/crd"
+	"github.com/palantir/k8s-spark-scheduler/internal/events"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	clientcache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	sparkApplicationKind = "SparkApplication"
+
+	reasonInsufficientCapacity    = events.ReasonInsufficientCapacity
+	reasonWaitingForEarlierDriver = events.ReasonWaitingForEarlierDriver
+	reasonExceedsClusterCapacity  = events.ReasonExceedsClusterCapacity
+)
+
+// outcomeEventReasons are the reasons of the events recorded on SparkApplications for scheduling outcomes
+var outcomeEventReasons = map[string]string{
+	failureFit:           reasonInsufficientCapacity,
+	failureEarlierDriver: reasonWaitingForEarlierDriver,
+}
+
+// SparkApplicationReader resolves the resources of drivers created by the spark-operator from their SparkApplication,
+// and records the scheduling outcomes of these drivers as events on it
+type SparkApplicationReader struct {
+	sparkApplications clientcache.Indexer
+	podEvents         events.PodEventRecorder
+	lastReasonsLock   sync.Mutex
+	lastReasons       map[string]recordedReason
+}
+
+type recordedReason struct {
+	uid    k8stypes.UID
+	reason string
+}
+
+// NewSparkApplicationReader creates a new SparkApplicationReader over an indexer of unstructured SparkApplications
+func NewSparkApplicationReader(sparkApplications clientcache.Indexer, podEvents events.PodEventRecorder) *SparkApplicationReader {
+	return &SparkApplicationReader{
+		sparkApplications: sparkApplications,
+		podEvents:         podEvents,
+		lastReasons:       make(map[string]recordedReason),
+	}
+}
+
+// withSparkApplicationAnnotations returns a copy of the driver with the resource annotations it does not set derived
+// from its SparkApplication, or the driver itself if it was not created by the spark-operator
+func (r *SparkApplicationReader) withSparkApplicationAnnotations(ctx context.Context, driver *v1.Pod) *v1.Pod {
+	sparkApplication, ok := r.sparkApplication(driver)
+	if !ok {
+		return driver
+	}
+	var spec types.SparkApplicationSpec
+	if rawSpec, ok := sparkApplication.Object["spec"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+			svc1log.FromContext(ctx).Warn("failed to parse the spec of the SparkApplication of driver",
+				svc1log.SafeParam("driverName", driver.Name),
+				svc1log.SafeParam("reason", err.Error()))
+			return driver
+		}
+	}
+	annotations, err := sparkConfAnnotations(sparkApplicationConf(spec))
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to derive resources from the SparkApplication of driver",
+			svc1log.SafeParam("driverName", driver.Name),
+			svc1log.SafeParam("reason", err.Error()))
+		return driver
+	}
+	return withDerivedAnnotations(driver, annotations)
+}
+
+// recordOutcome records an event on the SparkApplication of the driver when the driver fails to schedule for a
+// reason other than the last one recorded
+func (r *SparkApplicationReader) recordOutcome(ctx context.Context, driver *v1.Pod, outcome string, message string) {
+	reason, ok := outcomeEventReasons[outcome]
+	if !ok {
+		if outcome == success || outcome == successBackfilled || outcome == successPreempted {
+			r.lastReasonsLock.Lock()
+			delete(r.lastReasons, driver.Namespace+"/"+driver.Labels[common.SparkOperatorAppNameLabel])
+			r.lastReasonsLock.Unlock()
+		}
+		return
+	}
+	r.recordEvent(ctx, driver, reason, message)
+}
+
+// recordExceedsClusterCapacity records an event on the SparkApplication of a driver which would not fit to the cluster
+// even if it was empty
+func (r *SparkApplicationReader) recordExceedsClusterCapacity(ctx context.Context, driver *v1.Pod) {
+	r.recordEvent(ctx, driver, reasonExceedsClusterCapacity, "application does not fit to the cluster even if it was empty")
+}
+
+func (r *SparkApplicationReader) recordEvent(ctx context.Context, driver *v1.Pod, reason string, message string) {
+	sparkApplication, ok := r.sparkApplication(driver)
+	if !ok {
+		return
+	}
+	key := sparkApplication.GetNamespace() + "/" + sparkApplication.GetName()
+	recorded := recordedReason{uid: sparkApplication.GetUID(), reason: reason}
+	r.lastReasonsLock.Lock()
+	if r.lastReasons[key] == recorded {
+		r.lastReasonsLock.Unlock()
+		return
+	}
+	r.lastReasons[key] = recorded
+	r.pruneLastReasons()
+	r.lastReasonsLock.Unlock()
+
+	r.podEvents.ObjectEvent(v1.ObjectReference{
+		APIVersion: crd.SparkApplicationGroupVersion.String(),
+		Kind:       sparkApplicationKind,
+		Namespace:  sparkApplication.GetNamespace(),
+		Name:       sparkApplication.GetName(),
+		UID:        sparkApplication.GetUID(),
+	}, v1.EventTypeWarning, reason, message)
+}
+
+// pruneLastReasons forgets the reasons recorded for SparkApplications that no longer exist, expects the lock to be held
+func (r *SparkApplicationReader) pruneLastReasons() {
+	for key := range r.lastReasons {
+		if _, exists, err := r.sparkApplications.GetByKey(key); err == nil && !exists {
+			delete(r.lastReasons, key)
+		}
+	}
+}
+
+func (r *SparkApplicationReader) sparkApplication(driver *v1.Pod) (*unstructured.Unstructured, bool) {
+	name, ok := driver.Labels[common.SparkOperatorAppNameLabel]
+	if !ok {
+		return nil, false
+	}
+	obj, exists, err := r.sparkApplications.GetByKey(driver.Namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	sparkApplication, ok := obj.(*unstructured.Unstructured)
+	return sparkApplication, ok
+}
+
+// sparkApplicationConf translates the spec of a SparkApplication into the spark configuration the spark-operator
+// submits it with
+func sparkApplicationConf(spec types.SparkApplicationSpec) map[string]string {
+	conf := make(map[string]string, len(spec.SparkConf))
+	for key, value := range spec.SparkConf {
+		conf[key] = value
+	}
+	addPodSpecConf(spec.Driver, "driver", conf)
+	addPodSpecConf(spec.Executor, "executor", conf)
+	if spec.Executor.Instances != nil {
+		conf["spark.executor.instances"] = strconv.Itoa(int(*spec.Executor.Instances))
+	}
+	if spec.MemoryOverheadFactor != nil {
+		conf["spark.kubernetes.memoryOverheadFactor"] = *spec.MemoryOverheadFactor
+	}
+	if da := spec.DynamicAllocation; da != nil && da.Enabled {
+		conf["spark.dynamicAllocation.enabled"] = "true"
+		if da.MinExecutors != nil {
+			conf["spark.dynamicAllocation.minExecutors"] = strconv.Itoa(int(*da.MinExecutors))
+		}
+		if da.MaxExecutors != nil {
+			conf["spark.dynamicAllocation.maxExecutors"] = strconv.Itoa(int(*da.MaxExecutors))
+		}
+	}
+	return conf
+}
+
+func addPodSpecConf(podSpec types.SparkApplicationPodSpec, role string, conf map[string]string) {
+	if podSpec.Cores != nil {
+		conf["spark."+role+".cores"] = strconv.Itoa(int(*podSpec.Cores))
+	}
+	if podSpec.CoreRequest != nil {
+		conf["spark.kubernetes."+role+".request.cores"] = *podSpec.CoreRequest
+	}
+	if podSpec.Memory != nil {
+		conf["spark."+role+".memory"] = *podSpec.Memory
+	}
+	if podSpec.MemoryOverhead != nil {
+		conf["spark."+role+".memoryOverhead"] = *podSpec.MemoryOverhead
+	}
+	if podSpec.GPU != nil && podSpec.GPU.Quantity > 0 {
+		vendor := strings.SplitN(podSpec.GPU.Name, "/", 2)[0]
+		conf["spark."+role+".resource.gpu.vendor"] = vendor
+		conf["spark."+role+".resource.gpu.amount"] = strconv.FormatInt(podSpec.GPU.Quantity, 10)
+	}
+}
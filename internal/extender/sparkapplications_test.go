@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestSparkApplication(t *testing.T) {
+	node := extendertest.NewNode("node1", "zone1")
+	nodeNames := []string{node.Name}
+	firstApp := sparkOperatorPods("first-app", 2)
+	secondApp := sparkOperatorPods("second-app", 2)
+
+	testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+		binpacker.SingleAzTightlyPack,
+		config.Install{SparkOperatorIntegration: true},
+		&node,
+		&firstApp[0],
+		&secondApp[0],
+	)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	for _, name := range []string{"first-app", "second-app"} {
+		if err := testHarness.SparkApplicationStore.Add(sparkApplication(name, "2g", 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testHarness.AssertSuccessfulSchedule(t, firstApp[0], nodeNames, "The driver should fit with the resources of its SparkApplication")
+	rr, ok := testHarness.ResourceReservationCache.Get(firstApp[0].Namespace, "first-app")
+	if !ok {
+		t.Fatal("The application should have a reservation")
+	}
+	if len(rr.Spec.Reservations) != 3 {
+		t.Fatalf("expected 2 executor reservations, got %d", len(rr.Spec.Reservations)-1)
+	}
+	assertReservedQuantity(t, rr.Spec.Reservations["executor-1"], v1.ResourceMemory, "2432Mi")
+
+	testHarness.AssertFailedSchedule(t, secondApp[0], nodeNames, "The first application takes the resources the second one needs")
+	testHarness.AssertFailedSchedule(t, secondApp[0], nodeNames, "The first application takes the resources the second one needs")
+	// events are published asynchronously, along with the ones on the driver pod
+	var applicationEvents []v1.Event
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		events, err := testHarness.KubeClient.CoreV1().Events(secondApp[0].Namespace).List(testHarness.Ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		applicationEvents = nil
+		for _, event := range events.Items {
+			if event.InvolvedObject.Kind == "SparkApplication" {
+				applicationEvents = append(applicationEvents, event)
+			}
+		}
+		return len(applicationEvents) > 0, nil
+	})
+	if err != nil {
+		t.Fatal("expected an event on the SparkApplication")
+	}
+	if len(applicationEvents) != 1 || applicationEvents[0].Count != 1 {
+		t.Fatalf("expected a single event for repeated failures, got %+v", applicationEvents)
+	}
+	if applicationEvents[0].InvolvedObject.Name != "second-app" || applicationEvents[0].Reason != "SparkSchedulerInsufficientCapacity" {
+		t.Errorf("unexpected event %v on %v", applicationEvents[0].Reason, applicationEvents[0].InvolvedObject.Name)
+	}
+}
+
+func sparkOperatorPods(sparkApplicationID string, numExecutors int) []v1.Pod {
+	pods := extendertest.StaticAllocationSparkPods(sparkApplicationID, numExecutors)
+	pods[0].Annotations = nil
+	pods[0].Labels[common.SparkOperatorAppNameLabel] = sparkApplicationID
+	return pods
+}
+
+func sparkApplication(name, executorMemory string, instances int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sparkoperator.k8s.io/v1beta2",
+		"kind":       "SparkApplication",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "namespace",
+			"uid":       name + "-uid",
+		},
+		"spec": map[string]interface{}{
+			"driver": map[string]interface{}{
+				"cores":  int64(1),
+				"memory": "1g",
+			},
+			"executor": map[string]interface{}{
+				"cores":     int64(1),
+				"memory":    executorMemory,
+				"instances": instances,
+			},
+		},
+	}}
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	v1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// sparkPropertiesKey is the key of the spark configuration in the ConfigMap spark-submit mounts to drivers
+	sparkPropertiesKey = "spark.properties"
+	// sparkDefaultsKey is the key of a spark-defaults.conf file mounted from a ConfigMap
+	sparkDefaultsKey = "spark-defaults.conf"
+
+	defaultMemoryOverheadFactor = 0.1
+	minMemoryOverheadMiB        = 384
+	defaultExecutorInstances    = "2"
+	// defaultDynamicAllocationMaxExecutors is the default of spark.dynamicAllocation.maxExecutors, which spark sets to
+	// the largest int to not bound the number of executors
+	defaultDynamicAllocationMaxExecutors = "2147483647"
+)
+
+var executorCountAnnotations = []string{common.DynamicAllocationEnabled, common.ExecutorCount, common.DAMinExecutorCount, common.DAMaxExecutorCount}
+
+var sparkByteStringPattern = regexp.MustCompile(`^([0-9]+)([a-z]*)$`)
+
+var sparkByteStringUnits = map[string]int64{
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+	"p":  1 << 50,
+	"pb": 1 << 50,
+}
+
+// SparkConfReader reads the spark configuration of drivers from the ConfigMaps mounted to them by spark-submit, and from
+// the environment and arguments of their containers
+type SparkConfReader struct {
+	configMapLister corelisters.ConfigMapLister
+}
+
+// NewSparkConfReader creates a new SparkConfReader
+func NewSparkConfReader(configMapLister corelisters.ConfigMapLister) *SparkConfReader {
+	return &SparkConfReader{
+		configMapLister: configMapLister,
+	}
+}
+
+// withSparkConfAnnotations returns a copy of the driver with the resource annotations it does not set derived from its
+// spark configuration, or the driver itself if it has no spark configuration
+func (r *SparkConfReader) withSparkConfAnnotations(ctx context.Context, driver *v1.Pod) *v1.Pod {
+	conf := r.sparkConf(ctx, driver)
+	if len(conf) == 0 {
+		return driver
+	}
+	annotations, err := sparkConfAnnotations(conf)
+	if err != nil {
+		svc1log.FromContext(ctx).Warn("failed to derive resources from the spark configuration of driver",
+			svc1log.SafeParam("driverName", driver.Name),
+			svc1log.SafeParam("reason", err.Error()))
+		return driver
+	}
+	return withDerivedAnnotations(driver, annotations)
+}
+
+// withDerivedAnnotations returns a copy of the driver with the given annotations added, unless the driver already sets
+// them. Executor counts set by annotations are not mixed with derived ones.
+func withDerivedAnnotations(driver *v1.Pod, annotations map[string]string) *v1.Pod {
+	if hasExecutorCountAnnotations(driver.Annotations) {
+		for _, key := range executorCountAnnotations {
+			delete(annotations, key)
+		}
+	}
+	driverCopy := *driver
+	driverCopy.Annotations = make(map[string]string, len(driver.Annotations)+len(annotations))
+	for key, value := range annotations {
+		driverCopy.Annotations[key] = value
+	}
+	for key, value := range driver.Annotations {
+		driverCopy.Annotations[key] = value
+	}
+	return &driverCopy
+}
+
+// sparkConf collects the spark configuration of the driver. Arguments take precedence over the environment, which takes
+// precedence over mounted ConfigMaps.
+func (r *SparkConfReader) sparkConf(ctx context.Context, driver *v1.Pod) map[string]string {
+	conf := make(map[string]string)
+	for _, volume := range driver.Spec.Volumes {
+		if volume.ConfigMap == nil {
+			continue
+		}
+		configMap, err := r.configMapLister.ConfigMaps(driver.Namespace).Get(volume.ConfigMap.Name)
+		if err != nil {
+			svc1log.FromContext(ctx).Debug("failed to get ConfigMap mounted to driver",
+				svc1log.SafeParam("configMapName", volume.ConfigMap.Name),
+				svc1log.SafeParam("reason", err.Error()))
+			continue
+		}
+		for _, key := range []string{sparkDefaultsKey, sparkPropertiesKey} {
+			if data, ok := configMap.Data[key]; ok {
+				parseProperties(data, conf)
+			}
+		}
+	}
+	for _, container := range driver.Spec.Containers {
+		for _, env := range container.Env {
+			for _, field := range strings.Fields(env.Value) {
+				if strings.HasPrefix(field, "-Dspark.") {
+					addProperty(strings.TrimPrefix(field, "-D"), conf)
+				}
+			}
+		}
+	}
+	for _, container := range driver.Spec.Containers {
+		for i := 0; i+1 < len(container.Args); i++ {
+			if container.Args[i] == "--conf" {
+				addProperty(container.Args[i+1], conf)
+				i++
+			}
+		}
+	}
+	return conf
+}
+
+// sparkConfAnnotations translates the spark configuration of an application into the annotations sparkResources parses
+func sparkConfAnnotations(conf map[string]string) (map[string]string, error) {
+	annotations := make(map[string]string)
+	annotations[common.DriverCPU] = firstSet(conf, "1", "spark.kubernetes.driver.request.cores", "spark.driver.cores")
+	annotations[common.ExecutorCPU] = firstSet(conf, "1", "spark.kubernetes.executor.request.cores", "spark.executor.cores")
+
+	driverMemory, err := podMemory(conf, "driver", "")
+	if err != nil {
+		return nil, err
+	}
+	annotations[common.DriverMemory] = driverMemory
+	executorMemory, err := podMemory(conf, "executor", "spark.executor.pyspark.memory")
+	if err != nil {
+		return nil, err
+	}
+	annotations[common.ExecutorMemory] = executorMemory
+
+	addGPUAnnotation(conf, "driver", common.DriverNvidiaGPUs, common.DriverResourcePrefix, annotations)
+	addGPUAnnotation(conf, "executor", common.ExecutorNvidiaGPUs, common.ExecutorResourcePrefix, annotations)
+
+	if enabled, _ := strconv.ParseBool(conf["spark.dynamicAllocation.enabled"]); enabled {
+		annotations[common.DynamicAllocationEnabled] = "true"
+		annotations[common.DAMinExecutorCount] = firstSet(conf, "0", "spark.dynamicAllocation.minExecutors")
+		annotations[common.DAMaxExecutorCount] = firstSet(conf, defaultDynamicAllocationMaxExecutors, "spark.dynamicAllocation.maxExecutors")
+	} else {
+		annotations[common.ExecutorCount] = firstSet(conf, defaultExecutorInstances, "spark.executor.instances")
+	}
+	return annotations, nil
+}
+
+// podMemory computes the memory request spark sets on the pods of the given role, which is the heap memory and its
+// overhead, and the extra memory given by extraMemoryKey if it is set
+func podMemory(conf map[string]string, role, extraMemoryKey string) (string, error) {
+	memoryMiB, err := byteStringAsMiB(firstSet(conf, "1g", "spark."+role+".memory"))
+	if err != nil {
+		return "", err
+	}
+	var overheadMiB int64
+	if overhead, ok := conf["spark."+role+".memoryOverhead"]; ok {
+		overheadMiB, err = byteStringAsMiB(overhead)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		factor := defaultMemoryOverheadFactor
+		if value := firstSet(conf, "", "spark."+role+".memoryOverheadFactor", "spark.kubernetes.memoryOverheadFactor"); value != "" {
+			factor, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", fmt.Errorf("memory overhead factor %v could not be parsed", value)
+			}
+		}
+		overheadMiB = int64(math.Max(factor*float64(memoryMiB), minMemoryOverheadMiB))
+	}
+	var extraMiB int64
+	if extra, ok := conf[extraMemoryKey]; ok {
+		extraMiB, err = byteStringAsMiB(extra)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%dMi", memoryMiB+overheadMiB+extraMiB), nil
+}
+
+// addGPUAnnotation translates the gpu resource configuration of the given role, requested from the configured vendor
+func addGPUAnnotation(conf map[string]string, role, nvidiaGPUAnnotation, resourcePrefix string, annotations map[string]string) {
+	amount, ok := conf["spark."+role+".resource.gpu.amount"]
+	if !ok {
+		return
+	}
+	switch vendor := conf["spark."+role+".resource.gpu.vendor"]; vendor {
+	case "":
+		return
+	case "nvidia.com":
+		annotations[nvidiaGPUAnnotation] = amount
+	default:
+		annotations[resourcePrefix+vendor+"/gpu"] = amount
+	}
+}
+
+// byteStringAsMiB parses a spark size string, which is in MiB if it does not have a unit
+func byteStringAsMiB(value string) (int64, error) {
+	match := sparkByteStringPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(value)))
+	if match == nil {
+		return 0, fmt.Errorf("size %v could not be parsed", value)
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("size %v could not be parsed", value)
+	}
+	if match[2] == "" {
+		return size, nil
+	}
+	unit, ok := sparkByteStringUnits[match[2]]
+	if !ok {
+		return 0, fmt.Errorf("size %v has an unknown unit", value)
+	}
+	return size * unit / (1 << 20), nil
+}
+
+func hasExecutorCountAnnotations(annotations map[string]string) bool {
+	for _, key := range executorCountAnnotations {
+		if _, ok := annotations[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func firstSet(conf map[string]string, defaultValue string, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := conf[key]; ok {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// parseProperties adds the entries of a java properties or spark-defaults.conf file to conf
+func parseProperties(data string, conf map[string]string) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		separator := len(line)
+		for i := 0; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' {
+				separator = i
+				break
+			}
+		}
+		key := line[:separator]
+		value := strings.TrimLeft(line[separator:], " \t")
+		if strings.HasPrefix(value, "=") || strings.HasPrefix(value, ":") {
+			value = strings.TrimLeft(value[1:], " \t")
+		}
+		conf[unescapeProperty(key)] = unescapeProperty(value)
+	}
+}
+
+func addProperty(property string, conf map[string]string) {
+	parts := strings.SplitN(property, "=", 2)
+	if len(parts) != 2 {
+		return
+	}
+	conf[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+}
+
+func unescapeProperty(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
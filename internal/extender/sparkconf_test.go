@@ -0,0 +1,136 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extender_test
+
+import (
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const sparkProperties = `
+# written by spark-submit
+spark.driver.memory=1g
+spark.executor.memory=1g
+spark.executor.cores=2
+spark.executor.instances=2
+`
+
+func TestSparkConf(t *testing.T) {
+	tests := []struct {
+		name                   string
+		driverAnnotations      map[string]string
+		driverArgs             []string
+		expectedExecutorCount  int
+		expectedExecutorCPU    string
+		expectedExecutorMemory string
+		expectedDriverMemory   string
+	}{{
+		name:                   "arguments take precedence over the mounted spark configuration",
+		expectedExecutorCount:  3,
+		expectedExecutorCPU:    "2",
+		expectedExecutorMemory: "1408Mi",
+		expectedDriverMemory:   "1408Mi",
+	}, {
+		name: "annotations take precedence over the spark configuration",
+		driverAnnotations: map[string]string{
+			common.ExecutorCount:  "1",
+			common.ExecutorMemory: "1Gi",
+		},
+		expectedExecutorCount:  1,
+		expectedExecutorCPU:    "2",
+		expectedExecutorMemory: "1Gi",
+		expectedDriverMemory:   "1408Mi",
+	}, {
+		name: "dynamic allocation without max executors reserves the min executors",
+		driverArgs: []string{
+			"driver",
+			"--conf", "spark.dynamicAllocation.enabled=true",
+			"--conf", "spark.dynamicAllocation.minExecutors=1",
+		},
+		expectedExecutorCount:  1,
+		expectedExecutorCPU:    "2",
+		expectedExecutorMemory: "1408Mi",
+		expectedDriverMemory:   "1408Mi",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := extendertest.NewNode("node1", "zone1")
+			configMap := v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "spark-conf", Namespace: "namespace"},
+				Data:       map[string]string{"spark.properties": sparkProperties},
+			}
+			pods := extendertest.StaticAllocationSparkPods("spark-conf-app", 3)
+			driver := pods[0]
+			driver.Annotations = test.driverAnnotations
+			driver.Spec.Volumes = []v1.Volume{{
+				Name: "spark-conf-volume",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: configMap.Name}},
+				},
+			}}
+			driverArgs := test.driverArgs
+			if driverArgs == nil {
+				driverArgs = []string{"driver", "--conf", "spark.executor.instances=3", "--class", "Main"}
+			}
+			driver.Spec.Containers = []v1.Container{{
+				Name: "spark-kubernetes-driver",
+				Args: driverArgs,
+			}}
+
+			testHarness, err := extendertest.NewTestExtenderWithInstallConfig(
+				binpacker.SingleAzTightlyPack,
+				config.Install{ReadSparkConf: true},
+				&node,
+				&configMap,
+				&driver,
+			)
+			if err != nil {
+				t.Fatal("Could not setup test extender")
+			}
+
+			testHarness.AssertSuccessfulSchedule(t, driver, []string{node.Name}, "The driver should fit with the resources of its spark configuration")
+			rr, ok := testHarness.ResourceReservationCache.Get(driver.Namespace, "spark-conf-app")
+			if !ok {
+				t.Fatal("The application should have a reservation")
+			}
+			if len(rr.Spec.Reservations) != test.expectedExecutorCount+1 {
+				t.Fatalf("expected %d executor reservations, got %d", test.expectedExecutorCount, len(rr.Spec.Reservations)-1)
+			}
+			assertReservedQuantity(t, rr.Spec.Reservations["driver"], v1beta2.ResourceMemory, test.expectedDriverMemory)
+			assertReservedQuantity(t, rr.Spec.Reservations["executor-1"], v1beta2.ResourceCPU, test.expectedExecutorCPU)
+			assertReservedQuantity(t, rr.Spec.Reservations["executor-1"], v1beta2.ResourceMemory, test.expectedExecutorMemory)
+		})
+	}
+}
+
+func assertReservedQuantity(t *testing.T, reservation v1beta2.Reservation, name v1.ResourceName, expected string) {
+	actual, ok := reservation.Resources[string(name)]
+	if !ok {
+		t.Errorf("reservation does not reserve %v", name)
+		return
+	}
+	if actual.Cmp(resource.MustParse(expected)) != 0 {
+		t.Errorf("expected %v to be %v, got %v", name, expected, actual.String())
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
 	"github.com/palantir/k8s-spark-scheduler/internal"
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
@@ -33,34 +35,56 @@ import (
 // SparkPodLister is a PodLister which can also list drivers per node selector
 type SparkPodLister struct {
 	corelisters.PodLister
-	instanceGroupLabel string
+	instanceGroupLabel     string
+	sparkConfReader        *SparkConfReader
+	sparkApplicationReader *SparkApplicationReader
 }
 
-// NewSparkPodLister creates and initializes a SparkPodLister
-func NewSparkPodLister(delegate corelisters.PodLister, instanceGroupLabel string) *SparkPodLister {
-	return &SparkPodLister{delegate, instanceGroupLabel}
+// NewSparkPodLister creates and initializes a SparkPodLister. Application resources are derived from the spark
+// configuration of drivers if sparkConfReader is not nil, and from the SparkApplication of drivers created by the
+// spark-operator if sparkApplicationReader is not nil.
+func NewSparkPodLister(
+	delegate corelisters.PodLister,
+	instanceGroupLabel string,
+	sparkConfReader *SparkConfReader,
+	sparkApplicationReader *SparkApplicationReader) *SparkPodLister {
+	return &SparkPodLister{delegate, instanceGroupLabel, sparkConfReader, sparkApplicationReader}
 }
 
-// ListEarlierDrivers lists earlier driver than the given driver that has the same node selectors
-func (s SparkPodLister) ListEarlierDrivers(driver *v1.Pod) ([]*v1.Pod, error) {
+// ListPendingDrivers lists the unscheduled drivers other than the given driver that have the same node selectors
+func (s SparkPodLister) ListPendingDrivers(driver *v1.Pod) ([]*v1.Pod, error) {
 	selector := labels.Set(map[string]string{common.SparkRoleLabel: common.Driver}).AsSelector()
 	drivers, err := s.List(selector)
 	if err != nil {
 		return nil, err
 	}
-	return filterToEarliestAndSort(driver, drivers, s.instanceGroupLabel), nil
+	return filterToPending(driver, drivers, s.instanceGroupLabel), nil
 }
 
-func filterToEarliestAndSort(driver *v1.Pod, allDrivers []*v1.Pod, instanceGroupLabel string) []*v1.Pod {
-	earlierDrivers := make([]*v1.Pod, 0, 10)
+func filterToPending(driver *v1.Pod, allDrivers []*v1.Pod, instanceGroupLabel string) []*v1.Pod {
+	pendingDrivers := make([]*v1.Pod, 0, 10)
 	for _, p := range allDrivers {
 
 		// add only unscheduled drivers with the same instance group and targeted to the same scheduler
 		if len(p.Spec.NodeName) == 0 &&
 			p.Spec.SchedulerName == driver.Spec.SchedulerName &&
 			internal.MatchPodInstanceGroup(p, driver, instanceGroupLabel) &&
-			p.CreationTimestamp.Before(&driver.CreationTimestamp) &&
+			!isSamePod(p, driver) &&
 			p.DeletionTimestamp == nil {
+			pendingDrivers = append(pendingDrivers, p)
+		}
+	}
+	return pendingDrivers
+}
+
+func filterToEarliestAndSort(driver *v1.Pod, allDrivers []*v1.Pod, instanceGroupLabel string) []*v1.Pod {
+	return earlierDriversSorted(driver, filterToPending(driver, allDrivers, instanceGroupLabel))
+}
+
+func earlierDriversSorted(driver *v1.Pod, drivers []*v1.Pod) []*v1.Pod {
+	earlierDrivers := make([]*v1.Pod, 0, len(drivers))
+	for _, p := range drivers {
+		if p.CreationTimestamp.Before(&driver.CreationTimestamp) {
 			earlierDrivers = append(earlierDrivers, p)
 		}
 	}
@@ -70,6 +94,33 @@ func filterToEarliestAndSort(driver *v1.Pod, allDrivers []*v1.Pod, instanceGroup
 	return earlierDrivers
 }
 
+// sparkResources parses the resources of the application of the given driver, reading the ones its annotations do not
+// set from its SparkApplication and then from its spark configuration if enabled
+func (s SparkPodLister) sparkResources(ctx context.Context, driver *v1.Pod) (*types.SparkApplicationResources, error) {
+	if s.sparkApplicationReader != nil {
+		driver = s.sparkApplicationReader.withSparkApplicationAnnotations(ctx, driver)
+	}
+	if s.sparkConfReader != nil {
+		driver = s.sparkConfReader.withSparkConfAnnotations(ctx, driver)
+	}
+	return sparkResources(ctx, driver)
+}
+
+// recordDriverOutcome reflects the outcome of scheduling the driver on its SparkApplication if enabled
+func (s SparkPodLister) recordDriverOutcome(ctx context.Context, driver *v1.Pod, outcome string, message string) {
+	if s.sparkApplicationReader != nil {
+		s.sparkApplicationReader.recordOutcome(ctx, driver, outcome, message)
+	}
+}
+
+// recordDriverExceedsClusterCapacity reflects that the driver does not fit to the cluster on its SparkApplication if
+// enabled
+func (s SparkPodLister) recordDriverExceedsClusterCapacity(ctx context.Context, driver *v1.Pod) {
+	if s.sparkApplicationReader != nil {
+		s.sparkApplicationReader.recordExceedsClusterCapacity(ctx, driver)
+	}
+}
+
 func sparkResources(ctx context.Context, pod *v1.Pod) (*types.SparkApplicationResources, error) {
 	parsedResources := map[string]resource.Quantity{}
 	dynamicAllocationEnabled := false
@@ -128,14 +179,69 @@ func sparkResources(ctx context.Context, pod *v1.Pod) (*types.SparkApplicationRe
 		Memory:    parsedResources[common.ExecutorMemory],
 		NvidiaGPU: parsedResources[common.ExecutorNvidiaGPUs],
 	}
+	driverExtendedResources, err := extendedResources(pod, common.DriverResourcePrefix, common.DriverEphemeralStorage)
+	if err != nil {
+		return nil, err
+	}
+	executorExtendedResources, err := extendedResources(pod, common.ExecutorResourcePrefix, common.ExecutorEphemeralStorage)
+	if err != nil {
+		return nil, err
+	}
 	return &types.SparkApplicationResources{
-		DriverResources:   driverResources,
-		ExecutorResources: executorResources,
-		MinExecutorCount:  minExecutorCount,
-		MaxExecutorCount:  maxExecutorCount,
+		DriverResources:           driverResources,
+		ExecutorResources:         executorResources,
+		MinExecutorCount:          minExecutorCount,
+		MaxExecutorCount:          maxExecutorCount,
+		DriverExtendedResources:   driverExtendedResources,
+		ExecutorExtendedResources: executorExtendedResources,
 	}, nil
 }
 
+// extendedResources parses the annotations with the given prefix, each naming an extended resource after the prefix,
+// and the dedicated ephemeral storage annotation
+func extendedResources(pod *v1.Pod, prefix, ephemeralStorageAnnotation string) (v1.ResourceList, error) {
+	res := v1.ResourceList{}
+	for a, value := range pod.Annotations {
+		if !strings.HasPrefix(a, prefix) {
+			continue
+		}
+		name := v1.ResourceName(strings.TrimPrefix(a, prefix))
+		if !types.IsExtendedResource(name) {
+			return nil, fmt.Errorf("annotation %v names a resource that has a dedicated annotation", a)
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %v does not have a parseable value %v", a, value)
+		}
+		res[name] = quantity
+	}
+	if value, ok := pod.Annotations[ephemeralStorageAnnotation]; ok {
+		if _, ok := res[v1.ResourceEphemeralStorage]; ok {
+			return nil, fmt.Errorf("annotation %v conflicts with annotation %v", ephemeralStorageAnnotation, prefix+string(v1.ResourceEphemeralStorage))
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %v does not have a parseable value %v", ephemeralStorageAnnotation, value)
+		}
+		res[v1.ResourceEphemeralStorage] = quantity
+	}
+	return res, nil
+}
+
+// reservationResources returns the resource list reserved for a pod with the given resources
+func reservationResources(podResources *resources.Resources, extendedResources v1.ResourceList) v1beta2.ResourceList {
+	res := v1beta2.ResourceList{
+		string(v1beta2.ResourceCPU):       &podResources.CPU,
+		string(v1beta2.ResourceMemory):    &podResources.Memory,
+		string(v1beta2.ResourceNvidiaGPU): &podResources.NvidiaGPU,
+	}
+	for name, quantity := range extendedResources {
+		q := quantity.DeepCopy()
+		res[string(name)] = &q
+	}
+	return res
+}
+
 func sparkResourceUsage(driverResources, executorResources *resources.Resources, driverNode string, executorNodes []string) resources.NodeGroupResources {
 	res := resources.NodeGroupResources{}
 	res[driverNode] = driverResources
@@ -157,3 +263,7 @@ func (s SparkPodLister) getDriverPod(ctx context.Context, appID string, namespac
 	}
 	return driver[0], nil
 }
+
+func isSamePod(a, b *v1.Pod) bool {
+	return a.UID == b.UID && a.Namespace == b.Namespace && a.Name == b.Name
+}
@@ -105,6 +105,60 @@ func TestSparkResources(t *testing.T) {
 			MinExecutorCount:  2,
 			MaxExecutorCount:  2,
 		},
+	}, {
+		name: "parses extended resource pod annotations into resources",
+		pod: v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					common.DriverCPU:    "1",
+					common.DriverMemory: "2432Mi",
+					common.DriverResourcePrefix + "ephemeral-storage": "10Gi",
+					common.ExecutorCPU:                            "2",
+					common.ExecutorMemory:                         "6758Mi",
+					common.ExecutorResourcePrefix + "amd.com/gpu": "1",
+					common.ExecutorCount:                          "2",
+				},
+			},
+		},
+		expectedApplicationResources: &internaltypes.SparkApplicationResources{
+			DriverResources:   createResources(1, 2432*1024*1024, 0),
+			ExecutorResources: createResources(2, 6758*1024*1024, 0),
+			MinExecutorCount:  2,
+			MaxExecutorCount:  2,
+			DriverExtendedResources: v1.ResourceList{
+				v1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+			},
+			ExecutorExtendedResources: v1.ResourceList{
+				"amd.com/gpu": resource.MustParse("1"),
+			},
+		},
+	}, {
+		name: "parses ephemeral storage pod annotations into resources",
+		pod: v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					common.DriverCPU:                "1",
+					common.DriverMemory:             "2432Mi",
+					common.DriverEphemeralStorage:   "1Gi",
+					common.ExecutorCPU:              "2",
+					common.ExecutorMemory:           "6758Mi",
+					common.ExecutorEphemeralStorage: "50Gi",
+					common.ExecutorCount:            "2",
+				},
+			},
+		},
+		expectedApplicationResources: &internaltypes.SparkApplicationResources{
+			DriverResources:   createResources(1, 2432*1024*1024, 0),
+			ExecutorResources: createResources(2, 6758*1024*1024, 0),
+			MinExecutorCount:  2,
+			MaxExecutorCount:  2,
+			DriverExtendedResources: v1.ResourceList{
+				v1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+			},
+			ExecutorExtendedResources: v1.ResourceList{
+				v1.ResourceEphemeralStorage: resource.MustParse("50Gi"),
+			},
+		},
 	},
 	}
 
@@ -134,10 +188,49 @@ func TestSparkResources(t *testing.T) {
 				t.Fatalf("maxExecutorCount not equal to ExecutorCount in static allocation, expected: %v, got: %v",
 					test.expectedApplicationResources.MaxExecutorCount, applicationResources.MaxExecutorCount)
 			}
+			if !extendedResourcesEqual(applicationResources.DriverExtendedResources, test.expectedApplicationResources.DriverExtendedResources) {
+				t.Fatalf("driverExtendedResources are not equal, expected: %v, got: %v",
+					test.expectedApplicationResources.DriverExtendedResources, applicationResources.DriverExtendedResources)
+			}
+			if !extendedResourcesEqual(applicationResources.ExecutorExtendedResources, test.expectedApplicationResources.ExecutorExtendedResources) {
+				t.Fatalf("executorExtendedResources are not equal, expected: %v, got: %v",
+					test.expectedApplicationResources.ExecutorExtendedResources, applicationResources.ExecutorExtendedResources)
+			}
 		})
 	}
 }
 
+func TestSparkResourcesRejectsDedicatedResourceNames(t *testing.T) {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				common.DriverCPU:                         "1",
+				common.DriverMemory:                      "2432Mi",
+				common.ExecutorCPU:                       "2",
+				common.ExecutorMemory:                    "6758Mi",
+				common.ExecutorResourcePrefix + "memory": "1Gi",
+				common.ExecutorCount:                     "2",
+			},
+		},
+	}
+	if _, err := sparkResources(context.Background(), &pod); err == nil {
+		t.Fatal("expected an error for an extended resource annotation naming memory")
+	}
+}
+
+func extendedResourcesEqual(a, b v1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, quantity := range a {
+		other, ok := b[name]
+		if !ok || quantity.Cmp(other) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func cacheQuantities(resources *resources.Resources) {
 	_ = resources.CPU.String()
 	_ = resources.Memory.String()
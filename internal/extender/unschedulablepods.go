@@ -19,9 +19,10 @@ import (
 	"time"
 
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
-	internalbinpacker "github.com/palantir/k8s-spark-scheduler/internal/binpacker"
 	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/common/utils"
+	"github.com/palantir/k8s-spark-scheduler/internal/events"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
 	"github.com/palantir/witchcraft-go-logging/wlog/wapp"
 	v1 "k8s.io/api/core/v1"
@@ -43,21 +44,23 @@ const (
 // custom pod condition.
 type UnschedulablePodMarker struct {
 	nodeLister       corelisters.NodeLister
-	podLister        corelisters.PodLister
+	podLister        *SparkPodLister
 	coreClient       corev1.CoreV1Interface
 	overheadComputer *OverheadComputer
-	binpacker        *internalbinpacker.Binpacker
+	extender         *SparkSchedulerExtender
 	timeoutDuration  time.Duration
+	podEvents        events.PodEventRecorder
 }
 
 // NewUnschedulablePodMarker creates a new UnschedulablePodMarker
 func NewUnschedulablePodMarker(
 	nodeLister corelisters.NodeLister,
-	podLister corelisters.PodLister,
+	podLister *SparkPodLister,
 	coreClient corev1.CoreV1Interface,
 	overheadComputer *OverheadComputer,
-	binpacker *internalbinpacker.Binpacker,
-	timeoutDuration time.Duration) *UnschedulablePodMarker {
+	extender *SparkSchedulerExtender,
+	timeoutDuration time.Duration,
+	podEvents events.PodEventRecorder) *UnschedulablePodMarker {
 
 	if timeoutDuration <= 0 {
 		timeoutDuration = 10 * time.Minute
@@ -68,8 +71,9 @@ func NewUnschedulablePodMarker(
 		podLister:        podLister,
 		coreClient:       coreClient,
 		overheadComputer: overheadComputer,
-		binpacker:        binpacker,
+		extender:         extender,
 		timeoutDuration:  timeoutDuration,
+		podEvents:        podEvents,
 	}
 }
 
@@ -118,6 +122,9 @@ func (u *UnschedulablePodMarker) scanForUnschedulablePods(ctx context.Context) {
 			}
 			if exceedsCapacity {
 				svc1log.FromContext(ctx).Info("Marking pod as exceeds capacity")
+				u.podLister.recordDriverExceedsClusterCapacity(ctx, pod)
+				u.podEvents.Event(pod, v1.EventTypeWarning, events.ReasonExceedsClusterCapacity,
+					"application does not fit to the cluster even if it was empty")
 			}
 			err = u.markPodClusterCapacityStatus(ctx, pod, exceedsCapacity)
 			if err != nil {
@@ -146,21 +153,26 @@ func (u *UnschedulablePodMarker) DoesPodExceedClusterCapacity(ctx context.Contex
 			svc1log.SafeParam("nodeSelector", driver.Spec.NodeSelector))
 	}
 
+	settings := u.extender.podInstanceGroupSettings(ctx, driver)
 	usage := zeroUsage(nodes)
 	overhead := u.overheadComputer.GetNonSchedulableOverhead(ctx, nodes)
-	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(nodes, usage, overhead)
-	applicationResources, err := sparkResources(ctx, driver)
+	availableNodesSchedulingMetadata := resources.NodeSchedulingMetadataForNodes(settings.overcommittedNodes(nodes), usage, overhead)
+	applicationResources, err := u.podLister.sparkResources(ctx, driver)
 	if err != nil {
 		return false, err
 	}
-	packingResult := u.binpacker.BinpackFunc(
+	availableExtendedResources := make(types.NodeGroupExtendedResources, len(nodes))
+	for _, node := range nodes {
+		availableExtendedResources[node.Name] = types.ExtendedResourcesFromList(node.Status.Allocatable)
+	}
+	availableExtendedResources.Sub(u.overheadComputer.GetNonSchedulableExtendedOverhead(ctx, nodes))
+	packingResult := u.extender.applicationBinpacker(ctx, driver, settings.binpacker).BinpackApplication(
 		ctx,
-		applicationResources.DriverResources,
-		applicationResources.ExecutorResources,
-		applicationResources.MinExecutorCount,
+		applicationResources,
 		nodeNames,
 		nodeNames,
-		availableNodesSchedulingMetadata)
+		availableNodesSchedulingMetadata,
+		availableExtendedResources)
 
 	return !packingResult.HasCapacity, nil
 }
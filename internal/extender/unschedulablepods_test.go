@@ -18,7 +18,10 @@ import (
 	"testing"
 
 	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
 	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestUnschedulablePodMarker(t *testing.T) {
@@ -52,6 +55,42 @@ func TestUnschedulablePodMarker(t *testing.T) {
 	}
 }
 
+func TestUnschedulablePodMarkerEphemeralStorage(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	for _, node := range []*v1.Node{&node1, &node2} {
+		node.Status.Allocatable[v1.ResourceEphemeralStorage] = resource.MustParse("100Gi")
+	}
+
+	testHarness, err := extendertest.NewTestExtender(
+		binpacker.SingleAzTightlyPack,
+		&node1,
+		&node2)
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+
+	smallDiskDriver := extendertest.StaticAllocationSparkPods("small-disk-app", 2)[0]
+	smallDiskDriver.Annotations[common.ExecutorEphemeralStorage] = "60Gi"
+	doesExceed, err := testHarness.UnschedulablePodMarker.DoesPodExceedClusterCapacity(testHarness.Ctx, &smallDiskDriver)
+	if err != nil {
+		t.Errorf("exceeds capacity check should not cause an error: %s", err)
+	}
+	if doesExceed {
+		t.Error("The executors should fit to the disks of separate nodes")
+	}
+
+	bigDiskDriver := extendertest.StaticAllocationSparkPods("big-disk-app", 1)[0]
+	bigDiskDriver.Annotations[common.ExecutorEphemeralStorage] = "200Gi"
+	doesExceed, err = testHarness.UnschedulablePodMarker.DoesPodExceedClusterCapacity(testHarness.Ctx, &bigDiskDriver)
+	if err != nil {
+		t.Errorf("exceeds capacity check should not cause an error: %s", err)
+	}
+	if !doesExceed {
+		t.Error("The executor should not fit to the disk of any node")
+	}
+}
+
 func TestSchedulerFailsToScheduleWhenNotEnoughNvidiaGPUs(t *testing.T) {
 	node1 := extendertest.NewNode("node1", "zone1")
 	node2 := extendertest.NewNode("node2", "zone1")
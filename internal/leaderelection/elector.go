@@ -0,0 +1,282 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaderelection
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	werror "github.com/palantir/witchcraft-go-error"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+const (
+	defaultLeaseName     = "spark-scheduler-extender"
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+	namespaceFile        = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Callbacks are called as the replica gains and loses leadership
+type Callbacks struct {
+	// OnStartedLeading is called once the Lease is acquired, with a context that is cancelled when leadership is lost
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called once leadership is lost, after the context of OnStartedLeading is cancelled
+	OnStoppedLeading func(ctx context.Context)
+}
+
+// Elector competes with the other replicas of the extender for a Lease, and holds it while it can renew it. A standby
+// takes the Lease over once it has not seen it renewed for the lease duration.
+type Elector struct {
+	leases         coordinationclient.LeasesGetter
+	leaseName      string
+	leaseNamespace string
+	leaseDuration  time.Duration
+	renewDeadline  time.Duration
+	retryPeriod    time.Duration
+	identity       string
+	callbacks      Callbacks
+
+	// observedSpec is the last seen spec of the Lease, and observedTime the local time it was first seen at, so that
+	// expiry does not depend on the clocks of other replicas
+	observedSpec *coordinationv1.LeaseSpec
+	observedTime time.Time
+	isLeader     int32
+}
+
+// NewElector creates an Elector for the configured Lease, which identifies this replica by its identity
+func NewElector(
+	leases coordinationclient.LeasesGetter,
+	leaderElectionConfig config.LeaderElectionConfig,
+	identity string,
+	callbacks Callbacks) (*Elector, error) {
+	e := &Elector{
+		leases:         leases,
+		leaseName:      leaderElectionConfig.LeaseName,
+		leaseNamespace: leaderElectionConfig.LeaseNamespace,
+		leaseDuration:  leaderElectionConfig.LeaseDuration,
+		renewDeadline:  leaderElectionConfig.RenewDeadline,
+		retryPeriod:    leaderElectionConfig.RetryPeriod,
+		identity:       identity,
+		callbacks:      callbacks,
+	}
+	if e.leaseName == "" {
+		e.leaseName = defaultLeaseName
+	}
+	if e.leaseNamespace == "" {
+		namespace, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return nil, werror.Wrap(err, "lease namespace is not configured, and failed to read the namespace of the service account")
+		}
+		e.leaseNamespace = strings.TrimSpace(string(namespace))
+	}
+	if e.leaseDuration <= 0 {
+		e.leaseDuration = defaultLeaseDuration
+	}
+	if e.renewDeadline <= 0 {
+		e.renewDeadline = defaultRenewDeadline
+	}
+	if e.retryPeriod <= 0 {
+		e.retryPeriod = defaultRetryPeriod
+	}
+	if e.renewDeadline >= e.leaseDuration || e.retryPeriod >= e.renewDeadline {
+		return nil, werror.Error("leader election requires retry-period < renew-deadline < lease-duration",
+			werror.SafeParam("leaseDuration", e.leaseDuration.String()),
+			werror.SafeParam("renewDeadline", e.renewDeadline.String()),
+			werror.SafeParam("retryPeriod", e.retryPeriod.String()))
+	}
+	return e, nil
+}
+
+// IsLeader returns whether this replica currently holds the Lease
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.isLeader) == 1
+}
+
+// Run competes for the Lease until the context is done, and releases it if it is held at that point
+func (e *Elector) Run(ctx context.Context) {
+	ctx = svc1log.WithLoggerParams(ctx,
+		svc1log.SafeParam("leaseName", e.leaseName),
+		svc1log.SafeParam("leaseNamespace", e.leaseNamespace),
+		svc1log.SafeParam("identity", e.identity))
+	logger := svc1log.FromContext(ctx)
+	for {
+		if !e.acquire(ctx) {
+			return
+		}
+		logger.Info("acquired the lease, starting to lead")
+		atomic.StoreInt32(&e.isLeader, 1)
+		leaderCtx, cancel := context.WithCancel(ctx)
+		if e.callbacks.OnStartedLeading != nil {
+			go e.callbacks.OnStartedLeading(leaderCtx)
+		}
+		e.renew(ctx)
+		atomic.StoreInt32(&e.isLeader, 0)
+		cancel()
+		if e.callbacks.OnStoppedLeading != nil {
+			e.callbacks.OnStoppedLeading(ctx)
+		}
+		if ctx.Err() != nil {
+			e.release()
+			logger.Info("released the lease")
+			return
+		}
+		logger.Warn("failed to renew the lease, stopped leading")
+	}
+}
+
+// acquire retries to acquire the Lease until it succeeds, or returns false if the context is done first
+func (e *Elector) acquire(ctx context.Context) bool {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+	for {
+		if e.tryAcquireOrRenew(ctx) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew keeps renewing the Lease, and returns once the context is done, another replica took the Lease over, or the
+// Lease could not be renewed within the renew deadline
+func (e *Elector) renew(ctx context.Context) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewCtx, cancel := context.WithTimeout(ctx, e.renewDeadline)
+		renewed := e.tryAcquireOrRenew(renewCtx)
+		cancel()
+		if renewed {
+			lastRenewal = time.Now()
+			continue
+		}
+		if e.observedHolder() != e.identity || time.Since(lastRenewal) > e.renewDeadline {
+			return
+		}
+	}
+}
+
+// tryAcquireOrRenew creates or updates the Lease so that this replica holds it, unless another replica holds it and
+// has renewed it within its lease duration
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) bool {
+	now := metav1.NewMicroTime(time.Now())
+	leaseDurationSeconds := int32(e.leaseDuration / time.Second)
+	lease, err := e.leases.Leases(e.leaseNamespace).Get(ctx, e.leaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		created, err := e.leases.Leases(e.leaseNamespace).Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      e.leaseName,
+				Namespace: e.leaseNamespace,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &e.identity,
+				LeaseDurationSeconds: &leaseDurationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			svc1log.FromContext(ctx).Debug("failed to create the lease", svc1log.Stacktrace(err))
+			return false
+		}
+		e.observe(&created.Spec)
+		return true
+	}
+	if err != nil {
+		svc1log.FromContext(ctx).Debug("failed to get the lease", svc1log.Stacktrace(err))
+		return false
+	}
+	if e.observedSpec == nil || !apiequality.Semantic.DeepEqual(&lease.Spec, e.observedSpec) {
+		e.observe(&lease.Spec)
+	}
+	holder := e.observedHolder()
+	if holder != "" && holder != e.identity && e.observedTime.Add(e.observedLeaseDuration()).After(time.Now()) {
+		return false
+	}
+
+	updated := lease.DeepCopy()
+	if holder != e.identity {
+		updated.Spec.AcquireTime = &now
+		transitions := int32(1)
+		if updated.Spec.LeaseTransitions != nil {
+			transitions = *updated.Spec.LeaseTransitions + 1
+		}
+		updated.Spec.LeaseTransitions = &transitions
+	}
+	updated.Spec.HolderIdentity = &e.identity
+	updated.Spec.LeaseDurationSeconds = &leaseDurationSeconds
+	updated.Spec.RenewTime = &now
+	result, err := e.leases.Leases(e.leaseNamespace).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		svc1log.FromContext(ctx).Debug("failed to update the lease", svc1log.Stacktrace(err))
+		return false
+	}
+	e.observe(&result.Spec)
+	return true
+}
+
+// release gives the Lease up so that a standby can take over without waiting for it to expire
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.renewDeadline)
+	defer cancel()
+	lease, err := e.leases.Leases(e.leaseNamespace).Get(ctx, e.leaseName, metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != e.identity {
+		return
+	}
+	released := lease.DeepCopy()
+	released.Spec.HolderIdentity = nil
+	released.Spec.AcquireTime = nil
+	released.Spec.RenewTime = nil
+	_, _ = e.leases.Leases(e.leaseNamespace).Update(ctx, released, metav1.UpdateOptions{})
+}
+
+func (e *Elector) observe(spec *coordinationv1.LeaseSpec) {
+	e.observedSpec = spec.DeepCopy()
+	e.observedTime = time.Now()
+}
+
+func (e *Elector) observedHolder() string {
+	if e.observedSpec == nil || e.observedSpec.HolderIdentity == nil {
+		return ""
+	}
+	return *e.observedSpec.HolderIdentity
+}
+
+func (e *Elector) observedLeaseDuration() time.Duration {
+	if e.observedSpec == nil || e.observedSpec.LeaseDurationSeconds == nil {
+		return e.leaseDuration
+	}
+	return time.Duration(*e.observedSpec.LeaseDurationSeconds) * time.Second
+}
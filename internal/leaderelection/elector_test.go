@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestElectorHandsOverLeaseOnRelease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	leaderElectionConfig := config.LeaderElectionConfig{
+		Enabled:        true,
+		LeaseNamespace: "spark",
+		LeaseDuration:  2 * time.Second,
+		RenewDeadline:  time.Second,
+		RetryPeriod:    50 * time.Millisecond,
+	}
+	stopped := make(chan struct{}, 1)
+	first, err := NewElector(client.CoordinationV1(), leaderElectionConfig, "first", Callbacks{
+		OnStoppedLeading: func(ctx context.Context) { stopped <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{}, 1)
+	second, err := NewElector(client.CoordinationV1(), leaderElectionConfig, "second", Callbacks{
+		OnStartedLeading: func(ctx context.Context) { started <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx)
+		close(firstDone)
+	}()
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return first.IsLeader(), nil
+	}); err != nil {
+		t.Fatal("the first elector should acquire the lease")
+	}
+
+	go second.Run(ctx)
+	time.Sleep(300 * time.Millisecond)
+	if second.IsLeader() {
+		t.Fatal("the second elector should not acquire a lease that is being renewed")
+	}
+
+	cancelFirst()
+	<-firstDone
+	<-stopped
+	if first.IsLeader() {
+		t.Error("the first elector should stop leading once its context is done")
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the second elector should take over the released lease before it expires")
+	}
+	lease, err := client.CoordinationV1().Leases("spark").Get(ctx, defaultLeaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "second" {
+		t.Errorf("expected the lease to be held by the second elector, got %v", lease.Spec.HolderIdentity)
+	}
+	if lease.Spec.LeaseTransitions == nil || *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("expected a single lease transition, got %v", lease.Spec.LeaseTransitions)
+	}
+}
+
+func TestNewElectorValidatesDurations(t *testing.T) {
+	_, err := NewElector(fake.NewSimpleClientset().CoordinationV1(), config.LeaderElectionConfig{
+		LeaseNamespace: "spark",
+		LeaseDuration:  5 * time.Second,
+		RenewDeadline:  10 * time.Second,
+	}, "identity", Callbacks{})
+	if err == nil {
+		t.Error("expected a renew deadline longer than the lease duration to be rejected")
+	}
+}
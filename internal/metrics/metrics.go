@@ -35,6 +35,7 @@ const (
 	resourceUsageCPU                          = "foundry.spark.scheduler.resource.usage.cpu"
 	resourceUsageMemory                       = "foundry.spark.scheduler.resource.usage.memory"
 	resourceUsageNvidiaGPUs                   = "foundry.spark.scheduler.resource.usage.nvidia.com/gpu"
+	resourceUsageExtended                     = "foundry.spark.scheduler.resource.usage.extended"
 	lifecycleAgeMax                           = "foundry.spark.scheduler.pod.lifecycle.max"
 	lifecycleAgeP95                           = "foundry.spark.scheduler.pod.lifecycle.p95"
 	lifecycleAgeP50                           = "foundry.spark.scheduler.pod.lifecycle.p50"
@@ -65,6 +66,8 @@ const (
 	initialDriverExecutorCollocation          = "foundry.spark.scheduler.scheduling.initialdriverexecutorcollocation"
 	initialExecutorsPerNode                   = "foundry.spark.scheduler.scheduling.initialexecutorspernode"
 	initialNodeCount                          = "foundry.spark.scheduler.scheduling.initialnodecount"
+	preemptionCount                           = "foundry.spark.scheduler.preemption.count"
+	preemptedApplicationCount                 = "foundry.spark.scheduler.preemption.applications"
 )
 
 const (
@@ -83,6 +86,8 @@ const (
 	queueIndexTagName          = "queueIndex"
 	schedulingWasteTypeTagName = "wastetype"
 	zoneTagName                = "zone"
+	resourceTagName            = "resource"
+	binpackerTagName           = "binpacker"
 )
 
 const (
@@ -161,6 +166,16 @@ func QueueIndexTag(ctx context.Context, index int) metrics.Tag {
 	return tagWithDefault(ctx, queueIndexTagName, strconv.Itoa(index), "unspecified")
 }
 
+// ResourceTag returns a resource name tag
+func ResourceTag(ctx context.Context, resourceName string) metrics.Tag {
+	return tagWithDefault(ctx, resourceTagName, resourceName, "unspecified")
+}
+
+// BinpackerTag returns a tag of the binpack algorithm an instance group resolved to
+func BinpackerTag(ctx context.Context, binpacker string) metrics.Tag {
+	return tagWithDefault(ctx, binpackerTagName, binpacker, "unspecified")
+}
+
 // ScheduleTimer marks pod scheduling time metrics
 type ScheduleTimer struct {
 	podCreationTime            time.Time
@@ -168,11 +183,12 @@ type ScheduleTimer struct {
 	lastSeenTime               time.Time
 	reconciliationFinishedTime time.Time
 	instanceGroupTag           metrics.Tag
+	binpackerTag               metrics.Tag
 	retryTag                   metrics.Tag
 }
 
-// NewScheduleTimer creates a new ScheduleTimer
-func NewScheduleTimer(ctx context.Context, instanceGroup string, pod *v1.Pod) *ScheduleTimer {
+// NewScheduleTimer creates a new ScheduleTimer, tagged with the binpack algorithm of the pod's application
+func NewScheduleTimer(ctx context.Context, instanceGroup, binpacker string, pod *v1.Pod) *ScheduleTimer {
 	lastSeenTime := pod.CreationTimestamp.Time
 	retryTag := firstTryTag
 	for _, podCondition := range pod.Status.Conditions {
@@ -186,6 +202,7 @@ func NewScheduleTimer(ctx context.Context, instanceGroup string, pod *v1.Pod) *S
 		lastSeenTime:     lastSeenTime,
 		startTime:        time.Now(),
 		instanceGroupTag: InstanceGroupTag(ctx, instanceGroup),
+		binpackerTag:     BinpackerTag(ctx, binpacker),
 		retryTag:         retryTag,
 	}
 }
@@ -200,14 +217,14 @@ func (s *ScheduleTimer) Mark(ctx context.Context, role, outcome string) {
 	sparkRoleTag := SparkRoleTag(ctx, role)
 	outcomeTag := OutcomeTag(ctx, outcome)
 
-	metrics.FromContext(ctx).Counter(requestCounter, sparkRoleTag, outcomeTag, s.instanceGroupTag).Inc(1)
+	metrics.FromContext(ctx).Counter(requestCounter, sparkRoleTag, outcomeTag, s.instanceGroupTag, s.binpackerTag).Inc(1)
 	now := time.Now()
 	metrics.FromContext(ctx).Histogram(
-		schedulingProcessingTime, sparkRoleTag, outcomeTag, s.instanceGroupTag).Update(now.Sub(s.startTime).Nanoseconds())
+		schedulingProcessingTime, sparkRoleTag, outcomeTag, s.instanceGroupTag, s.binpackerTag).Update(now.Sub(s.startTime).Nanoseconds())
 	metrics.FromContext(ctx).Histogram(
-		schedulingWaitTime, sparkRoleTag, outcomeTag, s.instanceGroupTag).Update(now.Sub(s.podCreationTime).Nanoseconds())
+		schedulingWaitTime, sparkRoleTag, outcomeTag, s.instanceGroupTag, s.binpackerTag).Update(now.Sub(s.podCreationTime).Nanoseconds())
 	metrics.FromContext(ctx).Histogram(
-		schedulingRetryTime, sparkRoleTag, outcomeTag, s.instanceGroupTag, s.retryTag).Update(now.Sub(s.lastSeenTime).Nanoseconds())
+		schedulingRetryTime, sparkRoleTag, outcomeTag, s.instanceGroupTag, s.binpackerTag, s.retryTag).Update(now.Sub(s.lastSeenTime).Nanoseconds())
 	if !s.reconciliationFinishedTime.IsZero() {
 		metrics.FromContext(ctx).Histogram(reconciliationTime).Update(s.reconciliationFinishedTime.Sub(s.startTime).Nanoseconds())
 	}
@@ -375,3 +392,10 @@ func ReportTimeToFirstBindMetrics(ctx context.Context, duration time.Duration) {
 	metrics.FromContext(ctx).GaugeFloat64(timeToFirstBindMedian).Update(timeToFirstBindHist.Percentile(.5))
 	metrics.FromContext(ctx).GaugeFloat64(timeToFirstBindMean).Update(timeToFirstBindHist.Mean())
 }
+
+// ReportPreemption reports a preemption and the number of applications it preempted
+func ReportPreemption(ctx context.Context, instanceGroup string, preemptedApplications int) {
+	instanceGroupTag := InstanceGroupTag(ctx, instanceGroup)
+	metrics.FromContext(ctx).Counter(preemptionCount, instanceGroupTag).Inc(1)
+	metrics.FromContext(ctx).Counter(preemptedApplicationCount, instanceGroupTag).Inc(int64(preemptedApplications))
+}
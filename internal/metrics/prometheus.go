@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/palantir/pkg/metrics"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+)
+
+// PrometheusContentType is the content type of the prometheus text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// durationHistograms are the histograms recording durations in nanoseconds, which are exposed in seconds
+	durationHistograms = map[string]bool{
+		schedulingProcessingTime:        true,
+		reconciliationTime:              true,
+		schedulingWaitTime:              true,
+		schedulingRetryTime:             true,
+		requestLatency:                  true,
+		timeToFirstBind:                 true,
+		softReservationCompactionTime:   true,
+		podInformerDelay:                true,
+		schedulingWaste:                 true,
+		schedulingWastePerInstanceGroup: true,
+	}
+	// prometheusLabelNames renames tags whose names do not follow prometheus conventions once sanitized, by their
+	// lowercased name as tag names are lowercased by the registry
+	prometheusLabelNames = map[string]string{
+		sparkRoleTagName:                   "role",
+		hostTagName:                        "node",
+		pathTagName:                        "path",
+		verbTagName:                        "verb",
+		statusCodeTagName:                  "status_code",
+		strings.ToLower(queueIndexTagName): "queue_index",
+	}
+	summaryQuantiles = []struct {
+		label string
+		key   string
+	}{{"0.5", "p50"}, {"0.95", "p95"}, {"0.99", "p99"}}
+)
+
+type prometheusSample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+type prometheusFamily struct {
+	name       string
+	metricType string
+	samples    []prometheusSample
+}
+
+// NewPrometheusHandler returns a handler exposing every metric of the registry in the prometheus text format. Counters and
+// meters are exposed as counters, gauges as gauges, and histograms and timers as summaries.
+func NewPrometheusHandler(registry metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", PrometheusContentType)
+		if err := WritePrometheus(rw, registry); err != nil {
+			svc1log.FromContext(req.Context()).Warn("failed to write prometheus metrics", svc1log.Stacktrace(err))
+		}
+	})
+}
+
+// WritePrometheus writes every metric of the registry in the prometheus text format
+func WritePrometheus(w io.Writer, registry metrics.Registry) error {
+	families := make(map[string]*prometheusFamily)
+	registry.Each(func(name string, tags metrics.Tags, value metrics.MetricVal) {
+		values := value.Values()
+		labels := prometheusLabels(tags)
+		var familyName, metricType string
+		var samples []prometheusSample
+		switch value.Type() {
+		case "counter", "meter":
+			familyName, metricType = prometheusName(name)+"_total", "counter"
+			samples = []prometheusSample{{labels: labels, value: toFloat64(values["count"])}}
+		case "gauge":
+			familyName, metricType = prometheusName(name), "gauge"
+			samples = []prometheusSample{{labels: labels, value: toFloat64(values["value"])}}
+		case "histogram", "timer":
+			familyName, metricType = prometheusName(name), "summary"
+			scale := 1.0
+			// timers always record nanoseconds
+			if value.Type() == "timer" || durationHistograms[name] {
+				familyName, scale = familyName+"_seconds", 1e-9
+			}
+			samples = summarySamples(labels, values, scale)
+		default:
+			return
+		}
+		family, ok := families[familyName]
+		if !ok {
+			family = &prometheusFamily{name: familyName, metricType: metricType}
+			families[familyName] = family
+		}
+		// a family has a single type, which the first metric mapped to it decides
+		if family.metricType == metricType {
+			family.samples = append(family.samples, samples...)
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writer := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		if _, err := fmt.Fprintf(writer, "# TYPE %s %s\n", family.name, family.metricType); err != nil {
+			return err
+		}
+		for _, sample := range family.samples {
+			if _, err := fmt.Fprintf(writer, "%s%s%s %s\n", family.name, sample.suffix, sample.labels, formatFloat(sample.value)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+func summarySamples(labels string, values map[string]interface{}, scale float64) []prometheusSample {
+	samples := make([]prometheusSample, 0, len(summaryQuantiles)+2)
+	for _, quantile := range summaryQuantiles {
+		samples = append(samples, prometheusSample{
+			labels: withLabel(labels, "quantile", quantile.label),
+			value:  toFloat64(values[quantile.key]) * scale,
+		})
+	}
+	count := toFloat64(values["count"])
+	// histograms are sampled, so the sum is estimated from the mean of the sample
+	samples = append(samples,
+		prometheusSample{suffix: "_sum", labels: labels, value: toFloat64(values["mean"]) * count * scale},
+		prometheusSample{suffix: "_count", labels: labels, value: count})
+	return samples
+}
+
+// prometheusName replaces the characters of a metric name that prometheus does not allow with underscores
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func prometheusLabels(tags metrics.Tags) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, ok := prometheusLabelNames[tag.Key()]
+		if !ok {
+			name = strings.ReplaceAll(prometheusName(tag.Key()), ":", "_")
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(tag.Value())))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	label := fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/palantir/pkg/metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := metrics.NewRootMetricsRegistry()
+	ctx := metrics.WithRegistry(context.Background(), registry)
+	instanceGroupTag := InstanceGroupTag(ctx, "batch")
+	registry.Counter(requestCounter, SparkRoleTag(ctx, "driver"), OutcomeTag(ctx, "success"), instanceGroupTag).Inc(3)
+	registry.Histogram(schedulingProcessingTime, instanceGroupTag).Update(2 * time.Second.Nanoseconds())
+	registry.Gauge(inflightRequestCount, QueueIndexTag(ctx, 0)).Update(5)
+
+	var out bytes.Buffer
+	if err := WritePrometheus(&out, registry); err != nil {
+		t.Fatal(err)
+	}
+	exposition := out.String()
+	expectedLines := []string{
+		`# TYPE foundry_spark_scheduler_requests_total counter`,
+		`foundry_spark_scheduler_requests_total{instance_group="batch",outcome="success",role="driver"} 3`,
+		`# TYPE foundry_spark_scheduler_schedule_time_seconds summary`,
+		`foundry_spark_scheduler_schedule_time_seconds{instance_group="batch",quantile="0.5"} 2`,
+		`foundry_spark_scheduler_schedule_time_seconds_sum{instance_group="batch"} 2`,
+		`foundry_spark_scheduler_schedule_time_seconds_count{instance_group="batch"} 1`,
+		`# TYPE foundry_spark_scheduler_cache_inflight_count gauge`,
+		`foundry_spark_scheduler_cache_inflight_count{queue_index="0"} 5`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("expected the exposition to contain %q, got:\n%s", line, exposition)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
 	"github.com/palantir/k8s-spark-scheduler/internal/cache"
+	"github.com/palantir/k8s-spark-scheduler/internal/types"
 	"github.com/palantir/pkg/metrics"
 	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
 	"github.com/palantir/witchcraft-go-logging/wlog/wapp"
@@ -84,21 +85,33 @@ func (r *ResourceUsageReporter) doStart(ctx context.Context) error {
 
 func (r *ResourceUsageReporter) report(ctx context.Context, nodes []*v1.Node, rrs []*v1beta2.ResourceReservation) {
 	resourceUsages := resources.UsageForNodes(rrs)
+	extendedResourceUsages := types.ExtendedResourceUsageForNodes(rrs)
 
-	tagsToDelete := make([]metrics.Tags, 0, len(resourceUsages))
+	type reportedMetric struct {
+		name string
+		tags metrics.Tags
+	}
+	var metricsToDelete []reportedMetric
 	metrics.FromContext(ctx).Each(func(name string, tags metrics.Tags, value metrics.MetricVal) {
-		host, hostTagExists := tags.ToMap()[hostTagName]
+		tagMap := tags.ToMap()
+		host, hostTagExists := tagMap[hostTagName]
 		if !hostTagExists {
 			return
 		}
-		if _, ok := resourceUsages[host]; !ok {
-			tagsToDelete = append(tagsToDelete, tags)
+		switch name {
+		case resourceUsageCPU, resourceUsageMemory, resourceUsageNvidiaGPUs:
+			if _, ok := resourceUsages[host]; !ok {
+				metricsToDelete = append(metricsToDelete, reportedMetric{name, tags})
+			}
+		case resourceUsageExtended:
+			// extended resources are reported per resource, so a host keeps the gauges of the resources it still uses
+			if !usesExtendedResource(ctx, extendedResourceUsages[host], tagMap[resourceTagName]) {
+				metricsToDelete = append(metricsToDelete, reportedMetric{name, tags})
+			}
 		}
 	})
-	for _, tags := range tagsToDelete {
-		metrics.FromContext(ctx).Unregister(resourceUsageCPU, tags...)
-		metrics.FromContext(ctx).Unregister(resourceUsageMemory, tags...)
-		metrics.FromContext(ctx).Unregister(resourceUsageNvidiaGPUs, tags...)
+	for _, metric := range metricsToDelete {
+		metrics.FromContext(ctx).Unregister(metric.name, metric.tags...)
 	}
 	for _, n := range nodes {
 		usage, ok := resourceUsages[n.Name]
@@ -110,5 +123,20 @@ func (r *ResourceUsageReporter) report(ctx context.Context, nodes []*v1.Node, rr
 		metrics.FromContext(ctx).Gauge(resourceUsageCPU, hostTag, instanceGroupTag).Update(usage.CPU.Value())
 		metrics.FromContext(ctx).Gauge(resourceUsageMemory, hostTag, instanceGroupTag).Update(usage.Memory.Value())
 		metrics.FromContext(ctx).Gauge(resourceUsageNvidiaGPUs, hostTag, instanceGroupTag).Update(usage.NvidiaGPU.Value())
+		for name, quantity := range extendedResourceUsages[n.Name] {
+			if quantity.IsZero() {
+				continue
+			}
+			metrics.FromContext(ctx).Gauge(resourceUsageExtended, hostTag, instanceGroupTag, ResourceTag(ctx, string(name))).Update(quantity.Value())
+		}
+	}
+}
+
+func usesExtendedResource(ctx context.Context, usage v1.ResourceList, resourceTagValue string) bool {
+	for name, quantity := range usage {
+		if ResourceTag(ctx, string(name)).Value() == resourceTagValue {
+			return !quantity.IsZero()
+		}
 	}
+	return false
 }
@@ -0,0 +1,62 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReportUnregistersExtendedResourceUsage(t *testing.T) {
+	ctx := metrics.WithRegistry(context.Background(), metrics.NewRootMetricsRegistry())
+	reporter := &ResourceUsageReporter{instanceGroupTagLabel: "instance-group"}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"instance-group": "batch"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"instance-group": "batch"}}},
+	}
+	reservation := func(node string, fpgas string) *v1beta2.ResourceReservation {
+		cpu, fpga := resource.MustParse("1"), resource.MustParse(fpgas)
+		return &v1beta2.ResourceReservation{Spec: v1beta2.ResourceReservationSpec{
+			Reservations: map[string]v1beta2.Reservation{"driver": {
+				Node:      node,
+				Resources: v1beta2.ResourceList{string(v1beta2.ResourceCPU): &cpu, "example.com/fpga": &fpga},
+			}},
+		}}
+	}
+	extendedGauges := func() map[string]bool {
+		hosts := make(map[string]bool)
+		metrics.FromContext(ctx).Each(func(name string, tags metrics.Tags, _ metrics.MetricVal) {
+			if name == resourceUsageExtended {
+				hosts[tags.ToMap()[hostTagName]] = true
+			}
+		})
+		return hosts
+	}
+
+	reporter.report(ctx, nodes, []*v1beta2.ResourceReservation{reservation("node1", "1"), reservation("node2", "1")})
+	if hosts := extendedGauges(); !hosts["node1"] || !hosts["node2"] {
+		t.Fatalf("expected the extended resource usage of both hosts to be reported, got %v", hosts)
+	}
+	reporter.report(ctx, nodes, []*v1beta2.ResourceReservation{reservation("node1", "0")})
+	if hosts := extendedGauges(); len(hosts) != 0 {
+		t.Errorf("expected the extended resource usage of a host without usage or reservations to be unregistered, got %v", hosts)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	werror "github.com/palantir/witchcraft-go-error"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+// ReplayReport compares the decisions of a replayed recording to the recorded ones
+type ReplayReport struct {
+	Requests int `json:"requests"`
+	Matching int `json:"matching"`
+	// Skipped are the requests recorded before the first full cluster state of the recording, which can not be replayed
+	Skipped     int                `json:"skipped"`
+	Differences []ReplayDifference `json:"differences"`
+}
+
+// ReplayDifference is a recorded request the extender decided differently on when replayed
+type ReplayDifference struct {
+	Time     time.Time   `json:"time"`
+	Verb     string      `json:"verb"`
+	Pod      string      `json:"pod"`
+	Recorded interface{} `json:"recorded"`
+	Replayed interface{} `json:"replayed"`
+}
+
+// Replay feeds every request of a recording to an extender configured by the install config, set up with the cluster
+// state the request was recorded with, which is the last full state of the recording with the changes recorded since
+// applied on top. Pod timestamps are shifted by the time elapsed since the request was recorded,
+// so that decisions depending on the age of pods are reproduced.
+func Replay(ctx context.Context, install config.Install, recording io.Reader) (*ReplayReport, error) {
+	report := &ReplayReport{Differences: []ReplayDifference{}}
+	decoder := json.NewDecoder(recording)
+	var state *replayState
+	for {
+		var record extender.SchedulingRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return report, nil
+		} else if err != nil {
+			return nil, werror.Wrap(err, "failed to parse recording", werror.SafeParam("requests", report.Requests))
+		}
+		report.Requests++
+		if record.State != nil {
+			state = newReplayState(record.State)
+		} else if state != nil && record.Changes != nil {
+			state.apply(record.Changes)
+		}
+		if state == nil {
+			report.Skipped++
+			continue
+		}
+		difference, err := replayRecord(ctx, install, record, state.clusterState())
+		if err != nil {
+			return nil, err
+		}
+		if difference != nil {
+			report.Differences = append(report.Differences, *difference)
+		} else {
+			report.Matching++
+		}
+	}
+}
+
+func replayRecord(
+	ctx context.Context,
+	install config.Install,
+	record extender.SchedulingRecord,
+	state extender.ClusterState) (*ReplayDifference, error) {
+	if record.Args.Pod == nil || record.Args.NodeNames == nil {
+		return nil, werror.Error("recorded request is missing its pod or node names", werror.SafeParam("time", record.Time))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	shift := time.Since(record.Time)
+	objects := make([]runtime.Object, 0, len(state.Nodes)+len(state.Pods))
+	for i := range state.Nodes {
+		objects = append(objects, &state.Nodes[i])
+	}
+	for i := range state.Pods {
+		shiftPodTimestamps(&state.Pods[i], shift)
+		objects = append(objects, &state.Pods[i])
+	}
+	shiftPodTimestamps(record.Args.Pod, shift)
+	harness, err := extendertest.NewHarness(ctx, install, objects...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range state.ResourceReservations {
+		rr := &state.ResourceReservations[i]
+		rr.CreationTimestamp = shiftTime(rr.CreationTimestamp, shift)
+		if err := harness.ResourceReservationCache.Create(ctx, rr); err != nil {
+			return nil, err
+		}
+	}
+	for appID, reservations := range state.SoftReservations {
+		harness.SoftReservationStore.CreateSoftReservationIfNotExists(appID)
+		for podName, reservation := range reservations {
+			if err := harness.SoftReservationStore.AddReservationForPod(ctx, appID, podName, reservation); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	difference := &ReplayDifference{
+		Time: record.Time,
+		Verb: record.Verb,
+		Pod:  record.Args.Pod.Namespace + "/" + record.Args.Pod.Name,
+	}
+	switch record.Verb {
+	case extender.RecordedPredicates:
+		replayed := harness.Extender.Predicate(ctx, record.Args)
+		if sameFilterResult(record.FilterResult, replayed) {
+			return nil, nil
+		}
+		difference.Recorded, difference.Replayed = record.FilterResult, replayed
+	case extender.RecordedPrioritize:
+		replayed := harness.Extender.Prioritize(ctx, record.Args)
+		if sameHostPriorities(record.HostPriorities, replayed) {
+			return nil, nil
+		}
+		difference.Recorded, difference.Replayed = record.HostPriorities, replayed
+	default:
+		return nil, werror.Error("unknown recorded verb", werror.SafeParam("verb", record.Verb))
+	}
+	return difference, nil
+}
+
+// replayState is the cluster state of a recording as of the last replayed record, keyed like the recorded changes
+type replayState struct {
+	nodes                map[string]v1.Node
+	pods                 map[string]v1.Pod
+	resourceReservations map[string]v1beta2.ResourceReservation
+	softReservations     map[string]map[string]v1beta2.Reservation
+}
+
+func newReplayState(state *extender.ClusterState) *replayState {
+	s := &replayState{
+		nodes:                make(map[string]v1.Node),
+		pods:                 make(map[string]v1.Pod),
+		resourceReservations: make(map[string]v1beta2.ResourceReservation),
+		softReservations:     make(map[string]map[string]v1beta2.Reservation),
+	}
+	s.apply(&extender.ClusterStateChanges{
+		Nodes:                state.Nodes,
+		Pods:                 state.Pods,
+		ResourceReservations: state.ResourceReservations,
+		SoftReservations:     state.SoftReservations,
+	})
+	return s
+}
+
+func (s *replayState) apply(changes *extender.ClusterStateChanges) {
+	for _, node := range changes.Nodes {
+		s.nodes[node.Name] = node
+	}
+	for _, name := range changes.DeletedNodes {
+		delete(s.nodes, name)
+	}
+	for _, pod := range changes.Pods {
+		s.pods[pod.Namespace+"/"+pod.Name] = pod
+	}
+	for _, key := range changes.DeletedPods {
+		delete(s.pods, key)
+	}
+	for _, rr := range changes.ResourceReservations {
+		s.resourceReservations[rr.Namespace+"/"+rr.Name] = rr
+	}
+	for _, key := range changes.DeletedResourceReservations {
+		delete(s.resourceReservations, key)
+	}
+	for appID, reservations := range changes.SoftReservations {
+		s.softReservations[appID] = reservations
+	}
+	for _, appID := range changes.DeletedSoftReservations {
+		delete(s.softReservations, appID)
+	}
+}
+
+// clusterState returns a copy of the state, which replaying a record can modify
+func (s *replayState) clusterState() extender.ClusterState {
+	state := extender.ClusterState{SoftReservations: make(map[string]map[string]v1beta2.Reservation)}
+	for _, node := range s.nodes {
+		state.Nodes = append(state.Nodes, *node.DeepCopy())
+	}
+	for _, pod := range s.pods {
+		state.Pods = append(state.Pods, *pod.DeepCopy())
+	}
+	for _, rr := range s.resourceReservations {
+		state.ResourceReservations = append(state.ResourceReservations, *rr.DeepCopy())
+	}
+	for appID, reservations := range s.softReservations {
+		state.SoftReservations[appID] = make(map[string]v1beta2.Reservation, len(reservations))
+		for podName, reservation := range reservations {
+			state.SoftReservations[appID][podName] = *reservation.DeepCopy()
+		}
+	}
+	return state
+}
+
+// sameFilterResult compares the nodes a pod was filtered to and the error, and ignores the messages of failed nodes
+func sameFilterResult(recorded, replayed *schedulerapi.ExtenderFilterResult) bool {
+	if recorded == nil || replayed == nil {
+		return recorded == replayed
+	}
+	var recordedNodes, replayedNodes []string
+	if recorded.NodeNames != nil {
+		recordedNodes = *recorded.NodeNames
+	}
+	if replayed.NodeNames != nil {
+		replayedNodes = *replayed.NodeNames
+	}
+	return len(recordedNodes) == len(replayedNodes) &&
+		(len(recordedNodes) == 0 || reflect.DeepEqual(recordedNodes, replayedNodes)) &&
+		recorded.Error == replayed.Error
+}
+
+func sameHostPriorities(recorded, replayed *schedulerapi.HostPriorityList) bool {
+	if recorded == nil || replayed == nil {
+		return recorded == replayed
+	}
+	sorted := func(priorities schedulerapi.HostPriorityList) schedulerapi.HostPriorityList {
+		result := append(schedulerapi.HostPriorityList{}, priorities...)
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Host < result[j].Host
+		})
+		return result
+	}
+	return reflect.DeepEqual(sorted(*recorded), sorted(*replayed))
+}
+
+func shiftPodTimestamps(pod *v1.Pod, shift time.Duration) {
+	pod.CreationTimestamp = shiftTime(pod.CreationTimestamp, shift)
+	if pod.Status.StartTime != nil {
+		startTime := shiftTime(*pod.Status.StartTime, shift)
+		pod.Status.StartTime = &startTime
+	}
+}
+
+func shiftTime(t metav1.Time, shift time.Duration) metav1.Time {
+	if t.IsZero() {
+		return t
+	}
+	return metav1.NewTime(t.Add(shift))
+}
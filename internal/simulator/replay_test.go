@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	v1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+func TestReplay(t *testing.T) {
+	node1 := extendertest.NewNode("node1", "zone1")
+	node2 := extendertest.NewNode("node2", "zone1")
+	nodeNames := []string{node1.Name, node2.Name}
+	podsToSchedule := extendertest.StaticAllocationSparkPods("app", 2)
+	podsToSchedule[0].Spec.Containers = []v1.Container{{
+		Name: "driver",
+		Env: []v1.EnvVar{
+			{Name: "SPARK_JAVA_OPTS", Value: "-Dspark.executor.instances=2 -Dcredentials=secret"},
+			{Name: "TOKEN", Value: "secret"},
+			{Name: "PASSWORD", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{Key: "password"}}},
+		},
+		Args: []string{"--token", "secret", "--conf", "spark.executor.memory=1g"},
+	}}
+
+	testHarness, err := extendertest.NewTestExtender(binpacker.SingleAzTightlyPack, &node1, &node2, &podsToSchedule[0])
+	if err != nil {
+		t.Fatal("Could not setup test extender")
+	}
+	var recording bytes.Buffer
+	recorder := extender.NewSchedulingRecorder(
+		&recording,
+		corelisters.NewNodeLister(testHarness.NodeStore.(cache.Indexer)),
+		corelisters.NewPodLister(testHarness.PodStore.(cache.Indexer)),
+		testHarness.ResourceReservationCache,
+		testHarness.SoftReservationStore)
+	for i := range podsToSchedule {
+		pod := podsToSchedule[i]
+		args := schedulerapi.ExtenderArgs{Pod: &pod, NodeNames: &nodeNames}
+		result := recorder.RecordPredicate(testHarness.Ctx, args, func() *schedulerapi.ExtenderFilterResult {
+			return testHarness.Extender.Predicate(testHarness.Ctx, args)
+		})
+		if result.NodeNames == nil || len(*result.NodeNames) != 1 {
+			t.Fatalf("expected %s to be scheduled, got %v", pod.Name, result)
+		}
+		pod.Spec.NodeName = (*result.NodeNames)[0]
+		if err := testHarness.PodStore.Update(&pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	install := config.Install{FIFO: true, BinpackAlgo: binpacker.SingleAzTightlyPack}
+	report, err := Replay(testHarness.Ctx, install, bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 3 || report.Matching != 3 {
+		t.Errorf("expected the 3 recorded requests to be replayed with the same decisions, got %+v", report)
+	}
+
+	var records []extender.SchedulingRecord
+	decoder := json.NewDecoder(bytes.NewReader(recording.Bytes()))
+	for decoder.More() {
+		var record extender.SchedulingRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if records[0].State == nil || records[1].State != nil || records[1].Changes == nil || len(records[1].Changes.Pods) != 1 {
+		t.Errorf("expected the full state to be recorded first and only the scheduled driver to be recorded next, got %+v", records)
+	}
+	recordedDriver := records[0].Args.Pod.Spec.Containers[0]
+	expectedEnv := []v1.EnvVar{{Name: "SPARK_JAVA_OPTS", Value: "-Dspark.executor.instances=2"}}
+	expectedArgs := []string{"--conf", "spark.executor.memory=1g"}
+	if !reflect.DeepEqual(recordedDriver.Env, expectedEnv) || !reflect.DeepEqual(recordedDriver.Args, expectedArgs) {
+		t.Errorf("expected only the spark configuration of the driver to be recorded, got %v %v", recordedDriver.Env, recordedDriver.Args)
+	}
+
+	changesOnly, err := json.Marshal(records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = Replay(testHarness.Ctx, install, bytes.NewReader(changesOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 1 || report.Skipped != 1 {
+		t.Errorf("expected a request recorded before any full state to be skipped, got %+v", report)
+	}
+
+	record := records[0]
+	otherNode := "node3"
+	record.FilterResult.NodeNames = &[]string{otherNode}
+	tampered, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = Replay(testHarness.Ctx, install, bytes.NewReader(tampered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 1 || len(report.Differences) != 1 || report.Differences[0].Pod != podsToSchedule[0].Namespace+"/"+podsToSchedule[0].Name {
+		t.Errorf("expected the tampered driver decision to differ, got %+v", report)
+	}
+}
@@ -0,0 +1,596 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/k8s-spark-scheduler/internal/extender/extendertest"
+	werror "github.com/palantir/witchcraft-go-error"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	schedulerapi "k8s.io/kube-scheduler/extender/v1"
+)
+
+const (
+	defaultStep               = 10 * time.Second
+	defaultHorizon            = 24 * time.Hour
+	defaultInstanceGroupLabel = "resource_channel"
+	defaultNamespace          = "default"
+)
+
+// Trace describes the nodes of a simulated cluster and the spark applications submitted to it
+type Trace struct {
+	Nodes        []Node        `json:"nodes"`
+	Applications []Application `json:"applications"`
+	// Step is the interval pending drivers are retried at, 10s by default
+	Step metav1.Duration `json:"step,omitempty"`
+	// Horizon bounds the simulated time after the last submission, 24h by default
+	Horizon metav1.Duration `json:"horizon,omitempty"`
+}
+
+// Node describes a group of identical nodes of the simulated cluster
+type Node struct {
+	Name          string            `json:"name"`
+	Count         int               `json:"count,omitempty"`
+	InstanceGroup string            `json:"instanceGroup"`
+	Zone          string            `json:"zone,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Resources     Resources         `json:"resources"`
+}
+
+// Application describes a spark application submitted to the simulated cluster
+type Application struct {
+	ID            string          `json:"id"`
+	Namespace     string          `json:"namespace,omitempty"`
+	InstanceGroup string          `json:"instanceGroup"`
+	SubmitAt      metav1.Duration `json:"submitAt"`
+	Duration      metav1.Duration `json:"duration"`
+	Driver        Resources       `json:"driver"`
+	Executor      Resources       `json:"executor"`
+	ExecutorCount int             `json:"executorCount"`
+	// Annotations are added to the driver, such as an expected runtime hint
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Resources are the resources of a node, or the ones requested by a driver or an executor
+type Resources struct {
+	CPU       resource.Quantity `json:"cpu"`
+	Memory    resource.Quantity `json:"memory"`
+	NvidiaGPU resource.Quantity `json:"nvidiaGpu,omitempty"`
+}
+
+// Report summarizes how the simulated cluster handled the trace
+type Report struct {
+	Applications int `json:"applications"`
+	Scheduled    int `json:"scheduled"`
+	// Unscheduled counts the applications still pending at the end of the simulation
+	Unscheduled   int         `json:"unscheduled"`
+	QueueingDelay DelayReport `json:"queueingDelay"`
+	Utilization   Utilization `json:"utilization"`
+	// Fragmentation is the average share of free cpu that is not on the node with the most free cpu
+	Fragmentation float64 `json:"fragmentation"`
+	// PackingEfficiency is the average of the highest share of cpu or memory reserved on every node in use
+	PackingEfficiency float64 `json:"packingEfficiency"`
+	// SimulatedSeconds is the simulated time until the last application finished, or the horizon
+	SimulatedSeconds float64             `json:"simulatedSeconds"`
+	PerApplication   []ApplicationReport `json:"perApplication"`
+}
+
+// DelayReport holds statistics of the time scheduled applications waited for, in seconds
+type DelayReport struct {
+	MeanSeconds float64 `json:"meanSeconds"`
+	P50Seconds  float64 `json:"p50Seconds"`
+	P90Seconds  float64 `json:"p90Seconds"`
+	MaxSeconds  float64 `json:"maxSeconds"`
+}
+
+// Utilization holds the average share of the cluster resources reserved by applications
+type Utilization struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+}
+
+// ApplicationReport describes how a single application was scheduled
+type ApplicationReport struct {
+	ID                   string  `json:"id"`
+	Scheduled            bool    `json:"scheduled"`
+	QueueingDelaySeconds float64 `json:"queueingDelaySeconds,omitempty"`
+}
+
+type simulatedApplication struct {
+	Application
+	driver    v1.Pod
+	executors []v1.Pod
+	submitted bool
+	started   bool
+	finished  bool
+	start     time.Duration
+	// usage holds the resources the application reserves per node while it runs
+	usage map[string]*v1.ResourceList
+}
+
+type simulation struct {
+	ctx                context.Context
+	harness            *extendertest.Harness
+	instanceGroupLabel string
+	nodes              []*v1.Node
+	nodeNames          []string
+	applications       []*simulatedApplication
+	samples            []sample
+}
+
+type sample struct {
+	cpuUtilization    float64
+	memoryUtilization float64
+	fragmentation     float64
+	packingEfficiency float64
+	nodesInUse        bool
+}
+
+// Run replays the trace through an extender configured by the install config, and reports how the applications were
+// scheduled. Drivers are retried at every step until they are scheduled, after which their executors are scheduled
+// right away, and applications release their reservations once their duration passes.
+func Run(ctx context.Context, install config.Install, trace Trace) (*Report, error) {
+	step := trace.Step.Duration
+	if step <= 0 {
+		step = defaultStep
+	}
+	horizon := trace.Horizon.Duration
+	if horizon <= 0 {
+		horizon = defaultHorizon
+	}
+	instanceGroupLabel := install.InstanceGroupLabel
+	if instanceGroupLabel == "" {
+		instanceGroupLabel = defaultInstanceGroupLabel
+	}
+	nodes, err := simulatedNodes(trace.Nodes, instanceGroupLabel)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := simulatedApplications(trace.Applications, instanceGroupLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]runtime.Object, 0, len(nodes))
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		objects = append(objects, node)
+		nodeNames = append(nodeNames, node.Name)
+	}
+	harness, err := extendertest.NewHarness(ctx, install, objects...)
+	if err != nil {
+		return nil, err
+	}
+	s := &simulation{
+		ctx:                ctx,
+		harness:            harness,
+		instanceGroupLabel: instanceGroupLabel,
+		nodes:              nodes,
+		nodeNames:          nodeNames,
+		applications:       applications,
+	}
+
+	var end time.Duration
+	if len(applications) > 0 {
+		end = applications[len(applications)-1].SubmitAt.Duration + horizon
+	}
+	now := time.Duration(0)
+	for ; now <= end; now += step {
+		if err := s.step(now); err != nil {
+			return nil, err
+		}
+		if s.done() {
+			break
+		}
+		s.samples = append(s.samples, s.sample())
+	}
+	return s.report(now), nil
+}
+
+func (s *simulation) step(now time.Duration) error {
+	for _, app := range s.applications {
+		if app.started && !app.finished && app.start+app.Duration.Duration <= now {
+			if err := s.finish(app); err != nil {
+				return err
+			}
+		}
+	}
+	for _, app := range s.applications {
+		if !app.submitted && app.SubmitAt.Duration <= now {
+			app.submitted = true
+			if err := s.harness.PodStore.Add(&app.driver); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.refreshTimestamps(now); err != nil {
+		return err
+	}
+	for _, app := range s.applications {
+		if app.submitted && !app.started {
+			if err := s.schedule(app, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refreshTimestamps shifts the creation time of pending drivers and the start time of running drivers, as the extender
+// compares them to the wall clock
+func (s *simulation) refreshTimestamps(now time.Duration) error {
+	wallNow := time.Now()
+	for _, app := range s.applications {
+		if !app.submitted || app.finished {
+			continue
+		}
+		app.driver.CreationTimestamp = metav1.NewTime(wallNow.Add(app.SubmitAt.Duration - now))
+		if app.started {
+			startTime := metav1.NewTime(wallNow.Add(app.start - now))
+			app.driver.Status.StartTime = &startTime
+		}
+		if err := s.harness.PodStore.Update(&app.driver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *simulation) schedule(app *simulatedApplication, now time.Duration) error {
+	driverNode, ok, err := s.predicate(&app.driver)
+	if err != nil || !ok {
+		return err
+	}
+	app.started = true
+	app.start = now
+	app.usage = make(map[string]*v1.ResourceList)
+	addUsage(app.usage, driverNode, app.Driver)
+	for i := range app.executors {
+		executorNode, ok, err := s.predicate(&app.executors[i])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return werror.Error("executor did not fit to its reservation",
+				werror.SafeParam("applicationID", app.ID),
+				werror.SafeParam("executorName", app.executors[i].Name))
+		}
+		addUsage(app.usage, executorNode, app.Executor)
+	}
+	return nil
+}
+
+// predicate asks the extender for a node for the pod and binds the pod to it, taking the highest scored node if the
+// extender returns more than one
+func (s *simulation) predicate(pod *v1.Pod) (string, bool, error) {
+	result := s.harness.Extender.Predicate(s.ctx, schedulerapi.ExtenderArgs{
+		Pod:       pod,
+		NodeNames: &s.nodeNames,
+	})
+	if result.NodeNames == nil || len(*result.NodeNames) == 0 {
+		return "", false, nil
+	}
+	nodeName := (*result.NodeNames)[0]
+	if len(*result.NodeNames) > 1 {
+		priorities := s.harness.Extender.Prioritize(s.ctx, schedulerapi.ExtenderArgs{Pod: pod, NodeNames: result.NodeNames})
+		var best int64 = math.MinInt64
+		for _, priority := range *priorities {
+			if priority.Score > best {
+				best, nodeName = priority.Score, priority.Host
+			}
+		}
+	}
+	pod.Spec.NodeName = nodeName
+	pod.Status.Phase = v1.PodRunning
+	if err := s.harness.PodStore.Update(pod); err != nil {
+		return "", false, err
+	}
+	return nodeName, true, nil
+}
+
+func (s *simulation) finish(app *simulatedApplication) error {
+	app.finished = true
+	for i := range app.executors {
+		if err := s.harness.PodStore.Delete(&app.executors[i]); err != nil {
+			return err
+		}
+	}
+	if err := s.harness.PodStore.Delete(&app.driver); err != nil {
+		return err
+	}
+	// reservations are garbage collected through their owner reference in a real cluster
+	s.harness.ResourceReservationCache.Delete(s.harness.Ctx, app.driver.Namespace, app.ID)
+	return nil
+}
+
+func (s *simulation) done() bool {
+	for _, app := range s.applications {
+		if !app.finished {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *simulation) sample() sample {
+	used := make(map[string]v1.ResourceList, len(s.nodes))
+	for _, app := range s.applications {
+		if !app.started || app.finished {
+			continue
+		}
+		for nodeName, usage := range app.usage {
+			nodeUsage, ok := used[nodeName]
+			if !ok {
+				nodeUsage = v1.ResourceList{}
+				used[nodeName] = nodeUsage
+			}
+			for name, quantity := range *usage {
+				total := nodeUsage[name]
+				total.Add(quantity)
+				nodeUsage[name] = total
+			}
+		}
+	}
+	var allocatableCPU, allocatableMemory, usedCPU, usedMemory, totalFreeCPU, maxFreeCPU int64
+	var efficiencySum float64
+	nodesInUse := 0
+	for _, node := range s.nodes {
+		nodeAllocatableCPU := node.Status.Allocatable.Cpu().MilliValue()
+		nodeAllocatableMemory := node.Status.Allocatable.Memory().Value()
+		nodeUsage := used[node.Name]
+		nodeUsedCPU := nodeUsage.Cpu().MilliValue()
+		nodeUsedMemory := nodeUsage.Memory().Value()
+		allocatableCPU += nodeAllocatableCPU
+		allocatableMemory += nodeAllocatableMemory
+		usedCPU += nodeUsedCPU
+		usedMemory += nodeUsedMemory
+		freeCPU := nodeAllocatableCPU - nodeUsedCPU
+		totalFreeCPU += freeCPU
+		if freeCPU > maxFreeCPU {
+			maxFreeCPU = freeCPU
+		}
+		if nodeUsedCPU > 0 || nodeUsedMemory > 0 {
+			nodesInUse++
+			efficiencySum += math.Max(ratio(nodeUsedCPU, nodeAllocatableCPU), ratio(nodeUsedMemory, nodeAllocatableMemory))
+		}
+	}
+	result := sample{
+		cpuUtilization:    ratio(usedCPU, allocatableCPU),
+		memoryUtilization: ratio(usedMemory, allocatableMemory),
+		nodesInUse:        nodesInUse > 0,
+	}
+	if totalFreeCPU > 0 {
+		result.fragmentation = 1 - ratio(maxFreeCPU, totalFreeCPU)
+	}
+	if nodesInUse > 0 {
+		result.packingEfficiency = efficiencySum / float64(nodesInUse)
+	}
+	return result
+}
+
+func (s *simulation) report(now time.Duration) *Report {
+	report := &Report{
+		Applications:     len(s.applications),
+		SimulatedSeconds: now.Seconds(),
+		PerApplication:   make([]ApplicationReport, 0, len(s.applications)),
+	}
+	delays := make([]float64, 0, len(s.applications))
+	for _, app := range s.applications {
+		appReport := ApplicationReport{ID: app.ID, Scheduled: app.started}
+		if app.started {
+			report.Scheduled++
+			appReport.QueueingDelaySeconds = (app.start - app.SubmitAt.Duration).Seconds()
+			delays = append(delays, appReport.QueueingDelaySeconds)
+		} else {
+			report.Unscheduled++
+		}
+		report.PerApplication = append(report.PerApplication, appReport)
+	}
+	report.QueueingDelay = delayReport(delays)
+
+	samplesInUse := 0
+	for _, sample := range s.samples {
+		report.Utilization.CPU += sample.cpuUtilization
+		report.Utilization.Memory += sample.memoryUtilization
+		report.Fragmentation += sample.fragmentation
+		if sample.nodesInUse {
+			report.PackingEfficiency += sample.packingEfficiency
+			samplesInUse++
+		}
+	}
+	if len(s.samples) > 0 {
+		report.Utilization.CPU /= float64(len(s.samples))
+		report.Utilization.Memory /= float64(len(s.samples))
+		report.Fragmentation /= float64(len(s.samples))
+	}
+	if samplesInUse > 0 {
+		report.PackingEfficiency /= float64(samplesInUse)
+	}
+	return report
+}
+
+func delayReport(delays []float64) DelayReport {
+	if len(delays) == 0 {
+		return DelayReport{}
+	}
+	sort.Float64s(delays)
+	var sum float64
+	for _, delay := range delays {
+		sum += delay
+	}
+	return DelayReport{
+		MeanSeconds: sum / float64(len(delays)),
+		P50Seconds:  percentile(delays, 0.5),
+		P90Seconds:  percentile(delays, 0.9),
+		MaxSeconds:  delays[len(delays)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func ratio(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func addUsage(usage map[string]*v1.ResourceList, nodeName string, requests Resources) {
+	nodeUsage, ok := usage[nodeName]
+	if !ok {
+		nodeUsage = &v1.ResourceList{}
+		usage[nodeName] = nodeUsage
+	}
+	for name, quantity := range requests.resourceList() {
+		total := (*nodeUsage)[name]
+		total.Add(quantity)
+		(*nodeUsage)[name] = total
+	}
+}
+
+func (r Resources) resourceList() v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:            r.CPU,
+		v1.ResourceMemory:         r.Memory,
+		v1beta2.ResourceNvidiaGPU: r.NvidiaGPU,
+	}
+}
+
+func simulatedNodes(nodeGroups []Node, instanceGroupLabel string) ([]*v1.Node, error) {
+	nodes := make([]*v1.Node, 0, len(nodeGroups))
+	for _, group := range nodeGroups {
+		if group.Name == "" || group.InstanceGroup == "" {
+			return nil, werror.Error("nodes need a name and an instance group")
+		}
+		count := group.Count
+		if count <= 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			name := group.Name
+			if group.Count > 1 {
+				name = fmt.Sprintf("%s-%d", group.Name, i)
+			}
+			labels := map[string]string{
+				instanceGroupLabel:        group.InstanceGroup,
+				v1.LabelTopologyZone:      group.Zone,
+				v1.LabelZoneFailureDomain: group.Zone,
+			}
+			for key, value := range group.Labels {
+				labels[key] = value
+			}
+			nodes = append(nodes, &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					UID:    k8stypes.UID(name),
+					Labels: labels,
+				},
+				Status: v1.NodeStatus{
+					Allocatable: group.Resources.resourceList(),
+					Conditions: []v1.NodeCondition{{
+						Type:   v1.NodeReady,
+						Status: v1.ConditionTrue,
+					}},
+				},
+			})
+		}
+	}
+	return nodes, nil
+}
+
+func simulatedApplications(applications []Application, instanceGroupLabel string) ([]*simulatedApplication, error) {
+	simulated := make([]*simulatedApplication, 0, len(applications))
+	seen := make(map[string]bool, len(applications))
+	for _, app := range applications {
+		if app.ID == "" || app.InstanceGroup == "" {
+			return nil, werror.Error("applications need an id and an instance group")
+		}
+		if seen[app.ID] {
+			return nil, werror.Error("application ids must be unique", werror.SafeParam("applicationID", app.ID))
+		}
+		seen[app.ID] = true
+		if app.Namespace == "" {
+			app.Namespace = defaultNamespace
+		}
+		annotations := map[string]string{
+			common.DriverCPU:          app.Driver.CPU.String(),
+			common.DriverMemory:       app.Driver.Memory.String(),
+			common.DriverNvidiaGPUs:   app.Driver.NvidiaGPU.String(),
+			common.ExecutorCPU:        app.Executor.CPU.String(),
+			common.ExecutorMemory:     app.Executor.Memory.String(),
+			common.ExecutorNvidiaGPUs: app.Executor.NvidiaGPU.String(),
+			common.ExecutorCount:      strconv.Itoa(app.ExecutorCount),
+		}
+		for key, value := range app.Annotations {
+			annotations[key] = value
+		}
+		driver := simulatedPod(app, common.Driver, app.ID+"-driver", instanceGroupLabel)
+		driver.Annotations = annotations
+		executors := make([]v1.Pod, 0, app.ExecutorCount)
+		for i := 0; i < app.ExecutorCount; i++ {
+			executors = append(executors, simulatedPod(app, common.Executor, fmt.Sprintf("%s-exec-%d", app.ID, i), instanceGroupLabel))
+		}
+		simulated = append(simulated, &simulatedApplication{
+			Application: app,
+			driver:      driver,
+			executors:   executors,
+		})
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].SubmitAt.Duration < simulated[j].SubmitAt.Duration
+	})
+	return simulated, nil
+}
+
+func simulatedPod(app Application, role, name, instanceGroupLabel string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: app.Namespace,
+			UID:       k8stypes.UID(app.Namespace + "/" + name),
+			Labels: map[string]string{
+				common.SparkRoleLabel:  role,
+				common.SparkAppIDLabel: app.ID,
+			},
+		},
+		Spec: v1.PodSpec{
+			SchedulerName: common.SparkSchedulerName,
+			NodeSelector:  map[string]string{instanceGroupLabel: app.InstanceGroup},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+		},
+	}
+}
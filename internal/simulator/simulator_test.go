@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/binpacker"
+	"github.com/palantir/witchcraft-go-logging/wlog"
+	"sigs.k8s.io/yaml"
+)
+
+const testTrace = `
+step: 10s
+nodes:
+- name: node
+  instanceGroup: batch
+  zone: zone1
+  resources: {cpu: "8", memory: 16Gi}
+applications:
+- id: large-app
+  instanceGroup: batch
+  submitAt: 0s
+  duration: 60s
+  driver: {cpu: "1", memory: 1Gi}
+  executor: {cpu: "2", memory: 1Gi}
+  executorCount: 3
+- id: medium-app
+  instanceGroup: batch
+  submitAt: 10s
+  duration: 60s
+  driver: {cpu: "1", memory: 1Gi}
+  executor: {cpu: "2", memory: 1Gi}
+  executorCount: 2
+- id: small-app
+  instanceGroup: batch
+  submitAt: 20s
+  duration: 60s
+  driver: {cpu: "1", memory: 1Gi}
+  executorCount: 0
+`
+
+func TestRun(t *testing.T) {
+	var trace Trace
+	if err := yaml.UnmarshalStrict([]byte(testTrace), &trace); err != nil {
+		t.Fatal(err)
+	}
+	wlog.SetDefaultLoggerProvider(wlog.NewNoopLoggerProvider())
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		fifo           bool
+		expectedDelays map[string]float64
+	}{{
+		name: "small application waits behind the medium application with fifo",
+		fifo: true,
+		expectedDelays: map[string]float64{
+			"large-app":  0,
+			"medium-app": 50,
+			"small-app":  40,
+		},
+	}, {
+		name: "small application fills the remaining capacity without fifo",
+		fifo: false,
+		expectedDelays: map[string]float64{
+			"large-app":  0,
+			"medium-app": 50,
+			"small-app":  0,
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := Run(ctx, config.Install{FIFO: test.fifo, BinpackAlgo: binpacker.SingleAzTightlyPack}, trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Scheduled != 3 || report.Unscheduled != 0 {
+				t.Fatalf("expected every application to be scheduled, got %d scheduled and %d unscheduled", report.Scheduled, report.Unscheduled)
+			}
+			for _, app := range report.PerApplication {
+				if app.QueueingDelaySeconds != test.expectedDelays[app.ID] {
+					t.Errorf("expected %s to wait for %vs, waited for %vs", app.ID, test.expectedDelays[app.ID], app.QueueingDelaySeconds)
+				}
+			}
+			if report.Utilization.CPU <= 0 || report.Utilization.CPU > 1 {
+				t.Errorf("expected cpu utilization to be a positive ratio, got %v", report.Utilization.CPU)
+			}
+		})
+	}
+}
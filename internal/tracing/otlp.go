@@ -0,0 +1,293 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/pkg/metrics"
+	"github.com/palantir/witchcraft-go-logging/wlog/svclog/svc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+)
+
+const (
+	otlpBatchSize     = 512
+	otlpQueueSize     = 4096
+	otlpFlushInterval = 5 * time.Second
+	otlpTimeout       = 10 * time.Second
+
+	otlpDroppedSpansMetricName   = "foundry.spark.scheduler.tracing.otlp.dropped.spans"
+	otlpDroppedBatchesMetricName = "foundry.spark.scheduler.tracing.otlp.dropped.batches"
+)
+
+// otlp span kinds and status codes, as defined by the OpenTelemetry protocol
+const (
+	otlpKindInternal    = 1
+	otlpKindServer      = 2
+	otlpKindClient      = 3
+	otlpKindProducer    = 4
+	otlpKindConsumer    = 5
+	otlpStatusCodeError = 2
+)
+
+// OTLPReporter exports spans in batches to an OpenTelemetry collector, with the JSON encoding of OTLP over HTTP.
+// Spans are dropped if the collector can not keep up, or once the reporter is closed.
+type OTLPReporter struct {
+	ctx         context.Context
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	spans       chan wtracing.SpanModel
+	// stopping is closed by Close, spans is never closed so that late spans are dropped instead of panicking
+	stopping  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewOTLPReporter returns a reporter exporting spans to the traces endpoint of an OTLP/HTTP collector, such as
+// http://localhost:4318/v1/traces. Dropped spans are logged and counted with the logger and metrics of the context.
+func NewOTLPReporter(ctx context.Context, endpoint, serviceName string) *OTLPReporter {
+	r := &OTLPReporter{
+		ctx:         ctx,
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: otlpTimeout},
+		spans:       make(chan wtracing.SpanModel, otlpQueueSize),
+		stopping:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Send queues the span to be exported, unless the queue is full or the reporter is closed
+func (r *OTLPReporter) Send(span wtracing.SpanModel) {
+	select {
+	case <-r.stopping:
+		return
+	default:
+	}
+	select {
+	case r.spans <- span:
+	default:
+		metrics.FromContext(r.ctx).Counter(otlpDroppedSpansMetricName).Inc(1)
+	}
+}
+
+// Close exports the queued spans and stops the reporter
+func (r *OTLPReporter) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stopping)
+	})
+	<-r.done
+	return nil
+}
+
+func (r *OTLPReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	batch := make([]wtracing.SpanModel, 0, otlpBatchSize)
+	for {
+		select {
+		case span := <-r.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				r.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.export(batch)
+			batch = batch[:0]
+		case <-r.stopping:
+			r.exportQueued(batch)
+			return
+		}
+	}
+}
+
+// exportQueued exports the given batch along with the spans still queued
+func (r *OTLPReporter) exportQueued(batch []wtracing.SpanModel) {
+	for {
+		select {
+		case span := <-r.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				r.export(batch)
+				batch = batch[:0]
+			}
+		default:
+			r.export(batch)
+			return
+		}
+	}
+}
+
+func (r *OTLPReporter) export(batch []wtracing.SpanModel) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(r.request(batch))
+	if err != nil {
+		r.dropBatch(batch, "failed to encode spans", err)
+		return
+	}
+	response, err := r.client.Post(r.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		r.dropBatch(batch, "failed to send spans to the collector", err)
+		return
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		r.dropBatch(batch, "the collector rejected spans", nil, svc1log.SafeParam("statusCode", response.StatusCode))
+	}
+}
+
+func (r *OTLPReporter) dropBatch(batch []wtracing.SpanModel, message string, err error, params ...svc1log.Param) {
+	metrics.FromContext(r.ctx).Counter(otlpDroppedBatchesMetricName).Inc(1)
+	metrics.FromContext(r.ctx).Counter(otlpDroppedSpansMetricName).Inc(int64(len(batch)))
+	params = append(params, svc1log.SafeParam("endpoint", r.endpoint), svc1log.SafeParam("spanCount", len(batch)))
+	if err != nil {
+		params = append(params, svc1log.Stacktrace(err))
+	}
+	svc1log.FromContext(r.ctx).Warn(message+", dropping them", params...)
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r *OTLPReporter) request(batch []wtracing.SpanModel) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, otlpSpanOf(span))
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{{
+			Key:   "service.name",
+			Value: otlpAnyValue{StringValue: r.serviceName},
+		}}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/palantir/k8s-spark-scheduler"},
+			Spans: spans,
+		}},
+	}}}
+}
+
+func otlpSpanOf(span wtracing.SpanModel) otlpSpan {
+	result := otlpSpan{
+		// zipkin trace ids may be 64 bits long, while OTLP requires 128 bits
+		TraceID:           leftPad(string(span.TraceID), 32),
+		SpanID:            leftPad(string(span.ID), 16),
+		Name:              span.Name,
+		Kind:              otlpKind(span.Kind),
+		StartTimeUnixNano: strconv.FormatInt(span.Timestamp.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.Timestamp.Add(span.Duration).UnixNano(), 10),
+	}
+	if span.ParentID != nil {
+		result.ParentSpanID = leftPad(string(*span.ParentID), 16)
+	}
+	keys := make([]string, 0, len(span.Tags))
+	for key := range span.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == ErrorTag {
+			result.Status = &otlpStatus{Code: otlpStatusCodeError, Message: span.Tags[key]}
+			continue
+		}
+		result.Attributes = append(result.Attributes, otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: span.Tags[key]}})
+	}
+	return result
+}
+
+func otlpKind(kind wtracing.Kind) int {
+	switch kind {
+	case wtracing.Server:
+		return otlpKindServer
+	case wtracing.Client:
+		return otlpKindClient
+	case wtracing.Producer:
+		return otlpKindProducer
+	case wtracing.Consumer:
+		return otlpKindConsumer
+	default:
+		return otlpKindInternal
+	}
+}
+
+func leftPad(id string, length int) string {
+	if len(id) >= length {
+		return id
+	}
+	return strings.Repeat("0", length-len(id)) + id
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+)
+
+func TestOTLPExport(t *testing.T) {
+	var lock sync.Mutex
+	var requests []otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var request otlpRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode export request: %v", err)
+		}
+		lock.Lock()
+		requests = append(requests, request)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	tracer, closer, err := NewTracer(context.Background(), config.TracingConfig{OTLPEndpoint: server.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := wtracing.ContextWithTracer(context.Background(), tracer)
+	parent, ctx := StartSpan(ctx, "predicate", wtracing.WithSpanTag("k8s.pod.name", "driver"))
+	child, _ := StartSpan(ctx, "binpack")
+	TagError(child, errors.New("application does not fit to the cluster"))
+	child.Finish()
+	parent.Finish()
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 1 || len(requests[0].ResourceSpans) != 1 || len(requests[0].ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected the spans to be exported in a single request, got %+v", requests)
+	}
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	exportedChild, exportedParent := spans[0], spans[1]
+	if exportedParent.Name != "spark-scheduler.predicate" || exportedChild.Name != "spark-scheduler.binpack" {
+		t.Errorf("unexpected span names %q and %q", exportedParent.Name, exportedChild.Name)
+	}
+	if len(exportedParent.TraceID) != 32 || exportedChild.TraceID != exportedParent.TraceID {
+		t.Errorf("expected both spans to share a 128 bit trace id, got %q and %q", exportedParent.TraceID, exportedChild.TraceID)
+	}
+	if exportedChild.ParentSpanID != exportedParent.SpanID {
+		t.Errorf("expected the parent span id %q, got %q", exportedParent.SpanID, exportedChild.ParentSpanID)
+	}
+	if exportedChild.Status == nil || exportedChild.Status.Code != otlpStatusCodeError {
+		t.Errorf("expected the failed span to have an error status, got %+v", exportedChild.Status)
+	}
+	if len(exportedParent.Attributes) != 1 || exportedParent.Attributes[0].Key != "k8s.pod.name" || exportedParent.Attributes[0].Value.StringValue != "driver" {
+		t.Errorf("unexpected attributes %+v", exportedParent.Attributes)
+	}
+}
+
+func TestOTLPSendAfterClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	reporter := NewOTLPReporter(context.Background(), server.URL, serviceName)
+	reporter.Send(wtracing.SpanModel{SpanContext: wtracing.SpanContext{TraceID: "1", ID: "1"}, Name: "predicate"})
+	if err := reporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// spans finished by in-flight requests during shutdown are dropped
+	reporter.Send(wtracing.SpanModel{SpanContext: wtracing.SpanContext{TraceID: "1", ID: "2"}, Name: "bind"})
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/palantir/k8s-spark-scheduler/config"
+	"github.com/palantir/k8s-spark-scheduler/internal/common"
+	"github.com/palantir/witchcraft-go-logging/wlog/trclog/trc1log"
+	"github.com/palantir/witchcraft-go-tracing/wtracing"
+	"github.com/palantir/witchcraft-go-tracing/wzipkin"
+	"gopkg.in/natefinch/lumberjack.v2"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	serviceName = "spark-scheduler"
+	spanPrefix  = "spark-scheduler."
+	// ErrorTag is the tag of spans that failed, holding the error message
+	ErrorTag = "error"
+)
+
+// StartSpan starts a span of the scheduling path with the tracer in the context, as a child of the span in the context,
+// and returns a context holding the span. The span is a no-op if the context has no tracer.
+func StartSpan(ctx context.Context, name string, options ...wtracing.SpanOption) (wtracing.Span, context.Context) {
+	span, _ := wtracing.StartSpanFromTracerInContext(ctx, spanPrefix+name, options...)
+	return span, wtracing.ContextWithSpan(ctx, span)
+}
+
+// PodTags returns the options tagging a span with the pod it schedules
+func PodTags(pod *v1.Pod) []wtracing.SpanOption {
+	return []wtracing.SpanOption{
+		wtracing.WithSpanTag("k8s.namespace.name", pod.Namespace),
+		wtracing.WithSpanTag("k8s.pod.name", pod.Name),
+		wtracing.WithSpanTag("spark.role", pod.Labels[common.SparkRoleLabel]),
+		wtracing.WithSpanTag("spark.app.id", pod.Labels[common.SparkAppIDLabel]),
+	}
+}
+
+// TagError tags the span with the error, if there is one
+func TagError(span wtracing.Span, err error) {
+	if span != nil && err != nil {
+		span.Tag(ErrorTag, err.Error())
+	}
+}
+
+// NewTracer returns a tracer exporting spans as configured, or nil if no exporter is configured, in which case spans go
+// to the trace log of the server. Spans are sampled at the given rate, and always if it is not set.
+func NewTracer(ctx context.Context, tracingConfig config.TracingConfig, sampleRate *float64) (wtracing.Tracer, io.Closer, error) {
+	var reporters multiReporter
+	if tracingConfig.File != "" {
+		reporters = append(reporters, trc1log.New(&lumberjack.Logger{
+			Filename:   tracingConfig.File,
+			MaxSize:    100,
+			MaxBackups: 3,
+			Compress:   true,
+		}))
+	}
+	if tracingConfig.OTLPEndpoint != "" {
+		reporters = append(reporters, NewOTLPReporter(ctx, tracingConfig.OTLPEndpoint, serviceName))
+	}
+	if len(reporters) == 0 {
+		return nil, nil, nil
+	}
+	tracer, err := wzipkin.NewTracer(
+		reporters,
+		wtracing.WithLocalEndpoint(&wtracing.Endpoint{ServiceName: serviceName}),
+		wtracing.WithSampler(sampler(sampleRate)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tracer, reporters, nil
+}
+
+func sampler(sampleRate *float64) wtracing.Sampler {
+	if sampleRate == nil || *sampleRate >= 1 {
+		return func(uint64) bool { return true }
+	}
+	if *sampleRate <= 0 {
+		return func(uint64) bool { return false }
+	}
+	boundary := uint64(*sampleRate * float64(math.MaxUint64))
+	return func(id uint64) bool {
+		return id < boundary
+	}
+}
+
+// multiReporter sends spans to every one of its reporters
+type multiReporter []wtracing.Reporter
+
+func (m multiReporter) Send(span wtracing.SpanModel) {
+	for _, reporter := range m {
+		reporter.Send(span)
+	}
+}
+
+func (m multiReporter) Close() error {
+	var firstErr error
+	for _, reporter := range m {
+		if err := reporter.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
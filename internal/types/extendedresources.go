@@ -0,0 +1,115 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"github.com/palantir/k8s-spark-scheduler-lib/pkg/apis/sparkscheduler/v1beta2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// NodeGroupExtendedResources represents quantities of extended resources for a group of nodes, indexed by node name
+type NodeGroupExtendedResources map[string]v1.ResourceList
+
+// IsExtendedResource returns true for resources that are not tracked by resources.Resources
+func IsExtendedResource(name v1.ResourceName) bool {
+	for _, supported := range v1beta2.SupportedV1Beta2ResourceTypes {
+		if name == supported {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtendedResourcesFromList returns a copy of the extended resources in the given resource list
+func ExtendedResourcesFromList(resourceList v1.ResourceList) v1.ResourceList {
+	res := v1.ResourceList{}
+	for name, quantity := range resourceList {
+		if IsExtendedResource(name) {
+			res[name] = quantity.DeepCopy()
+		}
+	}
+	return res
+}
+
+// ExtendedResourceUsageForNodes tallies extended resource usages per node from the given list of resource reservations
+func ExtendedResourceUsageForNodes(resourceReservations []*v1beta2.ResourceReservation) NodeGroupExtendedResources {
+	res := NodeGroupExtendedResources{}
+	for _, rr := range resourceReservations {
+		for _, reservation := range rr.Spec.Reservations {
+			res.AddFromReservation(&reservation)
+		}
+	}
+	return res
+}
+
+// AddFromReservation adds the extended resources of the given reservation to its node, modifies receiver
+func (r NodeGroupExtendedResources) AddFromReservation(reservation *v1beta2.Reservation) {
+	for name, quantity := range reservation.Resources {
+		if quantity == nil || !IsExtendedResource(v1.ResourceName(name)) {
+			continue
+		}
+		r.addQuantity(reservation.Node, v1.ResourceName(name), *quantity)
+	}
+}
+
+// Add adds all resources in other into the receiver, modifies receiver
+func (r NodeGroupExtendedResources) Add(other NodeGroupExtendedResources) {
+	for node, resourceList := range other {
+		for name, quantity := range resourceList {
+			r.addQuantity(node, name, quantity)
+		}
+	}
+}
+
+// Sub subtracts all resources in other from the receiver, modifies receiver
+func (r NodeGroupExtendedResources) Sub(other NodeGroupExtendedResources) {
+	for node, resourceList := range other {
+		for name, quantity := range resourceList {
+			negated := quantity.DeepCopy()
+			negated.Neg()
+			r.addQuantity(node, name, negated)
+		}
+	}
+}
+
+// Copy returns a deep copy of the receiver
+func (r NodeGroupExtendedResources) Copy() NodeGroupExtendedResources {
+	res := make(NodeGroupExtendedResources, len(r))
+	for node, resourceList := range r {
+		res[node] = resourceList.DeepCopy()
+	}
+	return res
+}
+
+// Fits returns true if the given node has at least the requested quantity of every resource in requests
+func (r NodeGroupExtendedResources) Fits(node string, requests v1.ResourceList) bool {
+	for name, requested := range requests {
+		available := r[node][name]
+		if requested.Cmp(available) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r NodeGroupExtendedResources) addQuantity(node string, name v1.ResourceName, quantity resource.Quantity) {
+	if r[node] == nil {
+		r[node] = v1.ResourceList{}
+	}
+	current := r[node][name]
+	current.Add(quantity)
+	r[node][name] = current
+}
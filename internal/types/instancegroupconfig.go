@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// InstanceGroupConfigSpec holds the settings of the instance group an InstanceGroupConfig is named after. Unset
+// fields fall back to the install configuration.
+type InstanceGroupConfigSpec struct {
+	Binpack                      *string                     `json:"binpack,omitempty"`
+	FIFO                         *bool                       `json:"fifo,omitempty"`
+	FIFOEnforceAfterPodAge       *metav1.Duration            `json:"fifoEnforceAfterPodAge,omitempty"`
+	DriverOrderingPolicy         *string                     `json:"driverOrderingPolicy,omitempty"`
+	DriverPrioritizedNodeLabel   *InstanceGroupLabelPriority `json:"driverPrioritizedNodeLabel,omitempty"`
+	ExecutorPrioritizedNodeLabel *InstanceGroupLabelPriority `json:"executorPrioritizedNodeLabel,omitempty"`
+	Overcommit                   *InstanceGroupOvercommit    `json:"overcommit,omitempty"`
+	Queues                       *InstanceGroupQueuesConfig  `json:"queues,omitempty"`
+}
+
+// InstanceGroupLabelPriority is an ordered list of values of a node label used to sort candidate nodes
+type InstanceGroupLabelPriority struct {
+	Name                     string   `json:"labelName"`
+	DescendingPriorityValues []string `json:"labelValuesDescendingPriority"`
+}
+
+// InstanceGroupOvercommit holds the ratios the allocatable resources of the nodes of an instance group are scaled by
+// when scheduling, unset ratios are 1
+type InstanceGroupOvercommit struct {
+	CPU    *float64 `json:"cpu,omitempty"`
+	Memory *float64 `json:"memory,omitempty"`
+}
+
+// InstanceGroupQueuesConfig holds the queues and their quotas within an instance group
+type InstanceGroupQueuesConfig struct {
+	QueueLabel string                              `json:"queueLabel,omitempty"`
+	Queues     map[string]InstanceGroupQueueConfig `json:"queues,omitempty"`
+}
+
+// InstanceGroupQueueConfig is the configuration of a single queue of an instance group
+type InstanceGroupQueueConfig struct {
+	Parent     string                 `json:"parent,omitempty"`
+	Guaranteed InstanceGroupResources `json:"guaranteed,omitempty"`
+	Max        InstanceGroupResources `json:"max,omitempty"`
+}
+
+// InstanceGroupResources is a set of resource quantities
+type InstanceGroupResources struct {
+	CPU       string `json:"cpu,omitempty"`
+	Memory    string `json:"memory,omitempty"`
+	NvidiaGPU string `json:"nvidia.com/gpu,omitempty"`
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2019 Palantir Technologies. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// SparkApplicationSpec holds the fields of the spec of a spark-operator SparkApplication that determine the resources
+// of the application
+type SparkApplicationSpec struct {
+	SparkConf            map[string]string                  `json:"sparkConf,omitempty"`
+	Driver               SparkApplicationPodSpec            `json:"driver"`
+	Executor             SparkApplicationPodSpec            `json:"executor"`
+	DynamicAllocation    *SparkApplicationDynamicAllocation `json:"dynamicAllocation,omitempty"`
+	MemoryOverheadFactor *string                            `json:"memoryOverheadFactor,omitempty"`
+}
+
+// SparkApplicationPodSpec holds the resources of the driver or the executors of a SparkApplication
+type SparkApplicationPodSpec struct {
+	Cores          *int32               `json:"cores,omitempty"`
+	CoreRequest    *string              `json:"coreRequest,omitempty"`
+	Memory         *string              `json:"memory,omitempty"`
+	MemoryOverhead *string              `json:"memoryOverhead,omitempty"`
+	GPU            *SparkApplicationGPU `json:"gpu,omitempty"`
+	// Instances is only set for executors
+	Instances *int32 `json:"instances,omitempty"`
+}
+
+// SparkApplicationGPU holds the gpu resource name and quantity of the driver or the executors of a SparkApplication
+type SparkApplicationGPU struct {
+	Name     string `json:"name"`
+	Quantity int64  `json:"quantity"`
+}
+
+// SparkApplicationDynamicAllocation holds the dynamic allocation configuration of a SparkApplication
+type SparkApplicationDynamicAllocation struct {
+	Enabled      bool   `json:"enabled,omitempty"`
+	MinExecutors *int32 `json:"minExecutors,omitempty"`
+	MaxExecutors *int32 `json:"maxExecutors,omitempty"`
+}
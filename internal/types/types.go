@@ -16,6 +16,7 @@ package types
 
 import (
 	"github.com/palantir/k8s-spark-scheduler-lib/pkg/resources"
+	v1 "k8s.io/api/core/v1"
 )
 
 // SparkApplicationResources holds all resources for a single SparkApplication
@@ -24,4 +25,8 @@ type SparkApplicationResources struct {
 	ExecutorResources *resources.Resources
 	MinExecutorCount  int
 	MaxExecutorCount  int
+	// DriverExtendedResources and ExecutorExtendedResources hold the requested resources other than cpu, memory and
+	// nvidia gpus, which resources.Resources does not track
+	DriverExtendedResources   v1.ResourceList
+	ExecutorExtendedResources v1.ResourceList
 }